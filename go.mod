@@ -3,7 +3,7 @@ module github.com/chyroc/icloudgo
 go 1.18
 
 require (
-	github.com/chyroc/gorequests v0.33.0
+	github.com/chyroc/persistent-cookiejar v0.1.0
 	github.com/dgraph-io/badger/v3 v3.2103.5
 	github.com/satori/go.uuid v1.2.0
 	github.com/urfave/cli/v2 v2.27.0
@@ -13,7 +13,6 @@ require (
 	github.com/OneOfOne/xxhash v1.2.8 // indirect
 	github.com/cespare/xxhash v1.1.0 // indirect
 	github.com/cespare/xxhash/v2 v2.2.0 // indirect
-	github.com/chyroc/persistent-cookiejar v0.1.0 // indirect
 	github.com/cpuguy83/go-md2man/v2 v2.0.3 // indirect
 	github.com/davecgh/go-spew v1.1.2-0.20180830191138-d8f796af33cc // indirect
 	github.com/dgraph-io/ristretto v0.1.1 // indirect
@@ -0,0 +1,114 @@
+package command
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/chyroc/icloudgo"
+)
+
+// albumMembership maps the asset id to the names of the user albums which contain it, it is the keywords of the xmp
+// sidecar, so the sidecar has all the albums of the asset, not only the albums downloaded in this run
+type albumMembership map[string][]string
+
+// loadAlbumMembership walks all the user albums, it costs one query per 100 photos of every album
+func (r *downloadCommand) loadAlbumMembership() (albumMembership, error) {
+	albums, err := r.photoCli.Albums()
+	if err != nil {
+		return nil, err
+	}
+	var userAlbums []*icloudgo.PhotoAlbum
+	for _, album := range albums {
+		if album.IsUserAlbum() && !album.IsFolder() {
+			userAlbums = append(userAlbums, album)
+		}
+	}
+	sort.Slice(userAlbums, func(i, j int) bool { return userAlbums[i].Key < userAlbums[j].Key })
+
+	res := albumMembership{}
+	for _, album := range userAlbums {
+		err := album.WalkPhotos(0, func(offset int64, assets []*icloudgo.PhotoAsset) error {
+			for _, asset := range assets {
+				res[asset.ID()] = mergeAlbums(res[asset.ID()], album.Name)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("walk album %s err: %w", album.Key, err)
+		}
+	}
+	return res, nil
+}
+
+// albumKeywords returns the user albums which contain the asset, the membership is loaded at the first call
+func (r *downloadCommand) albumKeywords(id string) ([]string, error) {
+	r.membershipLock.Lock()
+	defer r.membershipLock.Unlock()
+
+	if r.membership == nil {
+		membership, err := r.loadAlbumMembership()
+		if err != nil {
+			return nil, err
+		}
+		r.membership = membership
+	}
+	return r.membership[id], nil
+}
+
+// refreshAlbumMembership reloads the membership, and rewrites the sidecars of the downloaded assets whose albums changed
+func (r *downloadCommand) refreshAlbumMembership() error {
+	if !r.XMPSidecar {
+		return nil
+	}
+	r.photoCli.ResetAlbums()
+	membership, err := r.loadAlbumMembership()
+	if err != nil {
+		return err
+	}
+
+	r.membershipLock.Lock()
+	old := r.membership
+	r.membership = membership
+	r.membershipLock.Unlock()
+	if old == nil {
+		return nil
+	}
+
+	changed := map[string]bool{}
+	for id, albums := range membership {
+		if !isSameStrings(old[id], albums) {
+			changed[id] = true
+		}
+	}
+	for id, albums := range old {
+		if !isSameStrings(membership[id], albums) {
+			changed[id] = true
+		}
+	}
+
+	var assets []*icloudgo.PhotoAsset
+	for id := range changed {
+		po, err := r.dalGetAsset(id)
+		if err != nil {
+			return err
+		} else if po != nil {
+			assets = append(assets, r.photoCli.NewPhotoAssetFromBytes([]byte(po.Data)))
+		}
+	}
+	if len(assets) > 0 {
+		fmt.Printf("[icloudgo] [meta] albums of %d assets changed, rewrite the xmp sidecars\n", len(assets))
+	}
+	return r.saveModifiedAssets(assets)
+}
+
+func isSameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
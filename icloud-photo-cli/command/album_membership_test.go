@@ -0,0 +1,73 @@
+package command
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chyroc/icloudgo/icloudtest"
+)
+
+func TestXMPSidecarKeywords(t *testing.T) {
+	server := icloudtest.NewServer()
+	defer server.Close()
+	photo := server.AddPhoto("a.jpg", []byte("a"), time.Now())
+	server.AddAlbum("Trip", photo.ID)
+	server.AddAlbum("Family", photo.ID)
+
+	// only Trip is downloaded, the sidecar has the both albums
+	cmd := newTestDownloadCommand(t, server)
+	cmd.AlbumNames = []string{"Trip"}
+	cmd.XMPSidecar = true
+	album, err := cmd.photoCli.GetAlbum("Trip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.saveAlbumMeta(album); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(cmd.Output+"/.tmp", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.downloadFromDatabase(); err != nil {
+		t.Fatal(err)
+	}
+
+	path, _, err := cmd.assetPaths(cmd.photoCli.NewPhotoAssetFromBytes(mustAssetData(t, cmd, photo.ID)), []string{"Trip"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := os.ReadFile(path + ".xmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Trip", "Family"} {
+		if !strings.Contains(string(bs), name) {
+			t.Fatalf("keyword %s is missing: %s", name, bs)
+		}
+	}
+
+	// the album added later is written by the refresh
+	server.AddAlbum("Work", photo.ID)
+	if err := cmd.refreshAlbumMembership(); err != nil {
+		t.Fatal(err)
+	}
+	if bs, err = os.ReadFile(path + ".xmp"); err != nil {
+		t.Fatal(err)
+	} else if !strings.Contains(string(bs), "Work") {
+		t.Fatalf("keyword Work is missing: %s", bs)
+	}
+}
+
+func mustAssetData(t *testing.T, cmd *downloadCommand, id string) []byte {
+	t.Helper()
+
+	po, err := cmd.dalGetAsset(id)
+	if err != nil {
+		t.Fatal(err)
+	} else if po == nil {
+		t.Fatalf("asset %s not found", id)
+	}
+	return []byte(po.Data)
+}
@@ -0,0 +1,125 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/chyroc/icloudgo"
+)
+
+const (
+	autoDeleteModeOff    = "off"
+	autoDeleteModeTrash  = "trash"
+	autoDeleteModeDelete = "delete"
+	autoDeleteModeDryRun = "dry-run"
+)
+
+// trashDateLayout is the name of the dir in trash, the files trashed in the same day are in the same dir
+const trashDateLayout = "2006-01-02"
+
+func (r *downloadCommand) trashDir() string {
+	return filepath.Join(r.Output, ".trash")
+}
+
+// moveToTrash moves the file to <output>/.trash/<date>/<path relative to output>, and returns the path in trash, the
+// file trashed before with the same path is kept by appending the timestamp to the new one
+func (r *downloadCommand) moveToTrash(path string) (string, error) {
+	if _, err := os.Stat(path); err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(r.Output, path)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	trashPath := filepath.Join(r.trashDir(), now.Format(trashDateLayout), rel)
+	if _, err := os.Lstat(trashPath); err == nil {
+		trashPath += "." + strconv.FormatInt(now.UnixNano(), 10)
+	}
+	if err := mkdirAll(filepath.Dir(trashPath)); err != nil {
+		return "", err
+	}
+	if err := os.Rename(path, trashPath); err != nil {
+		return "", fmt.Errorf("move '%s' to trash failed: %w", path, err)
+	}
+	return trashPath, nil
+}
+
+// purgeTrash removes the dirs of the days older than the trash retention
+func (r *downloadCommand) purgeTrash() error {
+	if r.TrashRetention == "" {
+		return nil
+	}
+	now := time.Now()
+	before, err := parseFilterDate(r.TrashRetention, now)
+	if err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(r.trashDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, entry := range entries {
+		day, err := time.ParseInLocation(trashDateLayout, entry.Name(), time.Local)
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		// the files trashed in the day are kept until the end of the day is out of the retention
+		if !day.AddDate(0, 0, 1).Before(before) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(r.trashDir(), entry.Name())); err != nil {
+			return err
+		}
+		fmt.Printf("[icloudgo] [auto_delete] purge trash %s\n", entry.Name())
+		if err := r.appendAutoDeleteReport(fmt.Sprintf("%s\tpurge\t%s\n", now.Format(time.RFC3339), filepath.Join(r.trashDir(), entry.Name()))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reportAutoDelete appends the deleted file to <output>/.auto_delete.log, trashPath is empty if the file is not trashed
+func (r *downloadCommand) reportAutoDelete(photo *icloudgo.PhotoAsset, livePhoto bool, path, trashPath string) error {
+	line := fmt.Sprintf("%s\t%s\t%s\t%s\t%s", time.Now().Format(time.RFC3339), r.AutoDeleteMode, photo.ID(), photo.Filename(livePhoto), path)
+	if trashPath != "" {
+		line += "\t" + trashPath
+	}
+	return r.appendAutoDeleteReport(line + "\n")
+}
+
+// markDryRunReported returns false if the path is reported by the dry-run mode in this process
+func (r *downloadCommand) markDryRunReported(path string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.dryRunReported == nil {
+		r.dryRunReported = map[string]bool{}
+	}
+	if r.dryRunReported[path] {
+		return false
+	}
+	r.dryRunReported[path] = true
+	return true
+}
+
+func (r *downloadCommand) appendAutoDeleteReport(line string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	f, err := os.OpenFile(filepath.Join(r.Output, ".auto_delete.log"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.WriteString(line)
+	return err
+}
@@ -0,0 +1,51 @@
+package command
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chyroc/icloudgo"
+	"github.com/chyroc/icloudgo/icloudtest"
+)
+
+func TestAutoDeleteDryRunOnce(t *testing.T) {
+	server := icloudtest.NewServer()
+	defer server.Close()
+	a := server.AddPhoto("a.jpg", []byte("a"), time.Now())
+
+	cmd := newTestDownloadCommand(t, server)
+	cmd.AutoDeleteMode = autoDeleteModeDryRun
+	syncTestDownload(t, cmd)
+	server.DeletePhoto(a.ID)
+
+	album, err := cmd.photoCli.GetAlbum(icloudgo.AlbumNameRecentlyDeleted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assets, err := album.GetPhotosByOffset(0, 10)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(assets) != 1 {
+		t.Fatalf("deleted assets: %d, expect 1", len(assets))
+	}
+
+	// the hourly walk finds the same asset again
+	for i := 0; i < 2; i++ {
+		if err := cmd.deleteLocalAsset(assets[0]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bs, err := os.ReadFile(filepath.Join(cmd.Output, ".auto_delete.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(bs)), "\n"); len(lines) != 1 {
+		t.Fatalf("report lines: %d, expect 1: %s", len(lines), bs)
+	}
+	if status := testAssetStatus(t, cmd, a.ID); status != 1 {
+		t.Fatalf("status of the asset in dry-run: %d, expect 1", status)
+	}
+}
@@ -29,21 +29,41 @@ func NewDownloadFlag() []cli.Flag {
 			Aliases:  []string{"o"},
 			EnvVars:  []string{"ICLOUD_OUTPUT"},
 		},
-		&cli.StringFlag{
+		&cli.StringSliceFlag{
 			Name:     "album",
-			Usage:    "album name, if not set, download all albums",
+			Usage:    "album name, can be set multiple times, if not set, download all photos",
 			Required: false,
 			Aliases:  []string{"a"},
 			EnvVars:  []string{"ICLOUD_ALBUM"},
 		},
+		&cli.BoolFlag{
+			Name:     "all-albums",
+			Usage:    "download all photos and all the albums created by user",
+			Required: false,
+			Value:    false,
+			EnvVars:  []string{"ICLOUD_ALL_ALBUMS"},
+		},
+		&cli.StringFlag{
+			Name:     "album-link",
+			Usage:    "when download more than one album, link the photos to <output>/Albums/<album>/, support: hardlink, symlink, none",
+			Required: false,
+			Value:    "hardlink",
+			EnvVars:  []string{"ICLOUD_ALBUM_LINK"},
+		},
 		&cli.StringFlag{
 			Name:     "folder-structure",
-			Usage:    "support: `2006`(year), `01`(month), `02`(day), `15`(24-hour), `03`(12-hour), `04`(minute), `05`(second), example: `2006/01/02`, default is `/`",
+			Usage:    "support: `2006`(year), `01`(month), `02`(day), `15`(24-hour), `03`(12-hour), `04`(minute), `05`(second), `{location}`(latitude_longitude), example: `2006/01/02`, default is `/`",
 			Required: false,
 			Value:    "/",
 			Aliases:  []string{"fs"},
 			EnvVars:  []string{"ICLOUD_FOLDER_STRUCTURE"},
 		},
+		&cli.StringFlag{
+			Name:     "path-template",
+			Usage:    "mirror the albums by the path template, folder-structure and file-structure are ignored if set, support: {album}, {media_type}, {date:2006/01}, {filename}, {id}, {ext}, {location}, example: {album}/{date:2006}/{filename}{ext}",
+			Required: false,
+			EnvVars:  []string{"ICLOUD_PATH_TEMPLATE"},
+		},
 		&cli.StringFlag{
 			Name:     "file-structure",
 			Usage:    "support: id(unique file id), name(file human readable name)",
@@ -69,12 +89,25 @@ func NewDownloadFlag() []cli.Flag {
 		},
 		&cli.BoolFlag{
 			Name:     "auto-delete",
-			Usage:    "Automatically delete photos from local but recently deleted folders",
+			Usage:    "Automatically handle the local photos in recently deleted folders by auto-delete-mode",
 			Required: false,
 			Value:    true,
 			Aliases:  []string{"ad"},
 			EnvVars:  []string{"ICLOUD_AUTO_DELETE"},
 		},
+		&cli.StringFlag{
+			Name:     "auto-delete-mode",
+			Usage:    "how to handle the local photos in recently deleted folders, support: off, trash(move to <output>/.trash/<date>/), delete, dry-run(only report), default is trash if auto-delete is true, otherwise off, the report is appended to <output>/.auto_delete.log",
+			Required: false,
+			EnvVars:  []string{"ICLOUD_AUTO_DELETE_MODE"},
+		},
+		&cli.StringFlag{
+			Name:     "trash-retention",
+			Usage:    "the files in trash older than the retention are removed, empty means keep forever, example: `30d`, `720h`",
+			Required: false,
+			Value:    "30d",
+			EnvVars:  []string{"ICLOUD_TRASH_RETENTION"},
+		},
 		&cli.BoolFlag{
 			Name:     "with-live-photo",
 			Usage:    "Save video of the live photo",
@@ -83,7 +116,22 @@ func NewDownloadFlag() []cli.Flag {
 			Aliases:  []string{"lp"},
 			EnvVars:  []string{"ICLOUD_WITH_LIVE_PHOTO"},
 		},
+		&cli.BoolFlag{
+			Name:     "xmp-sidecar",
+			Usage:    "Save xmp sidecar(<file>.xmp) with date, favorite, orientation, gps and album keyword",
+			Required: false,
+			Value:    false,
+			EnvVars:  []string{"ICLOUD_XMP_SIDECAR"},
+		},
+		&cli.BoolFlag{
+			Name:     "patch-exif",
+			Usage:    "Write DateTimeOriginal and GPS to the jpeg photo which has no exif, the photo which has exif and other formats(heic, png, video) are not changed, use xmp-sidecar for them",
+			Required: false,
+			Value:    false,
+			EnvVars:  []string{"ICLOUD_PATCH_EXIF"},
+		},
 	)
+	res = append(res, filterFlag...)
 	return res
 }
 
@@ -94,6 +142,10 @@ func Download(c *cli.Context) error {
 	}
 	defer cmd.client.Close()
 
+	if err := cmd.dalResetFilter(cmd.Filter.fingerprint()); err != nil {
+		return err
+	}
+
 	go cmd.saveMeta()        //nolint:errcheck
 	go cmd.download()        //nolint:errcheck
 	go cmd.autoDeletePhoto() //nolint:errcheck
@@ -113,12 +165,19 @@ type downloadCommand struct {
 	Domain          string
 	Output          string
 	StopNum         int
-	AlbumName       string
+	AlbumNames      []string
+	AllAlbums       bool
+	AlbumLink       string
 	ThreadNum       int
-	AutoDelete      bool
+	AutoDeleteMode  string
+	TrashRetention  string
 	WithLivePhoto   bool
 	FolderStructure string
 	FileStructure   string
+	PathTemplate    string
+	XMPSidecar      bool
+	PatchExif       bool
+	Filter          *assetFilter
 
 	client        *icloudgo.Client
 	photoCli      *icloudgo.PhotoService
@@ -126,6 +185,13 @@ type downloadCommand struct {
 	lock          *sync.Mutex
 	exit          chan struct{}
 	startDownload chan struct{}
+
+	// membership is the user albums of the assets, it is loaded only if XMPSidecar is set
+	membership     albumMembership
+	membershipLock sync.Mutex
+
+	// dryRunReported is the paths reported by the dry-run mode, the hourly walk does not report them again
+	dryRunReported map[string]bool
 }
 
 func newDownloadCommand(c *cli.Context) (*downloadCommand, error) {
@@ -136,22 +202,59 @@ func newDownloadCommand(c *cli.Context) (*downloadCommand, error) {
 		Domain:          c.String("domain"),
 		Output:          c.String("output"),
 		StopNum:         c.Int("stop-found-num"),
-		AlbumName:       c.String("album"),
+		AllAlbums:       c.Bool("all-albums"),
+		AlbumLink:       c.String("album-link"),
 		ThreadNum:       c.Int("thread-num"),
 		WithLivePhoto:   c.Bool("with-live-photo"),
-		AutoDelete:      c.Bool("auto-delete"),
+		AutoDeleteMode:  c.String("auto-delete-mode"),
+		TrashRetention:  c.String("trash-retention"),
 		FolderStructure: c.String("folder-structure"),
 		FileStructure:   c.String("file-structure"),
+		PathTemplate:    c.String("path-template"),
+		XMPSidecar:      c.Bool("xmp-sidecar"),
+		PatchExif:       c.Bool("patch-exif"),
 		lock:            &sync.Mutex{},
 		exit:            make(chan struct{}),
 		startDownload:   make(chan struct{}),
 	}
-	if cmd.AlbumName == "" {
-		cmd.AlbumName = icloudgo.AlbumNameAll
+	for _, v := range c.StringSlice("album") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				cmd.AlbumNames = mergeAlbums(cmd.AlbumNames, name)
+			}
+		}
+	}
+	if len(cmd.AlbumNames) == 0 {
+		cmd.AlbumNames = []string{icloudgo.AlbumNameAll}
+	}
+	switch cmd.AlbumLink {
+	case "", "hardlink", "symlink", "none":
+	default:
+		return nil, fmt.Errorf("invalid album-link '%s', support: hardlink, symlink, none", cmd.AlbumLink)
 	}
+	switch cmd.AutoDeleteMode {
+	case "":
+		cmd.AutoDeleteMode = autoDeleteModeOff
+		// the files are trashed by default, so a photo deleted in icloud by mistake can be restored from local
+		if c.Bool("auto-delete") {
+			cmd.AutoDeleteMode = autoDeleteModeTrash
+		}
+	case autoDeleteModeOff, autoDeleteModeTrash, autoDeleteModeDelete, autoDeleteModeDryRun:
+	default:
+		return nil, fmt.Errorf("invalid auto-delete-mode '%s', support: off, trash, delete, dry-run", cmd.AutoDeleteMode)
+	}
+	if _, err := parseFilterDate(cmd.TrashRetention, time.Now()); err != nil {
+		return nil, fmt.Errorf("invalid trash-retention: %w", err)
+	}
+	filter, err := newAssetFilter(c)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Filter = filter
 
 	cli, err := icloudgo.New(&icloudgo.ClientOption{
 		AppID:           cmd.Username,
+		Password:        cmd.Password,
 		CookieDir:       cmd.CookieDir,
 		TwoFACodeGetter: &internal.StdinTextGetter{Tip: "2fa code"},
 		Domain:          cmd.Domain,
@@ -176,6 +279,10 @@ func newDownloadCommand(c *cli.Context) (*downloadCommand, error) {
 	cmd.client = cli
 	cmd.photoCli = photoCli
 	cmd.db = db
+	if err := cmd.dalIndexPathClaims(); err != nil {
+		cmd.Close()
+		return nil, err
+	}
 
 	return cmd, nil
 }
@@ -186,32 +293,200 @@ func (r *downloadCommand) saveMeta() (err error) {
 			fmt.Printf("[icloudgo] [meta] final err:%s\n", err.Error())
 		}
 	}()
-	album, err := r.photoCli.GetAlbum(r.AlbumName)
+
+	for {
+		albums, err := r.getAlbums()
+		if err != nil {
+			fmt.Printf("[icloudgo] [meta] get albums err: %s\n", err)
+			time.Sleep(time.Minute)
+			continue
+		}
+
+		failed := false
+		for _, album := range albums {
+			if err := r.saveAlbumMeta(album); err != nil {
+				fmt.Printf("[icloudgo] [meta] save album %s err: %s\n", album.Key, err)
+				failed = true
+			}
+		}
+		if err := r.refreshAlbumMembership(); err != nil {
+			fmt.Printf("[icloudgo] [meta] refresh album membership err: %s\n", err)
+			failed = true
+		}
+		if failed {
+			time.Sleep(time.Minute)
+		} else {
+			time.Sleep(time.Hour)
+		}
+	}
+}
+
+// getAlbums returns the albums to download, All Photos is always the first one if it is downloaded
+func (r *downloadCommand) getAlbums() ([]*icloudgo.PhotoAlbum, error) {
+	names := r.AlbumNames
+	if r.AllAlbums {
+		albums, err := r.photoCli.Albums()
+		if err != nil {
+			return nil, err
+		}
+		names = []string{icloudgo.AlbumNameAll}
+		var userAlbums []string
+		for name, album := range albums {
+			if album.IsUserAlbum() && !album.IsFolder() {
+				userAlbums = append(userAlbums, name)
+			}
+		}
+		sort.Strings(userAlbums)
+		names = append(names, userAlbums...)
+	}
+
+	var res []*icloudgo.PhotoAlbum
+	for _, name := range names {
+		album, err := r.photoCli.GetAlbum(name)
+		if err != nil {
+			return nil, err
+		}
+		if album.Key == icloudgo.AlbumNameAll {
+			res = append([]*icloudgo.PhotoAlbum{album}, res...)
+		} else {
+			res = append(res, album)
+		}
+	}
+	return res, nil
+}
+
+func (r *downloadCommand) saveAlbumMeta(album *icloudgo.PhotoAlbum) error {
+	// changes of the zone are only equal to the changes of all photos album
+	if album.Key == icloudgo.AlbumNameAll {
+		if syncToken := r.dalGetSyncToken(); syncToken != "" {
+			return r.saveChanges(syncToken)
+		}
+	}
+
+	// get sync token before walk, so the changes during walk will not be lost
+	syncToken, syncTokenErr := r.photoCli.CurrentSyncToken()
+	if syncTokenErr != nil {
+		fmt.Printf("[icloudgo] [meta] get sync token err: %s\n", syncTokenErr)
+	}
+
+	dbOffset := r.dalGetDownloadOffset(album.Key, album.Size())
+	fmt.Printf("[icloudgo] [meta] album: %s, total: %d, db_offset: %d, target: %s, thread-num: %d, stop-num: %d\n", album.Key, album.Size(), dbOffset, r.Output, r.ThreadNum, r.StopNum)
+	err := album.WalkPhotos(dbOffset, func(offset int64, assets []*internal.PhotoAsset) error {
+		if err := r.dalAddAssets(album.Key, r.Filter.filter(assets)); err != nil {
+			return err
+		}
+		if err := r.saveDownloadOffset(nil, album.Key, offset, true); err != nil {
+			return err
+		}
+		fmt.Printf("[icloudgo] [meta] update download offst of %s to %d\n", album.Key, offset)
+		r.setStartDownload()
+		return nil
+	})
 	if err != nil {
-		return err
+		return fmt.Errorf("walk photos err: %w", err)
+	}
+	if album.Key == icloudgo.AlbumNameAll && syncTokenErr == nil && syncToken != "" {
+		if err := r.dalSaveSyncToken(syncToken); err != nil {
+			fmt.Printf("[icloudgo] [meta] save sync token err: %s\n", err)
+		}
 	}
+	return nil
+}
 
-	for {
-		dbOffset := r.dalGetDownloadOffset(album.Size())
-		fmt.Printf("[icloudgo] [meta] album: %s, total: %d, db_offset: %d, target: %s, thread-num: %d, stop-num: %d\n", album.Name, album.Size(), dbOffset, r.Output, r.ThreadNum, r.StopNum)
-		err = album.WalkPhotos(dbOffset, func(offset int64, assets []*internal.PhotoAsset) error {
-			if err := r.dalAddAssets(assets); err != nil {
+func (r *downloadCommand) saveChanges(syncToken string) error {
+	fmt.Printf("[icloudgo] [meta] save changes, sync_token: %s\n", syncToken)
+	newSyncToken, err := r.photoCli.WalkChanges(syncToken, func(changes *icloudgo.PhotoChanges) error {
+		fmt.Printf("[icloudgo] [meta] changes, added=%d, modified=%d, deleted=%d, expunged=%d, more=%v\n", len(changes.Added), len(changes.Modified), len(changes.Deleted), len(changes.Expunged), changes.MoreComing)
+		if err := r.dalAddAssets(icloudgo.AlbumNameAll, r.Filter.filter(append(changes.Added, changes.Modified...))); err != nil {
+			return err
+		}
+		if err := r.saveModifiedAssets(r.Filter.filter(changes.Modified)); err != nil {
+			return err
+		}
+		for _, id := range changes.Deleted {
+			if err := r.saveDeletedAsset(id, false); err != nil {
 				return err
 			}
-			if err := r.saveDownloadOffset(nil, offset, true); err != nil {
+		}
+		for _, recordName := range changes.Expunged {
+			id, err := r.dalResolveAssetID(recordName)
+			if err != nil {
 				return err
+			} else if id == "" {
+				continue
 			}
-			fmt.Printf("[icloudgo] [meta] update download offst to %d\n", offset)
-			r.setStartDownload()
-			return nil
-		})
+			if err := r.saveDeletedAsset(id, true); err != nil {
+				return err
+			}
+		}
+		if err := r.dalSaveSyncToken(changes.SyncToken); err != nil {
+			return err
+		}
+		r.setStartDownload()
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, icloudgo.ErrSyncTokenExpired) {
+			// fallback to walk all photos from the beginning
+			fmt.Printf("[icloudgo] [meta] sync token expired, reset\n")
+			if err := r.saveDownloadOffset(nil, icloudgo.AlbumNameAll, 0, true); err != nil {
+				return err
+			}
+			return r.dalSaveSyncToken("")
+		}
+		return err
+	}
+	fmt.Printf("[icloudgo] [meta] save changes finished, sync_token: %s\n", newSyncToken)
+	return nil
+}
+
+// saveModifiedAssets rewrites the xmp sidecars of the downloaded assets whose metadata changed, the asset is downloaded
+// again if its file is not at the path anymore, e.g. the asset date in the folder structure changed
+func (r *downloadCommand) saveModifiedAssets(assets []*icloudgo.PhotoAsset) error {
+	for _, photo := range assets {
+		po, err := r.dalGetAsset(photo.ID())
 		if err != nil {
-			fmt.Printf("[icloudgo] [meta] walk photos err: %s\n", err)
-			time.Sleep(time.Minute)
-		} else {
-			time.Sleep(time.Hour)
+			return err
+		} else if po == nil || po.Status != 1 {
+			continue
+		}
+		path, links, err := r.assetPaths(photo, po.Albums, false)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(path); err != nil {
+			if err := r.dalSetUnDownloaded(photo.ID()); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := r.saveAlbumFiles(photo, path, links); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveDeletedAsset handles the asset deleted in icloud, the row is kept with its albums until the files are handled.
+//
+// The asset not downloaded has no file, it is forgotten. The downloaded asset moved to the recently deleted album is left
+// to autoDeletePhoto, and the expunged one is never in the album again, so its files are handled here by the auto
+// delete mode.
+func (r *downloadCommand) saveDeletedAsset(id string, expunged bool) error {
+	po, err := r.dalGetAsset(id)
+	if err != nil || po == nil {
+		return err
+	}
+	if po.Status != 1 {
+		if err := r.dalDeleteAsset(id); err != nil {
+			return err
 		}
+		return r.dalReleasePaths(id)
+	}
+	if !expunged || r.AutoDeleteMode == autoDeleteModeOff {
+		return nil
 	}
+	return r.deleteLocalAsset(r.photoCli.NewPhotoAssetFromBytes([]byte(po.Data)))
 }
 
 func (r *downloadCommand) setStartDownload() {
@@ -303,7 +578,7 @@ func (r *downloadCommand) downloadFromDatabase() error {
 					return
 				}
 
-				if isDownloaded, err := r.downloadPhotoAsset(photoAsset, pickReason); err != nil {
+				if isDownloaded, err := r.downloadPhotoAsset(photoAsset, assetQueue.albums[photoAsset.ID()], pickReason); err != nil {
 					if errors.Is(err, internal.ErrResourceGone) || strings.Contains(err.Error(), "no such host") {
 						// delete db
 						if err := r.dalDeleteAsset(photoAsset.ID()); err != nil {
@@ -336,8 +611,8 @@ func (r *downloadCommand) downloadFromDatabase() error {
 	return nil
 }
 
-func (r *downloadCommand) downloadPhotoAsset(photo *icloudgo.PhotoAsset, pickReason string) (bool, error) {
-	isDownloaded, err := r.downloadPhotoAssetInternal(photo, pickReason, false)
+func (r *downloadCommand) downloadPhotoAsset(photo *icloudgo.PhotoAsset, albums []string, pickReason string) (bool, error) {
+	isDownloaded, err := r.downloadPhotoAssetInternal(photo, albums, pickReason, false)
 	if err != nil {
 		return false, err
 	}
@@ -346,7 +621,7 @@ func (r *downloadCommand) downloadPhotoAsset(photo *icloudgo.PhotoAsset, pickRea
 			fmt.Printf("[icloudgo] [download] [%s] %s live photo skip\n", pickReason, photo.Filename(true))
 			return isDownloaded, nil
 		}
-		isDownloaded2, err := r.downloadPhotoAssetInternal(photo, pickReason, true)
+		isDownloaded2, err := r.downloadPhotoAssetInternal(photo, albums, pickReason, true)
 		if err != nil {
 			return false, err
 		}
@@ -355,43 +630,100 @@ func (r *downloadCommand) downloadPhotoAsset(photo *icloudgo.PhotoAsset, pickRea
 	return isDownloaded, nil
 }
 
-func (r *downloadCommand) downloadPhotoAssetInternal(photo *icloudgo.PhotoAsset, pickReason string, livePhoto bool) (bool, error) {
-	outputDir := photo.OutputDir(r.Output, r.FolderStructure)
+func (r *downloadCommand) downloadPhotoAssetInternal(photo *icloudgo.PhotoAsset, albums []string, pickReason string, livePhoto bool) (bool, error) {
+	path, links, err := r.claimAssetPaths(photo, albums, livePhoto)
+	if err != nil {
+		return false, err
+	}
+	outputDir := filepath.Dir(path)
 	tmpPath := photo.LocalPath(filepath.Join(r.Output, ".tmp"), icloudgo.PhotoVersionOriginal, r.FileStructure, livePhoto)
-	path := photo.LocalPath(outputDir, icloudgo.PhotoVersionOriginal, r.FileStructure, livePhoto)
 	name := path[len(r.Output):]
 
-	oldOutputDir := photo.OldOutputDir(r.Output, r.FolderStructure)
-	oldPath := photo.LocalPath(oldOutputDir, icloudgo.PhotoVersionOriginal, r.FileStructure, livePhoto)
-
 	if err := os.MkdirAll(outputDir, os.ModePerm); err != nil {
 		fmt.Printf("[icloudgo] [download] [%s] mkdir '%s' output dir: '%s' failed: %s\n", pickReason, photo.Filename(livePhoto), outputDir, err)
 		return false, err
 	}
 
 	// 如果 old 存在, 直接移动到新目录
-	if oldPath != path {
-		if f, _ := os.Stat(oldPath); f != nil {
-			if err := os.Rename(oldPath, path); err != nil {
-				fmt.Printf("[icloudgo] [download] [%s] compatible with wrong photo time for '%s' failed: %s\n", pickReason, name, err)
-				return false, err
-			} else {
-				fmt.Printf("[icloudgo] [download] [%s] compatible with wrong photo time for '%s' success\n", pickReason, name)
-				fmt.Printf("%s -> %s\n", oldPath, path)
+	if r.PathTemplate == "" {
+		oldOutputDir := photo.OldOutputDir(r.Output, r.FolderStructure)
+		oldPath := photo.LocalPath(oldOutputDir, icloudgo.PhotoVersionOriginal, r.FileStructure, livePhoto)
+		if oldPath != path {
+			if f, _ := os.Stat(oldPath); f != nil {
+				if err := os.Rename(oldPath, path); err != nil {
+					fmt.Printf("[icloudgo] [download] [%s] compatible with wrong photo time for '%s' failed: %s\n", pickReason, name, err)
+					return false, err
+				} else {
+					fmt.Printf("[icloudgo] [download] [%s] compatible with wrong photo time for '%s' success\n", pickReason, name)
+					fmt.Printf("%s -> %s\n", oldPath, path)
+				}
 			}
 		}
 	}
 
 	if f, _ := os.Stat(path); f != nil {
-		if photo.Size() != int(f.Size()) {
-			return false, r.downloadTo(pickReason, photo, livePhoto, tmpPath, path, name)
+		if err := r.verifyLocalFile(photo, livePhoto, path, false); err != nil {
+			if !errors.Is(err, icloudgo.ErrChecksumMismatch) {
+				return false, err
+			}
+			fmt.Printf("[icloudgo] [download] [%s] '%s' is corrupted, download again: %s\n", pickReason, name, err)
+			if err := r.downloadTo(pickReason, photo, livePhoto, tmpPath, path, name); err != nil {
+				return false, err
+			}
+			return false, r.saveAlbumFiles(photo, path, links)
 		} else {
 			// fmt.Printf("[icloudgo] [download] '%s' exist, skip.\n", path)
-			return true, nil
+			return true, r.saveAlbumFiles(photo, path, links)
 		}
 	} else {
-		return false, r.downloadTo(pickReason, photo, livePhoto, tmpPath, path, name)
+		if err := r.downloadTo(pickReason, photo, livePhoto, tmpPath, path, name); err != nil {
+			return false, err
+		}
+		return false, r.saveAlbumFiles(photo, path, links)
+	}
+}
+
+// saveAlbumFiles writes the xmp sidecar of the downloaded file, and links it to the album dirs
+func (r *downloadCommand) saveAlbumFiles(photo *icloudgo.PhotoAsset, path string, links []string) error {
+	if err := r.writeXMPSidecar(photo, path); err != nil {
+		return err
+	}
+	return r.linkAlbumFiles(path, links)
+}
+
+// writeXMPSidecar writes <path>.xmp, the sidecar is rewritten every time, so the changes of favorite, date are kept,
+// the keywords are all the user albums of the asset
+func (r *downloadCommand) writeXMPSidecar(photo *icloudgo.PhotoAsset, path string) error {
+	if !r.XMPSidecar {
+		return nil
+	}
+
+	keywords, err := r.albumKeywords(photo.ID())
+	if err != nil {
+		return fmt.Errorf("get albums of '%s' failed: %w", path, err)
+	}
+	if err := os.WriteFile(path+".xmp", photo.XMPSidecar(keywords...), 0o644); err != nil {
+		return fmt.Errorf("write xmp sidecar of '%s' failed: %w", path, err)
+	}
+	return nil
+}
+
+// linkAlbumFiles links the file and its sidecar to the paths in the other albums, so the asset in many albums is stored once
+func (r *downloadCommand) linkAlbumFiles(path string, links []string) error {
+	for _, linkPath := range links {
+		if err := mkdirAll(filepath.Dir(linkPath)); err != nil {
+			return err
+		}
+		if err := linkFile(r.AlbumLink, path, linkPath); err != nil {
+			return fmt.Errorf("link '%s' to '%s' failed: %w", path, linkPath, err)
+		}
+		if r.XMPSidecar {
+			if err := linkFile(r.AlbumLink, path+".xmp", linkPath+".xmp"); err != nil {
+				return fmt.Errorf("link '%s' to '%s' failed: %w", path+".xmp", linkPath+".xmp", err)
+			}
+		}
 	}
+	return nil
 }
 
 func (r *downloadCommand) downloadTo(pickReason string, photo *icloudgo.PhotoAsset, livePhoto bool, tmpPath, realPath, saveName string) (err error) {
@@ -406,21 +738,43 @@ func (r *downloadCommand) downloadTo(pickReason string, photo *icloudgo.PhotoAss
 			fmt.Printf("[icloudgo] [download] [%s] success %v, %v, %v/%v %.2fKB/s\n", pickReason, saveName, photo.Filename(livePhoto), photo.FormatSize(), diff, speed)
 		}
 	}()
+	// the request is retried by the client, here retry the error when reading the body,
+	// the next ResumeDownloadTo resumes from the bytes already written to tmpPath
 	retry := 5
 	for i := 0; i < retry; i++ {
-		if err := photo.DownloadTo(icloudgo.PhotoVersionOriginal, livePhoto, tmpPath); err != nil {
-			if strings.Contains(err.Error(), "i/o timeout") && i < retry-1 {
+		if err := photo.ResumeDownloadTo(icloudgo.PhotoVersionOriginal, livePhoto, tmpPath); err != nil {
+			if isBodyReadError(err) && i < retry-1 {
 				continue
 			}
 			return err
 		}
+		break
+	}
+
+	if err := verifyPhotoFile(photo, livePhoto, tmpPath); err != nil {
+		if errors.Is(err, icloudgo.ErrChecksumMismatch) {
+			// the corrupted file can not be resumed, start from zero next time
+			_ = os.Remove(tmpPath)
+		}
+		return err
+	}
+
+	if r.PatchExif && !livePhoto {
+		if _, err := photo.PatchExif(tmpPath); err != nil {
+			return fmt.Errorf("patch exif of '%s' failed: %w", tmpPath, err)
+		}
 	}
 
 	if err := os.Rename(tmpPath, realPath); err != nil {
 		return fmt.Errorf("rename '%s' to '%s' failed: %w", tmpPath, realPath, err)
 	}
 
-	return nil
+	// the file is verified before renamed, remember it
+	file, err := r.localFileState(photo, livePhoto, realPath)
+	if err != nil {
+		return err
+	}
+	return r.dalSaveVerified(realPath, file)
 }
 
 func (r *downloadCommand) autoDeletePhoto() (err error) {
@@ -429,11 +783,16 @@ func (r *downloadCommand) autoDeletePhoto() (err error) {
 			fmt.Printf("[icloudgo] [auto_delete] final err:%s\n", err.Error())
 		}
 	}()
-	if !r.AutoDelete {
+	if r.AutoDeleteMode == autoDeleteModeOff {
 		return nil
 	}
+	fmt.Printf("[icloudgo] [auto_delete] mode: %s, trash-retention: %s\n", r.AutoDeleteMode, r.TrashRetention)
 
 	for {
+		if err := r.purgeTrash(); err != nil {
+			fmt.Printf("[icloudgo] [auto_delete] purge trash err: %s\n", err)
+		}
+
 		album, err := r.photoCli.GetAlbum(icloudgo.AlbumNameRecentlyDeleted)
 		if err != nil {
 			time.Sleep(time.Minute)
@@ -443,13 +802,7 @@ func (r *downloadCommand) autoDeletePhoto() (err error) {
 		fmt.Printf("[icloudgo] [auto_delete] auto delete album total: %d\n", album.Size())
 		if err = album.WalkPhotos(0, func(offset int64, assets []*internal.PhotoAsset) error {
 			for _, photoAsset := range assets {
-				if err := r.dalDeleteAsset(photoAsset.ID()); err != nil {
-					return err
-				}
-				if err := r.removeLocalFile(photoAsset, false); err != nil {
-					return err
-				}
-				if err := r.removeLocalFile(photoAsset, true); err != nil {
+				if err := r.deleteLocalAsset(photoAsset); err != nil {
 					return err
 				}
 			}
@@ -462,8 +815,81 @@ func (r *downloadCommand) autoDeletePhoto() (err error) {
 	}
 }
 
-func (r *downloadCommand) removeLocalFile(photoAsset *internal.PhotoAsset, livePhoto bool) error {
-	path := photoAsset.LocalPath(photoAsset.OutputDir(r.Output, r.FolderStructure), icloudgo.PhotoVersionOriginal, r.FileStructure, livePhoto)
+// deleteLocalAsset removes the files of the asset deleted in icloud by the auto delete mode, and forgets it in the
+// database, the database is not changed in dry-run mode
+func (r *downloadCommand) deleteLocalAsset(photoAsset *internal.PhotoAsset) error {
+	var albums []string
+	if po, err := r.dalGetAsset(photoAsset.ID()); err != nil {
+		return err
+	} else if po != nil {
+		albums = po.Albums
+	}
+	dryRun := r.AutoDeleteMode == autoDeleteModeDryRun
+	if !dryRun {
+		if err := r.dalDeleteAsset(photoAsset.ID()); err != nil {
+			return err
+		}
+	}
+	if err := r.removeLocalFile(photoAsset, albums, false); err != nil {
+		return err
+	}
+	if err := r.removeLocalFile(photoAsset, albums, true); err != nil {
+		return err
+	}
+	if dryRun {
+		return nil
+	}
+	return r.dalReleasePaths(photoAsset.ID())
+}
+
+func (r *downloadCommand) removeLocalFile(photoAsset *internal.PhotoAsset, albums []string, livePhoto bool) error {
+	path, links, err := r.assetPaths(photoAsset, albums, livePhoto)
+	if err != nil {
+		return err
+	}
+	if r.AutoDeleteMode != autoDeleteModeDryRun {
+		for _, linkPath := range links {
+			for _, v := range []string{linkPath, linkPath + ".xmp"} {
+				if err := os.Remove(v); err != nil && !errors.Is(err, os.ErrNotExist) {
+					return err
+				}
+			}
+		}
+	}
+	return r.removeAutoDeleteFile(photoAsset, livePhoto, path)
+}
+
+// removeAutoDeleteFile removes the file of the asset and its xmp sidecar by the auto delete mode, the file is moved to
+// trash, deleted, or only reported in dry-run mode
+func (r *downloadCommand) removeAutoDeleteFile(photoAsset *internal.PhotoAsset, livePhoto bool, path string) error {
+	_, statErr := os.Stat(path)
+
+	if r.AutoDeleteMode == autoDeleteModeDryRun {
+		if statErr != nil || !r.markDryRunReported(path) {
+			return nil
+		}
+		fmt.Printf("[icloudgo] [auto_delete] [dry-run] delete %v, %v, %v, '%s'\n", photoAsset.ID(), photoAsset.Filename(livePhoto), photoAsset.FormatSize(), path)
+		return r.reportAutoDelete(photoAsset, livePhoto, path, "")
+	}
+
+	if r.AutoDeleteMode == autoDeleteModeTrash {
+		if statErr != nil {
+			return nil
+		}
+		trashPath, err := r.moveToTrash(path)
+		if err != nil {
+			return err
+		}
+		if _, err := r.moveToTrash(path + ".xmp"); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		fmt.Printf("[icloudgo] [auto_delete] trash %v, %v, %v, '%s'\n", photoAsset.ID(), photoAsset.Filename(livePhoto), photoAsset.FormatSize(), trashPath)
+		return r.reportAutoDelete(photoAsset, livePhoto, path, trashPath)
+	}
+
+	if err := os.Remove(path + ".xmp"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
 	if err := os.Remove(path); err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			return nil
@@ -471,7 +897,7 @@ func (r *downloadCommand) removeLocalFile(photoAsset *internal.PhotoAsset, liveP
 		return err
 	}
 	fmt.Printf("[icloudgo] [auto_delete] delete %v, %v, %v\n", photoAsset.ID(), photoAsset.Filename(livePhoto), photoAsset.FormatSize())
-	return nil
+	return r.reportAutoDelete(photoAsset, livePhoto, path, "")
 }
 
 func (r *downloadCommand) Close() {
@@ -485,22 +911,31 @@ func (r *downloadCommand) getUnDownloadAssets() (*assertQueue, error) {
 	if err != nil {
 		return nil, err
 	} else if len(assets) == 0 {
-		return newAssertQueue(nil), nil
+		return newAssertQueue(nil, nil), nil
 	}
 	fmt.Printf("[icloudgo] [download] found %d undownload assets\n", len(assets))
 
 	var photoAssetList []*icloudgo.PhotoAsset
+	albums := map[string][]string{}
 	for _, po := range assets {
-		photoAssetList = append(photoAssetList, r.photoCli.NewPhotoAssetFromBytes([]byte(po.Data)))
+		photoAsset := r.photoCli.NewPhotoAssetFromBytes([]byte(po.Data))
+		if !r.Filter.match(photoAsset) {
+			continue
+		}
+		photoAssetList = append(photoAssetList, photoAsset)
+		albums[photoAsset.ID()] = po.Albums
 	}
 	sort.SliceStable(photoAssetList, func(i, j int) bool {
 		return photoAssetList[i].Size() < photoAssetList[j].Size()
 	})
 
-	return newAssertQueue(photoAssetList), nil
+	return newAssertQueue(photoAssetList, albums), nil
 }
 
 type assertQueue struct {
+	// albums is the albums of the assets, key is the asset id, it is read only
+	albums map[string][]string
+
 	recentAssets []*icloudgo.PhotoAsset
 	recentIndex  int
 
@@ -510,7 +945,7 @@ type assertQueue struct {
 	lock      *sync.Mutex
 }
 
-func newAssertQueue(data []*icloudgo.PhotoAsset) *assertQueue {
+func newAssertQueue(data []*icloudgo.PhotoAsset, albums map[string][]string) *assertQueue {
 	// 2天前的时间
 	now := time.Now()
 	twoDaysAge := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).Add(-time.Hour * 24 * 2)
@@ -525,6 +960,7 @@ func newAssertQueue(data []*icloudgo.PhotoAsset) *assertQueue {
 		}
 	}
 	return &assertQueue{
+		albums:       albums,
 		recentAssets: recentAssets,
 		recentIndex:  -1,
 		oldAssets:    oldAssets,
@@ -574,3 +1010,50 @@ func (r *assertQueue) len() int {
 	defer r.lock.Unlock()
 	return (r.highIndex - 1 - r.lowIndex) + 1 + (len(r.recentAssets) - 1 - r.recentIndex)
 }
+
+// verifyPhotoFile returns ErrChecksumMismatch if the size of the file is wrong, the unverified fingerprint is not an error
+func verifyPhotoFile(photo *icloudgo.PhotoAsset, livePhoto bool, path string) error {
+	err := photo.VerifyFile(icloudgo.PhotoVersionOriginal, livePhoto, path)
+	if errors.Is(err, icloudgo.ErrChecksumUnsupported) {
+		return nil
+	}
+	return err
+}
+
+// verifyLocalFile is verifyPhotoFile with the result cached in the db, the file unchanged since the last verification is
+// not hashed again, unless force is true
+func (r *downloadCommand) verifyLocalFile(photo *icloudgo.PhotoAsset, livePhoto bool, path string, force bool) error {
+	file, err := r.localFileState(photo, livePhoto, path)
+	if err != nil {
+		return err
+	}
+	if !force && r.dalIsVerified(path, file) {
+		return nil
+	}
+	if err := verifyPhotoFile(photo, livePhoto, path); err != nil {
+		if errors.Is(err, icloudgo.ErrChecksumMismatch) {
+			_ = r.dalDeleteVerified(path)
+		}
+		return err
+	}
+	return r.dalSaveVerified(path, file)
+}
+
+func (r *downloadCommand) localFileState(photo *icloudgo.PhotoAsset, livePhoto bool, path string) (verifiedFile, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return verifiedFile{}, err
+	}
+	return verifiedFile{
+		Size:        stat.Size(),
+		ModTime:     stat.ModTime().UnixNano(),
+		Fingerprint: photo.Fingerprint(icloudgo.PhotoVersionOriginal, livePhoto),
+	}, nil
+}
+
+func isBodyReadError(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "i/o timeout") ||
+		strings.Contains(msg, "unexpected EOF") ||
+		strings.Contains(msg, "connection reset by peer")
+}
@@ -0,0 +1,228 @@
+package command
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+
+	"github.com/chyroc/icloudgo"
+	"github.com/chyroc/icloudgo/icloudtest"
+)
+
+func newTestDownloadCommand(t *testing.T, server *icloudtest.Server) *downloadCommand {
+	t.Helper()
+
+	cli, err := icloudgo.New(server.ClientOption(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.Authenticate(false, nil); err != nil {
+		t.Fatal(err)
+	}
+	photoCli, err := cli.PhotoCli()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := badger.Open(badger.DefaultOptions(t.TempDir()).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		cli.Close()
+	})
+
+	return &downloadCommand{
+		Output:          t.TempDir(),
+		AlbumNames:      []string{icloudgo.AlbumNameAll},
+		AlbumLink:       "hardlink",
+		ThreadNum:       1,
+		AutoDeleteMode:  autoDeleteModeOff,
+		WithLivePhoto:   true,
+		FolderStructure: "/",
+		FileStructure:   "id",
+		client:          cli,
+		photoCli:        photoCli,
+		db:              db,
+		lock:            &sync.Mutex{},
+		exit:            make(chan struct{}),
+		startDownload:   make(chan struct{}),
+	}
+}
+
+// saveTestMeta saves the metadata of all photos
+func saveTestMeta(t *testing.T, cmd *downloadCommand) {
+	t.Helper()
+
+	album, err := cmd.photoCli.GetAlbum(icloudgo.AlbumNameAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.saveAlbumMeta(album); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// syncTestDownload saves the metadata of all photos, and downloads them
+func syncTestDownload(t *testing.T, cmd *downloadCommand) {
+	t.Helper()
+
+	saveTestMeta(t, cmd)
+	if err := os.MkdirAll(cmd.Output+"/.tmp", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.downloadFromDatabase(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testAssetStatus(t *testing.T, cmd *downloadCommand, id string) int {
+	t.Helper()
+
+	po, err := cmd.dalGetAsset(id)
+	if err != nil {
+		t.Fatal(err)
+	} else if po == nil {
+		return -1
+	}
+	return po.Status
+}
+
+func TestDownloadChanges(t *testing.T) {
+	server := icloudtest.NewServer()
+	defer server.Close()
+	date := time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)
+	kept := server.AddPhoto("kept.jpg", []byte("kept"), date)
+	expunged := server.AddPhoto("expunged.jpg", []byte("expunged"), date)
+	deleted := server.AddPhoto("deleted.jpg", []byte("deleted"), date)
+
+	cmd := newTestDownloadCommand(t, server)
+	cmd.AutoDeleteMode = autoDeleteModeDelete
+	syncTestDownload(t, cmd)
+	for _, id := range []string{kept.ID, expunged.ID, deleted.ID} {
+		if status := testAssetStatus(t, cmd, id); status != 1 {
+			t.Fatalf("status of %s: %d, expect 1", id, status)
+		}
+	}
+	if cmd.dalGetSyncToken() == "" {
+		t.Fatal("sync token is not saved")
+	}
+
+	assets := map[string]*icloudgo.PhotoAsset{}
+	pos, err := cmd.dalGetUnDownloadAssets(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, po := range pos {
+		assets[po.ID] = cmd.photoCli.NewPhotoAssetFromBytes([]byte(po.Data))
+	}
+	if err := assets[kept.ID].SetFavorite(true); err != nil {
+		t.Fatal(err)
+	}
+	server.ExpungePhoto(expunged.ID)
+	server.DeletePhoto(deleted.ID)
+	saveTestMeta(t, cmd)
+
+	// the metadata change does not download the file again
+	if status := testAssetStatus(t, cmd, kept.ID); status != 1 {
+		t.Fatalf("status of the modified asset: %d, expect 1", status)
+	}
+	// the expunged asset is removed by the auto delete mode
+	if status := testAssetStatus(t, cmd, expunged.ID); status != -1 {
+		t.Fatalf("status of the expunged asset: %d, expect removed", status)
+	}
+	path, _, err := cmd.assetPaths(assets[expunged.ID], nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("file of the expunged asset is not removed: %v", err)
+	}
+	// the asset in recently deleted is kept with its albums for autoDeletePhoto
+	if po, err := cmd.dalGetAsset(deleted.ID); err != nil {
+		t.Fatal(err)
+	} else if po == nil || len(po.Albums) == 0 {
+		t.Fatalf("deleted asset is forgotten before its files are handled: %+v", po)
+	}
+}
+
+func TestDownloadExpiredSession(t *testing.T) {
+	server := icloudtest.NewServer()
+	defer server.Close()
+	a := server.AddPhoto("a.jpg", []byte("a"), time.Now())
+
+	// the download re-authenticates the expired session, and retries the failed requests
+	cmd := newTestDownloadCommand(t, server)
+	server.ExpireSession()
+	server.FailRequests(http.StatusServiceUnavailable, 1, 0)
+	syncTestDownload(t, cmd)
+	if status := testAssetStatus(t, cmd, a.ID); status != 1 {
+		t.Fatalf("status: %d, expect 1", status)
+	}
+}
+
+func TestDownloadManyAlbums(t *testing.T) {
+	server := icloudtest.NewServer()
+	defer server.Close()
+	a := server.AddPhoto("a.jpg", []byte("a"), time.Now())
+	b := server.AddPhoto("b.jpg", []byte("b"), time.Now())
+	server.AddAlbum("Trip", a.ID)
+	server.AddAlbum("Work", a.ID, b.ID)
+
+	cmd := newTestDownloadCommand(t, server)
+	cmd.AlbumNames = []string{"Trip", "Work"}
+	albums, err := cmd.getAlbums()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, album := range albums {
+		if err := cmd.saveAlbumMeta(album); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(cmd.Output+"/.tmp", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.downloadFromDatabase(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the asset in both albums is stored once, and linked in the dirs of the albums
+	po, err := cmd.dalGetAsset(a.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if po.Status != 1 || !reflect.DeepEqual(po.Albums, []string{"Trip", "Work"}) {
+		t.Fatalf("status: %d, albums: %v", po.Status, po.Albums)
+	}
+	for id, albums := range map[string][]string{a.ID: {"Trip", "Work"}, b.ID: {"Work"}} {
+		photo := cmd.photoCli.NewPhotoAssetFromBytes(mustAssetData(t, cmd, id))
+		path, links, err := cmd.assetPaths(photo, albums, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(links) != len(albums) {
+			t.Fatalf("links of %s: %v, expect %d", id, links, len(albums))
+		}
+		stat, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, link := range links {
+			if filepath.Base(filepath.Dir(link)) != albums[i] {
+				t.Fatalf("link %s is not in the dir of %s", link, albums[i])
+			}
+			if linkStat, err := os.Stat(link); err != nil {
+				t.Fatal(err)
+			} else if !os.SameFile(stat, linkStat) {
+				t.Fatalf("%s is not linked to %s", link, path)
+			}
+		}
+	}
+}
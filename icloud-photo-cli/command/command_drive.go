@@ -0,0 +1,463 @@
+package command
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/chyroc/icloudgo"
+	"github.com/chyroc/icloudgo/internal"
+)
+
+func NewDriveFlag() []cli.Flag {
+	var res []cli.Flag
+	res = append(res, commonFlag...)
+	res = append(res,
+		&cli.BoolFlag{
+			Name:     "json",
+			Usage:    "print the result as json, for scripting",
+			Required: false,
+			Value:    false,
+			EnvVars:  []string{"ICLOUD_JSON"},
+		},
+	)
+	return res
+}
+
+func NewDriveMirrorFlag() []cli.Flag {
+	return append(NewDriveFlag(),
+		&cli.BoolFlag{
+			Name:     "delete",
+			Usage:    "delete the local files and dirs which are not in the remote folder",
+			Required: false,
+			Value:    false,
+			EnvVars:  []string{"ICLOUD_DELETE"},
+		},
+	)
+}
+
+// NewDriveCommands returns the sub commands of the drive command, the paths of iCloud Drive start from the root, e.g.
+// /Documents/tax/2024.pdf
+func NewDriveCommands() []*cli.Command {
+	return []*cli.Command{
+		{
+			Name:      "ls",
+			Usage:     "list the items in the folder, or the file",
+			ArgsUsage: "[path, default is /]",
+			Flags:     NewDriveFlag(),
+			Action:    DriveLs,
+		},
+		{
+			Name:      "mkdir",
+			Usage:     "create the folder and the missing parent folders",
+			ArgsUsage: "<path>",
+			Flags:     NewDriveFlag(),
+			Action:    DriveMkdir,
+		},
+		{
+			Name:      "get",
+			Usage:     "download the file, the local path is the file name in the current dir if not set",
+			ArgsUsage: "<path> [local path]",
+			Flags:     NewDriveFlag(),
+			Action:    DriveGet,
+		},
+		{
+			Name:      "put",
+			Usage:     "upload the local file to the folder",
+			ArgsUsage: "<local path> [folder path, default is /]",
+			Flags:     NewDriveFlag(),
+			Action:    DrivePut,
+		},
+		{
+			Name:      "rm",
+			Usage:     "move the files and the folders to the trash",
+			ArgsUsage: "<path> [path...]",
+			Flags:     NewDriveFlag(),
+			Action:    DriveRm,
+		},
+		{
+			Name:      "mirror",
+			Usage:     "download the remote folder to the local dir, the files with the same size and modified time are skipped",
+			ArgsUsage: "<remote folder path> <local dir>",
+			Flags:     NewDriveMirrorFlag(),
+			Action:    DriveMirror,
+		},
+	}
+}
+
+type driveCommand struct {
+	JSON bool
+
+	client   *icloudgo.Client
+	driveCli *icloudgo.DriveService
+}
+
+func newDriveCommand(c *cli.Context) (*driveCommand, error) {
+	cli, err := icloudgo.New(&icloudgo.ClientOption{
+		AppID:           c.String("username"),
+		Password:        c.String("password"),
+		CookieDir:       c.String("cookie-dir"),
+		TwoFACodeGetter: &internal.StdinTextGetter{Tip: "2fa code"},
+		Domain:          c.String("domain"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := cli.Authenticate(false, nil); err != nil {
+		cli.Close()
+		return nil, err
+	}
+	driveCli, err := cli.DriveCli()
+	if err != nil {
+		cli.Close()
+		return nil, err
+	}
+
+	return &driveCommand{
+		JSON:     c.Bool("json"),
+		client:   cli,
+		driveCli: driveCli,
+	}, nil
+}
+
+// runDriveCommand authenticates, and runs f with the command, the number of the args is checked first
+func runDriveCommand(c *cli.Context, minArgs, maxArgs int, f func(cmd *driveCommand, args []string) error) error {
+	args := c.Args().Slice()
+	if len(args) < minArgs || len(args) > maxArgs {
+		return fmt.Errorf("expect %d to %d args, but got %d, usage: %s %s", minArgs, maxArgs, len(args), c.Command.HelpName, c.Command.ArgsUsage)
+	}
+	cmd, err := newDriveCommand(c)
+	if err != nil {
+		return err
+	}
+	defer cmd.client.Close()
+
+	return f(cmd, args)
+}
+
+func DriveLs(c *cli.Context) error {
+	return runDriveCommand(c, 0, 1, func(cmd *driveCommand, args []string) error {
+		name := "/"
+		if len(args) > 0 {
+			name = args[0]
+		}
+		return cmd.ls(name)
+	})
+}
+
+func DriveMkdir(c *cli.Context) error {
+	return runDriveCommand(c, 1, 1, func(cmd *driveCommand, args []string) error {
+		return cmd.mkdir(args[0])
+	})
+}
+
+func DriveGet(c *cli.Context) error {
+	return runDriveCommand(c, 1, 2, func(cmd *driveCommand, args []string) error {
+		local := ""
+		if len(args) > 1 {
+			local = args[1]
+		}
+		return cmd.get(args[0], local)
+	})
+}
+
+func DrivePut(c *cli.Context) error {
+	return runDriveCommand(c, 1, 2, func(cmd *driveCommand, args []string) error {
+		folder := "/"
+		if len(args) > 1 {
+			folder = args[1]
+		}
+		return cmd.put(args[0], folder)
+	})
+}
+
+func DriveRm(c *cli.Context) error {
+	if c.NArg() == 0 {
+		return fmt.Errorf("expect at least 1 arg, but got 0, usage: %s %s", c.Command.HelpName, c.Command.ArgsUsage)
+	}
+	return runDriveCommand(c, 1, c.NArg(), func(cmd *driveCommand, args []string) error {
+		return cmd.rm(args)
+	})
+}
+
+func DriveMirror(c *cli.Context) error {
+	return runDriveCommand(c, 2, 2, func(cmd *driveCommand, args []string) error {
+		return cmd.mirror(args[0], args[1], c.Bool("delete"))
+	})
+}
+
+// driveItemOutput is the item printed by --json
+type driveItemOutput struct {
+	Path         string     `json:"path"`
+	Name         string     `json:"name"`
+	Type         string     `json:"type"`
+	Size         int        `json:"size"`
+	DateModified *time.Time `json:"date_modified,omitempty"`
+	Drivewsid    string     `json:"drivewsid"`
+	Etag         string     `json:"etag"`
+	Local        string     `json:"local,omitempty"`  // the local path of get, put and mirror
+	Action       string     `json:"action,omitempty"` // the action of mirror: downloaded or skipped
+}
+
+func newDriveItemOutput(name string, item *icloudgo.DriveFolder) *driveItemOutput {
+	res := &driveItemOutput{
+		Path:      internal.CleanDrivePath(name),
+		Name:      item.FullName(),
+		Type:      item.Type,
+		Size:      item.Size,
+		Drivewsid: item.Drivewsid,
+		Etag:      item.Etag,
+	}
+	if !item.DateModified.IsZero() {
+		res.DateModified = &item.DateModified
+	}
+	return res
+}
+
+// print prints the items as json, or one line per item
+func (r *driveCommand) print(outputs ...*driveItemOutput) error {
+	if r.JSON {
+		bs, err := json.MarshalIndent(outputs, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(bs))
+		return nil
+	}
+	for _, v := range outputs {
+		date := "-"
+		if v.DateModified != nil {
+			date = v.DateModified.Local().Format("2006-01-02 15:04:05")
+		}
+		line := fmt.Sprintf("%-8s %12d  %-19s  %s", v.Type, v.Size, date, v.Path)
+		if v.Action != "" {
+			line = v.Action + "  " + line
+		}
+		if v.Local != "" {
+			line += " -> " + v.Local
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
+
+func (r *driveCommand) ls(name string) error {
+	item, err := r.driveCli.Stat(name)
+	if err != nil {
+		return err
+	}
+	if item.IsFile() {
+		return r.print(newDriveItemOutput(name, item))
+	}
+
+	items, err := r.driveCli.ReadDir(name)
+	if err != nil {
+		return err
+	}
+	outputs := []*driveItemOutput{}
+	for _, item := range items {
+		outputs = append(outputs, newDriveItemOutput(path.Join(internal.CleanDrivePath(name), item.FullName()), item))
+	}
+	return r.print(outputs...)
+}
+
+func (r *driveCommand) mkdir(name string) error {
+	name = internal.CleanDrivePath(name)
+	if name == "/" {
+		return fmt.Errorf("mkdir /: the root exists")
+	}
+
+	parent, err := r.driveCli.Stat("/")
+	if err != nil {
+		return err
+	}
+	current := "/"
+	for _, segment := range strings.Split(strings.TrimPrefix(name, "/"), "/") {
+		current = path.Join(current, segment)
+		item, err := r.driveCli.Stat(current)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		if item == nil {
+			if item, err = r.driveCli.CreateFolder(parent.Drivewsid, segment); err != nil {
+				return err
+			}
+		} else if item.IsFile() {
+			return fmt.Errorf("mkdir %s: %s is a file", name, current)
+		}
+		parent = item
+	}
+	return r.print(newDriveItemOutput(name, parent))
+}
+
+func (r *driveCommand) get(name, local string) error {
+	item, err := r.driveCli.Stat(name)
+	if err != nil {
+		return err
+	}
+	if !item.IsFile() {
+		return fmt.Errorf("get %s: it is a folder, use mirror to download the folder", name)
+	}
+
+	if local == "" {
+		local = item.FullName()
+	} else if f, _ := os.Stat(local); f != nil && f.IsDir() {
+		local = filepath.Join(local, item.FullName())
+	}
+	if err := r.driveCli.Download(item, local); err != nil {
+		return err
+	}
+
+	output := newDriveItemOutput(name, item)
+	output.Local = local
+	return r.print(output)
+}
+
+func (r *driveCommand) put(local, folderName string) error {
+	folder, err := r.driveCli.Stat(folderName)
+	if err != nil {
+		return err
+	}
+	if folder.IsFile() {
+		return fmt.Errorf("put %s: %s is a file", local, folderName)
+	}
+
+	f, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if stat, err := f.Stat(); err != nil {
+		return err
+	} else if stat.IsDir() {
+		return fmt.Errorf("put %s: it is a dir, only the file can be uploaded", local)
+	}
+
+	item, err := r.driveCli.Upload(folder.Drivewsid, filepath.Base(local), f)
+	if err != nil {
+		return err
+	}
+
+	output := newDriveItemOutput(path.Join(internal.CleanDrivePath(folderName), item.FullName()), item)
+	output.Local = local
+	return r.print(output)
+}
+
+func (r *driveCommand) rm(names []string) error {
+	var outputs []*driveItemOutput
+	for _, name := range names {
+		if internal.CleanDrivePath(name) == "/" {
+			return fmt.Errorf("rm /: the root can not be removed")
+		}
+		item, err := r.driveCli.Stat(name)
+		if err != nil {
+			return err
+		}
+		if item, err = r.driveCli.MoveToTrash(item); err != nil {
+			return err
+		}
+		outputs = append(outputs, newDriveItemOutput(name, item))
+	}
+	return r.print(outputs...)
+}
+
+const (
+	driveMirrorDownloaded = "downloaded"
+	driveMirrorSkipped    = "skipped"
+	driveMirrorDeleted    = "deleted"
+)
+
+// mirror downloads the remote folder to the local dir, the local files which are not in the remote folder are deleted
+// if deleteLocal is true, the json output is {"items": [...], "deleted": [local paths]}
+func (r *driveCommand) mirror(remote, local string, deleteLocal bool) error {
+	remote = internal.CleanDrivePath(remote)
+	// the walked local paths are compared with the joined targets, e.g. out/ must be out, or the whole dir is deleted
+	local = filepath.Clean(local)
+	if folder, err := r.driveCli.Stat(remote); err != nil {
+		return err
+	} else if folder.IsFile() {
+		return fmt.Errorf("mirror %s: it is a file, use get to download the file", remote)
+	}
+	if err := mkdirAll(local); err != nil {
+		return err
+	}
+
+	outputs, deleted := []*driveItemOutput{}, []string{}
+	seen := map[string]bool{}
+	err := r.driveCli.Walk(remote, func(name string, item *icloudgo.DriveFolder, err error) error {
+		if err != nil {
+			return err
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(name, remote), "/")
+		target := filepath.Join(local, filepath.FromSlash(rel))
+		seen[target] = true
+		if !item.IsFile() {
+			if name == remote {
+				return nil
+			}
+			return mkdirAll(target)
+		}
+
+		output := newDriveItemOutput(name, item)
+		output.Local = target
+		output.Action = driveMirrorSkipped
+		if f, _ := os.Stat(target); f == nil || f.Size() != int64(item.Size) || !f.ModTime().Equal(item.DateModified) {
+			if err := r.driveCli.Download(item, target); err != nil {
+				return err
+			}
+			output.Action = driveMirrorDownloaded
+		}
+		outputs = append(outputs, output)
+		if !r.JSON {
+			return r.print(output)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if deleteLocal {
+		err = filepath.WalkDir(local, func(target string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if seen[target] || target == local {
+				return nil
+			}
+			if err := os.RemoveAll(target); err != nil {
+				return err
+			}
+			deleted = append(deleted, target)
+			if !r.JSON {
+				fmt.Printf("%s  %s\n", driveMirrorDeleted, target)
+			}
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if r.JSON {
+		bs, err := json.MarshalIndent(map[string]any{"items": outputs, "deleted": deleted}, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(bs))
+		return nil
+	}
+	fmt.Printf("[icloudgo] [drive] mirror %s to %s finished\n", remote, local)
+	return nil
+}
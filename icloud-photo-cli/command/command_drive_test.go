@@ -0,0 +1,66 @@
+package command
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chyroc/icloudgo"
+	"github.com/chyroc/icloudgo/icloudtest"
+)
+
+func newTestDriveCommand(t *testing.T, server *icloudtest.Server) *driveCommand {
+	t.Helper()
+
+	cli, err := icloudgo.New(server.ClientOption(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cli.Close() })
+	if err := cli.Authenticate(false, nil); err != nil {
+		t.Fatal(err)
+	}
+	driveCli, err := cli.DriveCli()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &driveCommand{client: cli, driveCli: driveCli}
+}
+
+func TestDriveMirrorDelete(t *testing.T) {
+	server := icloudtest.NewServer()
+	defer server.Close()
+	docs := server.AddDriveFolder("Documents", icloudtest.DriveRootID)
+	tax := server.AddDriveFolder("tax", docs.ID)
+	server.AddDriveFile("a.txt", docs.ID, []byte("a"))
+	server.AddDriveFile("2024.pdf", tax.ID, []byte("pdf"))
+	cmd := newTestDriveCommand(t, server)
+
+	dir := t.TempDir()
+	for path, data := range map[string]string{"stale.txt": "stale", "old/b.txt": "b"} {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the local dir with the trailing slash is not deleted as a stale item
+	if err := cmd.mirror("/Documents", dir+string(filepath.Separator), true); err != nil {
+		t.Fatal(err)
+	}
+	for path, data := range map[string]string{"a.txt": "a", "tax/2024.pdf": "pdf"} {
+		if bs, err := os.ReadFile(filepath.Join(dir, path)); err != nil {
+			t.Fatal(err)
+		} else if string(bs) != data {
+			t.Fatalf("content of %s: %q, expect %q", path, bs, data)
+		}
+	}
+	for _, path := range []string{"stale.txt", "old"} {
+		if _, err := os.Stat(filepath.Join(dir, path)); !os.IsNotExist(err) {
+			t.Fatalf("stale %s is not deleted: %v", path, err)
+		}
+	}
+}
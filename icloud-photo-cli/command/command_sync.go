@@ -0,0 +1,392 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/chyroc/icloudgo"
+	"github.com/chyroc/icloudgo/internal"
+)
+
+func NewSyncFlag() []cli.Flag {
+	skip := map[string]bool{"album": true, "all-albums": true, "album-link": true, "stop-found-num": true}
+	for _, flag := range filterFlag {
+		skip[flag.Names()[0]] = true
+	}
+
+	var res []cli.Flag
+	for _, flag := range NewDownloadFlag() {
+		if skip[flag.Names()[0]] {
+			continue
+		}
+		res = append(res, flag)
+	}
+	for _, flag := range NewUploadFlag() {
+		if flag.Names()[0] == "ext" {
+			res = append(res, flag)
+		}
+	}
+	res = append(res,
+		&cli.BoolFlag{
+			Name:     "delete-remote",
+			Usage:    "move the photos deleted from local to the icloud recently deleted folder, if not set, the deleted photos are downloaded again",
+			Required: false,
+			Value:    false,
+			EnvVars:  []string{"ICLOUD_DELETE_REMOTE"},
+		},
+		&cli.BoolFlag{
+			Name:     "dry-run",
+			Usage:    "print the plan, but do not upload, download or delete anything",
+			Required: false,
+			Value:    false,
+			EnvVars:  []string{"ICLOUD_DRY_RUN"},
+		},
+	)
+	return res
+}
+
+func Sync(c *cli.Context) error {
+	cmd, err := newSyncCommand(c)
+	if err != nil {
+		return err
+	}
+	defer cmd.client.Close()
+	defer cmd.Close()
+
+	return cmd.sync()
+}
+
+// syncCommand syncs the output dir and all photos of icloud in both directions, the database records the downloaded
+// assets and the uploaded files, so the changes of both sides since the last run are found.
+type syncCommand struct {
+	*downloadCommand
+	DeleteRemote bool
+	DryRun       bool
+
+	uploader *uploadCommand
+}
+
+func newSyncCommand(c *cli.Context) (*syncCommand, error) {
+	cmd, err := newDownloadCommand(c)
+	if err != nil {
+		return nil, err
+	}
+	// the local files are compared by the absolute path
+	if cmd.Output, err = filepath.Abs(cmd.Output); err != nil {
+		return nil, err
+	}
+	// the uploaded files are shared with the upload command
+	uploadDB, err := openUploadDB(cmd.client, cmd.db)
+	if err != nil {
+		cmd.Close()
+		return nil, err
+	}
+	uploader := &uploadCommand{
+		Dir:       cmd.Output,
+		Exts:      map[string]bool{},
+		ThreadNum: cmd.ThreadNum,
+		client:    cmd.client,
+		photoCli:  cmd.photoCli,
+		option:    &icloudgo.PhotoUploadOption{FindDuplicate: true},
+		db:        uploadDB,
+		lock:      &sync.Mutex{},
+	}
+	exts := defaultUploadExts
+	if len(c.StringSlice("ext")) > 0 {
+		exts = nil
+		for _, v := range c.StringSlice("ext") {
+			exts = append(exts, strings.Split(v, ",")...)
+		}
+	}
+	for _, ext := range exts {
+		if ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), ".")); ext != "" {
+			uploader.Exts[ext] = true
+		}
+	}
+
+	return &syncCommand{
+		downloadCommand: cmd,
+		DeleteRemote:    c.Bool("delete-remote"),
+		DryRun:          c.Bool("dry-run"),
+		uploader:        uploader,
+	}, nil
+}
+
+// syncPlan is the changes to apply in one sync
+type syncPlan struct {
+	Upload             []string               // new local files
+	Download           []*icloudgo.PhotoAsset // new remote assets, or the downloaded assets deleted from local without delete-remote
+	DeleteRemote       []*icloudgo.PhotoAsset // the assets whose files are deleted from local
+	DeleteLocal        []*icloudgo.PhotoAsset // the downloaded assets in the recently deleted folder
+	DeleteLocalUploads []*UploadFileModel     // the uploaded files whose assets are in the recently deleted folder
+	deletedUploads     map[string][]*UploadFileModel
+	uploadAssets       map[string]*icloudgo.PhotoAsset // the deleted assets of DeleteLocalUploads
+}
+
+func (r *syncCommand) sync() error {
+	plan, err := r.plan()
+	if err != nil {
+		return err
+	}
+
+	prefix := "[icloudgo] [sync]"
+	if r.DryRun {
+		prefix += " [dry-run]"
+	}
+	for _, path := range plan.Upload {
+		fmt.Printf("%s upload '%s'\n", prefix, path)
+	}
+	for _, photo := range plan.Download {
+		fmt.Printf("%s download %s, %s\n", prefix, photo.ID(), photo.Filename(false))
+	}
+	for _, photo := range plan.DeleteRemote {
+		fmt.Printf("%s delete remote %s, %s\n", prefix, photo.ID(), photo.Filename(false))
+	}
+	for _, photo := range plan.DeleteLocal {
+		fmt.Printf("%s delete local %s, %s\n", prefix, photo.ID(), photo.Filename(false))
+	}
+	for _, po := range plan.DeleteLocalUploads {
+		fmt.Printf("%s delete local '%s'\n", prefix, po.Path)
+	}
+	fmt.Printf("%s plan, upload: %d, download: %d, delete remote: %d, delete local: %d\n", prefix, len(plan.Upload), len(plan.Download), len(plan.DeleteRemote), len(plan.DeleteLocal)+len(plan.DeleteLocalUploads))
+	if r.DryRun {
+		return nil
+	}
+
+	if err := r.applyDeleteLocal(plan); err != nil {
+		return err
+	}
+	if err := r.applyDeleteRemote(plan); err != nil {
+		return err
+	}
+	if len(plan.Upload) > 0 {
+		if err := r.uploader.uploadFiles(plan.Upload); err != nil {
+			return err
+		}
+	}
+	if len(plan.Download) > 0 {
+		if err := mkdirAll(filepath.Join(r.Output, ".tmp")); err != nil {
+			return err
+		}
+		if err := r.dalAddAssets(icloudgo.AlbumNameAll, plan.Download); err != nil {
+			return err
+		}
+		// the downloaded assets deleted from local are downloaded again
+		for _, photo := range plan.Download {
+			if err := r.dalSetUnDownloaded(photo.ID()); err != nil {
+				return err
+			}
+		}
+		if err := r.downloadFromDatabase(); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("%s finished\n", prefix)
+	return nil
+}
+
+func (r *syncCommand) Close() {
+	r.uploader.Close()
+	r.downloadCommand.Close()
+}
+
+// plan compares the local files, the remote assets and the database, it only reads them.
+//
+// The files uploaded as duplicate share the asset with the other uploaded or downloaded files, the asset is deleted
+// from remote only if all its files are deleted from local.
+func (r *syncCommand) plan() (*syncPlan, error) {
+	plan := &syncPlan{deletedUploads: map[string][]*UploadFileModel{}, uploadAssets: map[string]*icloudgo.PhotoAsset{}}
+
+	remoteAssets, err := r.walkAlbum(icloudgo.AlbumNameAll)
+	if err != nil {
+		return nil, err
+	}
+	var deletedAssets []*icloudgo.PhotoAsset
+	if r.AutoDeleteMode != autoDeleteModeOff {
+		if deletedAssets, err = r.walkAlbum(icloudgo.AlbumNameRecentlyDeleted); err != nil {
+			return nil, err
+		}
+	}
+
+	downloaded := map[string]*PhotoAssetModel{}
+	pos, err := r.dalGetUnDownloadAssets(nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, po := range pos {
+		downloaded[po.ID] = po
+	}
+	uploads, err := r.uploader.dalGetUploadFiles()
+	if err != nil {
+		return nil, err
+	}
+	uploaded := map[string][]*UploadFileModel{}
+	for _, po := range uploads {
+		if po.AssetID != "" {
+			uploaded[po.AssetID] = append(uploaded[po.AssetID], po)
+		}
+	}
+
+	// the files of the downloaded and uploaded assets are known, the others are new
+	knownPaths := map[string]bool{}
+	for _, po := range uploads {
+		knownPaths[po.Path] = true
+	}
+	for _, po := range pos {
+		if po.Status != 1 {
+			continue
+		}
+		paths, err := r.localPaths(r.photoCli.NewPhotoAssetFromBytes([]byte(po.Data)), po.Albums)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			knownPaths[path] = true
+		}
+	}
+	files, err := r.uploader.getFiles()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	albumsDir := filepath.Join(r.Output, "Albums") + string(filepath.Separator)
+	for _, file := range files {
+		if !knownPaths[file] && !strings.HasPrefix(file, albumsDir) {
+			plan.Upload = append(plan.Upload, file)
+		}
+	}
+
+	for _, photo := range remoteAssets {
+		ups := uploaded[photo.ID()]
+		po := downloaded[photo.ID()]
+		if len(ups) == 0 && (po == nil || po.Status != 1) {
+			plan.Download = append(plan.Download, photo)
+			continue
+		}
+
+		exist := false
+		for _, up := range ups {
+			if _, err := os.Stat(up.Path); !errors.Is(err, os.ErrNotExist) {
+				exist = true
+			}
+		}
+		if po != nil && po.Status == 1 {
+			path, _, err := r.assetPaths(photo, po.Albums, false)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+				exist = true
+			}
+		}
+		if exist {
+			continue
+		}
+		if r.DeleteRemote {
+			plan.DeleteRemote = append(plan.DeleteRemote, photo)
+			plan.deletedUploads[photo.ID()] = ups
+		} else if len(ups) == 0 {
+			// the uploaded files deleted from local are not downloaded again
+			plan.Download = append(plan.Download, photo)
+		}
+	}
+
+	for _, photo := range deletedAssets {
+		if ups := uploaded[photo.ID()]; len(ups) > 0 {
+			plan.DeleteLocalUploads = append(plan.DeleteLocalUploads, ups...)
+			plan.uploadAssets[photo.ID()] = photo
+		}
+		if downloaded[photo.ID()] != nil {
+			plan.DeleteLocal = append(plan.DeleteLocal, photo)
+		}
+	}
+	return plan, nil
+}
+
+func (r *syncCommand) applyDeleteLocal(plan *syncPlan) error {
+	for _, photo := range plan.DeleteLocal {
+		if err := r.deleteLocalAsset(photo); err != nil {
+			return err
+		}
+	}
+	// the uploaded files are the originals of the user, they are trashed or reported by the auto delete mode as well
+	for _, po := range plan.DeleteLocalUploads {
+		if err := r.removeAutoDeleteFile(plan.uploadAssets[po.AssetID], false, po.Path); err != nil {
+			return err
+		}
+		if r.AutoDeleteMode == autoDeleteModeDryRun {
+			continue
+		}
+		if err := r.uploader.dalDeleteUploadFile(po); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *syncCommand) applyDeleteRemote(plan *syncPlan) error {
+	if len(plan.DeleteRemote) == 0 {
+		return nil
+	}
+	results, err := r.photoCli.DeleteAssets(plan.DeleteRemote)
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Printf("[icloudgo] [sync] delete remote %s failed: %s\n", result.Asset.ID(), result.Err)
+			continue
+		}
+		for _, po := range plan.deletedUploads[result.Asset.ID()] {
+			if err := r.uploader.dalDeleteUploadFile(po); err != nil {
+				return err
+			}
+		}
+		if po, err := r.dalGetAsset(result.Asset.ID()); err != nil {
+			return err
+		} else if po == nil {
+			continue
+		}
+		if err := r.deleteLocalAsset(result.Asset); err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+func (r *syncCommand) walkAlbum(name string) ([]*icloudgo.PhotoAsset, error) {
+	album, err := r.photoCli.GetAlbum(name)
+	if err != nil {
+		return nil, err
+	}
+	var res []*icloudgo.PhotoAsset
+	err = album.WalkPhotos(0, func(offset int64, assets []*internal.PhotoAsset) error {
+		res = append(res, assets...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walk %s err: %w", name, err)
+	}
+	return res, nil
+}
+
+// localPaths returns the paths of the downloaded files and their links
+func (r *syncCommand) localPaths(photo *icloudgo.PhotoAsset, albums []string) ([]string, error) {
+	livePhotos := []bool{false}
+	if r.WithLivePhoto && photo.IsLivePhoto() {
+		livePhotos = append(livePhotos, true)
+	}
+
+	var res []string
+	for _, livePhoto := range livePhotos {
+		path, links, err := r.assetPaths(photo, albums, livePhoto)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, path)
+		res = append(res, links...)
+	}
+	return res, nil
+}
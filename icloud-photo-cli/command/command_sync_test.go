@@ -0,0 +1,139 @@
+package command
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chyroc/icloudgo"
+	"github.com/chyroc/icloudgo/icloudtest"
+)
+
+func newTestSyncCommand(t *testing.T, server *icloudtest.Server) *syncCommand {
+	t.Helper()
+
+	cmd := newTestDownloadCommand(t, server)
+	return &syncCommand{
+		downloadCommand: cmd,
+		DeleteRemote:    true,
+		uploader: &uploadCommand{
+			Dir:       cmd.Output,
+			Exts:      map[string]bool{"jpg": true},
+			ThreadNum: 1,
+			client:    cmd.client,
+			photoCli:  cmd.photoCli,
+			option:    &icloudgo.PhotoUploadOption{FindDuplicate: true},
+			db:        cmd.db,
+			lock:      cmd.lock,
+		},
+	}
+}
+
+func TestSyncDuplicateUpload(t *testing.T) {
+	server := icloudtest.NewServer()
+	defer server.Close()
+	a := server.AddPhoto("a.jpg", []byte("a"), time.Now())
+
+	cmd := newTestSyncCommand(t, server)
+	syncTestDownload(t, cmd.downloadCommand)
+
+	// the copy of the downloaded file is uploaded as duplicate of the same asset
+	copyPath := filepath.Join(cmd.Output, "copy.jpg")
+	if err := os.WriteFile(copyPath, []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.sync(); err != nil {
+		t.Fatal(err)
+	}
+	if po, err := cmd.uploader.dalGetUploadFile(copyPath); err != nil {
+		t.Fatal(err)
+	} else if po == nil || po.AssetID != a.ID {
+		t.Fatalf("upload file: %+v, expect asset %s", po, a.ID)
+	}
+
+	// the downloaded file still exists, the asset is not deleted with the copy
+	if err := os.Remove(copyPath); err != nil {
+		t.Fatal(err)
+	}
+	plan, err := cmd.plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.DeleteRemote) != 0 || len(plan.Download) != 0 {
+		t.Fatalf("delete remote: %d, download: %d, expect 0", len(plan.DeleteRemote), len(plan.Download))
+	}
+}
+
+func TestSyncPlanReadOnly(t *testing.T) {
+	server := icloudtest.NewServer()
+	defer server.Close()
+	a := server.AddPhoto("a.jpg", []byte("a"), time.Now())
+
+	cmd := newTestSyncCommand(t, server)
+	if err := os.WriteFile(filepath.Join(cmd.Output, "b.jpg"), []byte("b"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	plan, err := cmd.plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Upload) != 1 || len(plan.Download) != 1 || plan.Download[0].ID() != a.ID {
+		t.Fatalf("upload: %v, download: %v", plan.Upload, plan.Download)
+	}
+	if status := testAssetStatus(t, cmd.downloadCommand, a.ID); status != -1 {
+		t.Fatalf("the planned asset is saved, status: %d", status)
+	}
+	if claimed := testClaimedPaths(t, cmd.downloadCommand); len(claimed) != 0 {
+		t.Fatalf("paths are claimed: %v", claimed)
+	}
+	if len(server.Photos()) != 1 {
+		t.Fatal("the planned file is uploaded")
+	}
+}
+
+func TestSyncTrashDeletedUploads(t *testing.T) {
+	for _, mode := range []string{autoDeleteModeTrash, autoDeleteModeDryRun} {
+		t.Run(mode, func(t *testing.T) {
+			server := icloudtest.NewServer()
+			defer server.Close()
+
+			cmd := newTestSyncCommand(t, server)
+			path := filepath.Join(cmd.Output, "mine.jpg")
+			if err := os.WriteFile(path, []byte("mine"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := cmd.sync(); err != nil {
+				t.Fatal(err)
+			}
+			if len(server.Photos()) != 1 {
+				t.Fatalf("photos: %d, expect 1", len(server.Photos()))
+			}
+
+			// the uploaded original is not removed for good when the photo is deleted in icloud
+			server.DeletePhoto(server.Photos()[0].ID)
+			cmd.AutoDeleteMode = mode
+			if err := cmd.sync(); err != nil {
+				t.Fatal(err)
+			}
+			_, err := os.Stat(path)
+			switch mode {
+			case autoDeleteModeTrash:
+				if !os.IsNotExist(err) {
+					t.Fatalf("the uploaded file is not trashed: %v", err)
+				}
+				matches, _ := filepath.Glob(filepath.Join(cmd.Output, ".trash", "*", "mine.jpg"))
+				if len(matches) != 1 {
+					t.Fatalf("the uploaded file is not in trash: %v", matches)
+				}
+			case autoDeleteModeDryRun:
+				if err != nil {
+					t.Fatalf("the uploaded file is removed in dry-run: %v", err)
+				}
+			}
+			if bs, err := os.ReadFile(filepath.Join(cmd.Output, ".auto_delete.log")); err != nil || len(bs) == 0 {
+				t.Fatalf("the uploaded file is not reported: %v", err)
+			}
+		})
+	}
+}
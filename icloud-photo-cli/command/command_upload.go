@@ -1,74 +1,343 @@
 package command
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 
-	"github.com/chyroc/icloudgo/internal"
-
+	"github.com/dgraph-io/badger/v3"
 	"github.com/urfave/cli/v2"
 
 	"github.com/chyroc/icloudgo"
+	"github.com/chyroc/icloudgo/internal"
 )
 
+// defaultUploadExts are the extensions of the photos and videos uploaded from the dir
+var defaultUploadExts = []string{
+	"jpg", "jpeg", "heic", "heif", "png", "gif", "tif", "tiff", "webp", "bmp", "dng",
+	"cr2", "cr3", "nef", "arw", "raf", "orf", "rw2", "mov", "mp4", "m4v", "avi", "3gp",
+}
+
 func NewUploadFlag() []cli.Flag {
 	var res []cli.Flag
 	res = append(res, commonFlag...)
 	res = append(res,
 		&cli.StringFlag{
 			Name:     "file",
-			Usage:    "file path",
-			Required: true,
+			Usage:    "file path, one of file and dir is required",
+			Required: false,
 			Aliases:  []string{"f"},
 			EnvVars:  []string{"ICLOUD_FILE"},
 		},
+		&cli.StringFlag{
+			Name:     "dir",
+			Usage:    "upload the photos and videos in the dir and its sub dirs, the uploaded files are skipped in the next runs",
+			Required: false,
+			EnvVars:  []string{"ICLOUD_DIR"},
+		},
+		&cli.StringSliceFlag{
+			Name:     "ext",
+			Usage:    "only upload the files with the extension in the dir, can be set multiple times, default is the common photo and video extensions, example: `heic`",
+			Required: false,
+			EnvVars:  []string{"ICLOUD_EXT"},
+		},
+		&cli.IntFlag{
+			Name:     "thread-num",
+			Usage:    "thread num, if not set, means 1",
+			Required: false,
+			Aliases:  []string{"t"},
+			Value:    1,
+			EnvVars:  []string{"ICLOUD_THREAD_NUM"},
+		},
+		&cli.StringFlag{
+			Name:     "album",
+			Usage:    "user album name, the uploaded photo is added to the album",
+			Required: false,
+			Aliases:  []string{"a"},
+			EnvVars:  []string{"ICLOUD_ALBUM"},
+		},
 	)
 	return res
 }
 
 func Upload(c *cli.Context) error {
-	username := c.String("username")
-	password := c.String("password")
-	cookieDir := c.String("cookie-dir")
-	domain := c.String("domain")
-	file := c.String("file")
+	cmd, err := newUploadCommand(c)
+	if err != nil {
+		return err
+	}
+	defer cmd.client.Close()
+	defer cmd.Close()
+
+	return cmd.upload()
+}
+
+type uploadCommand struct {
+	File      string
+	Dir       string
+	Exts      map[string]bool
+	ThreadNum int
+	AlbumName string
+
+	client   *icloudgo.Client
+	photoCli *icloudgo.PhotoService
+	option   *icloudgo.PhotoUploadOption
+	db       *badger.DB
+	lock     *sync.Mutex
+}
+
+func newUploadCommand(c *cli.Context) (*uploadCommand, error) {
+	cmd := &uploadCommand{
+		File:      c.String("file"),
+		Dir:       c.String("dir"),
+		Exts:      map[string]bool{},
+		ThreadNum: c.Int("thread-num"),
+		AlbumName: c.String("album"),
+		option:    &icloudgo.PhotoUploadOption{FindDuplicate: true},
+		lock:      &sync.Mutex{},
+	}
+	if (cmd.File == "") == (cmd.Dir == "") {
+		return nil, fmt.Errorf("one of file and dir is required")
+	}
+	if cmd.ThreadNum <= 0 {
+		cmd.ThreadNum = 1
+	}
+	exts := defaultUploadExts
+	if len(c.StringSlice("ext")) > 0 {
+		exts = nil
+		for _, v := range c.StringSlice("ext") {
+			exts = append(exts, strings.Split(v, ",")...)
+		}
+	}
+	for _, ext := range exts {
+		if ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), ".")); ext != "" {
+			cmd.Exts[ext] = true
+		}
+	}
 
 	cli, err := icloudgo.New(&icloudgo.ClientOption{
-		AppID:           username,
-		Password:        password,
-		CookieDir:       cookieDir,
+		AppID:           c.String("username"),
+		Password:        c.String("password"),
+		CookieDir:       c.String("cookie-dir"),
 		TwoFACodeGetter: &internal.StdinTextGetter{Tip: "2fa code"},
-		Domain:          domain,
+		Domain:          c.String("domain"),
 	})
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if err := cli.Authenticate(false, nil); err != nil {
+		return nil, err
+	}
+	photoCli, err := cli.PhotoCli()
+	if err != nil {
+		return nil, err
+	}
+	if cmd.AlbumName != "" {
+		if cmd.option.Album, err = photoCli.GetAlbum(cmd.AlbumName); err != nil {
+			return nil, err
+		}
 	}
 
-	defer cli.Close()
+	db, err := openUploadDB(cli, nil)
+	if err != nil {
+		return nil, err
+	}
 
-	if err := cli.Authenticate(false, nil); err != nil {
-		return err
+	cmd.client = cli
+	cmd.photoCli = photoCli
+	cmd.db = db
+
+	return cmd, nil
+}
+
+func (r *uploadCommand) Close() {
+	if r.db != nil {
+		r.db.Close()
 	}
+}
 
-	photoCli, err := cli.PhotoCli()
+func (r *uploadCommand) upload() error {
+	files, err := r.getFiles()
 	if err != nil {
 		return err
 	}
+	return r.uploadFiles(files)
+}
+
+func (r *uploadCommand) uploadFiles(files []string) error {
+	fmt.Printf("[icloudgo] [upload] found %d files, thread-num: %d\n", len(files), r.ThreadNum)
+
+	queue := make(chan string)
+	go func() {
+		for _, file := range files {
+			queue <- file
+		}
+		close(queue)
+	}()
+
+	var uploaded, duplicate, skipped, failed, finished int32
+	wait := new(sync.WaitGroup)
+	for threadIndex := 0; threadIndex < r.ThreadNum; threadIndex++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for file := range queue {
+				result, err := r.uploadFile(file)
+				index := atomic.AddInt32(&finished, 1)
+				if err != nil {
+					atomic.AddInt32(&failed, 1)
+					fmt.Printf("[icloudgo] [upload] (%d/%d) upload '%s' failed: %s\n", index, len(files), file, err)
+					continue
+				}
+				switch result {
+				case uploadResultUploaded:
+					atomic.AddInt32(&uploaded, 1)
+				case uploadResultDuplicate:
+					atomic.AddInt32(&duplicate, 1)
+				case uploadResultSkipped:
+					atomic.AddInt32(&skipped, 1)
+				}
+				fmt.Printf("[icloudgo] [upload] (%d/%d) '%s' %s\n", index, len(files), file, result)
+			}
+		}()
+	}
+	wait.Wait()
+
+	fmt.Printf("[icloudgo] [upload] finished, total: %d, uploaded: %d, duplicate: %d, skipped: %d, failed: %d\n", len(files), uploaded, duplicate, skipped, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d files upload failed", failed)
+	}
+	return nil
+}
+
+// getFiles returns the absolute path of the file, or the files in the dir with the extensions, sorted by path
+func (r *uploadCommand) getFiles() ([]string, error) {
+	if r.File != "" {
+		file, err := filepath.Abs(r.File)
+		if err != nil {
+			return nil, err
+		}
+		return []string{file}, nil
+	}
 
-	basename := filepath.Base(file)
-	f, err := os.Open(file)
+	dir, err := filepath.Abs(r.Dir)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	var files []string
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// skip the hidden files and dirs, e.g. .DS_Store, .trash
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() && r.Exts[strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))] {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// uploadProgressSize is the min size of the file whose upload progress is printed
+const uploadProgressSize = 100 * 1024 * 1024
+
+// uploadProgress prints the progress of the file every 10 percent
+func uploadProgress(path string) func(uploaded, total int64) {
+	printed := int64(-1)
+	return func(uploaded, total int64) {
+		if total <= 0 {
+			return
+		}
+		if percent := uploaded * 100 / total / 10 * 10; percent != printed {
+			printed = percent
+			fmt.Printf("[icloudgo] [upload] '%s' %d%%, %.1fMB/%.1fMB\n", path, percent, float64(uploaded)/1024/1024, float64(total)/1024/1024)
+		}
+	}
+}
+
+const (
+	uploadResultUploaded  = "uploaded"
+	uploadResultDuplicate = "duplicate"
+	uploadResultSkipped   = "skipped"
+)
+
+// uploadFile uploads the file, the file uploaded by the previous runs is skipped, and the file with the same content as
+// the uploaded one is duplicate
+func (r *uploadCommand) uploadFile(path string) (string, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if po, err := r.dalGetUploadFile(path); err != nil {
+		return "", err
+	} else if po != nil && po.Size == stat.Size() && po.ModTime == stat.ModTime().UnixNano() {
+		return uploadResultSkipped, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
 	}
 	defer f.Close()
 
-	isDuplicate, err := photoCli.Upload(basename, f)
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	po := &UploadFileModel{
+		Path:    path,
+		Hash:    hex.EncodeToString(hash.Sum(nil)),
+		Size:    stat.Size(),
+		ModTime: stat.ModTime().UnixNano(),
+	}
+	if uploadedPo, err := r.dalGetUploadHash(po.Hash); err != nil {
+		return "", err
+	} else if uploadedPo != nil {
+		po.AssetID = uploadedPo.AssetID
+		return uploadResultDuplicate, r.dalSaveUploadFile(po)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	option := *r.option
+	option.Size = stat.Size()
+	if stat.Size() >= uploadProgressSize {
+		option.Progress = uploadProgress(path)
+	}
+	asset, isDuplicate, err := r.photoCli.Upload(filepath.Base(path), f, &option)
+	if asset != nil {
+		po.AssetID = asset.ID()
+	}
 	if err != nil {
-		return err
+		if asset != nil {
+			// the file is uploaded, the next run should not upload it again
+			_ = r.dalSaveUploadFile(po)
+		}
+		return "", err
+	}
+	if err := r.dalSaveUploadFile(po); err != nil {
+		return "", err
 	}
 	if isDuplicate {
-		fmt.Printf("file %s is duplicate\n", basename)
+		return uploadResultDuplicate, nil
 	}
-	return nil
+	return uploadResultUploaded, nil
 }
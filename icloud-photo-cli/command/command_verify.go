@@ -0,0 +1,113 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/chyroc/icloudgo"
+	"github.com/urfave/cli/v2"
+)
+
+func NewVerifyFlag() []cli.Flag {
+	skip := map[string]bool{"album": true, "all-albums": true, "album-link": true, "stop-found-num": true, "auto-delete": true, "auto-delete-mode": true, "trash-retention": true}
+	for _, flag := range filterFlag {
+		skip[flag.Names()[0]] = true
+	}
+
+	var res []cli.Flag
+	for _, flag := range NewDownloadFlag() {
+		if skip[flag.Names()[0]] {
+			continue
+		}
+		res = append(res, flag)
+	}
+	return res
+}
+
+func Verify(c *cli.Context) error {
+	cmd, err := newDownloadCommand(c)
+	if err != nil {
+		return err
+	}
+	defer cmd.client.Close()
+	defer cmd.Close()
+
+	return cmd.verify()
+}
+
+// verify rescans the downloaded files, and re-queues the missing or corrupted ones
+func (r *downloadCommand) verify() error {
+	assets, err := r.dalGetUnDownloadAssets(&[]int{1}[0])
+	if err != nil {
+		return err
+	}
+	fmt.Printf("[icloudgo] [verify] found %d downloaded assets, output: %s, thread-num: %d\n", len(assets), r.Output, r.ThreadNum)
+
+	queue := make(chan *PhotoAssetModel)
+	go func() {
+		for _, po := range assets {
+			queue <- po
+		}
+		close(queue)
+	}()
+
+	var verified, requeued, failed int32
+	wait := new(sync.WaitGroup)
+	for threadIndex := 0; threadIndex < r.ThreadNum; threadIndex++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for po := range queue {
+				photo := r.photoCli.NewPhotoAssetFromBytes([]byte(po.Data))
+				ok, err := r.verifyPhotoAsset(photo, po.Albums)
+				if err != nil {
+					atomic.AddInt32(&failed, 1)
+					fmt.Printf("[icloudgo] [verify] verify %s failed: %s\n", photo.Filename(false), err)
+					continue
+				} else if ok {
+					atomic.AddInt32(&verified, 1)
+					continue
+				}
+				if err := r.dalSetUnDownloaded(po.ID); err != nil {
+					atomic.AddInt32(&failed, 1)
+					fmt.Printf("[icloudgo] [verify] re-queue %s failed: %s\n", photo.Filename(false), err)
+					continue
+				}
+				atomic.AddInt32(&requeued, 1)
+			}
+		}()
+	}
+	wait.Wait()
+
+	fmt.Printf("[icloudgo] [verify] finished, total: %d, verified: %d, re-queued: %d, failed: %d\n", len(assets), verified, requeued, failed)
+	return nil
+}
+
+func (r *downloadCommand) verifyPhotoAsset(photo *icloudgo.PhotoAsset, albums []string) (bool, error) {
+	livePhotos := []bool{false}
+	if r.WithLivePhoto && photo.IsLivePhoto() {
+		livePhotos = append(livePhotos, true)
+	}
+
+	for _, livePhoto := range livePhotos {
+		path, _, err := r.assetPaths(photo, albums, livePhoto)
+		if err != nil {
+			return false, err
+		}
+		// the verify command always hashes the files, and refreshes the results cached for the download
+		if err := r.verifyLocalFile(photo, livePhoto, path, true); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				fmt.Printf("[icloudgo] [verify] '%s' is missing\n", path)
+				return false, nil
+			} else if errors.Is(err, icloudgo.ErrChecksumMismatch) {
+				fmt.Printf("[icloudgo] [verify] '%s' is corrupted: %s\n", path, err)
+				return false, nil
+			}
+			return false, err
+		}
+	}
+	return true, nil
+}
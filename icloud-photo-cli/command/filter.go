@@ -0,0 +1,267 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chyroc/icloudgo"
+	"github.com/urfave/cli/v2"
+)
+
+var filterFlag = []cli.Flag{
+	&cli.StringFlag{
+		Name:     "since",
+		Usage:    "only download the photos after the date, support: `2023-01-01`, `2023-01-01T08:00:00+08:00`, `30d`(30 days ago), `12h`(12 hours ago)",
+		Required: false,
+		EnvVars:  []string{"ICLOUD_SINCE"},
+	},
+	&cli.StringFlag{
+		Name:     "until",
+		Usage:    "only download the photos before the date, the format is the same as `since`",
+		Required: false,
+		EnvVars:  []string{"ICLOUD_UNTIL"},
+	},
+	&cli.StringFlag{
+		Name:     "date-field",
+		Usage:    "the date used by `since` and `until`, support: asset(taken date), added(added to icloud date)",
+		Required: false,
+		Value:    "asset",
+		EnvVars:  []string{"ICLOUD_DATE_FIELD"},
+	},
+	&cli.StringSliceFlag{
+		Name:     "media-type",
+		Usage:    "only download the media type, can be set multiple times, support: photo, video, live, screenshot",
+		Required: false,
+		EnvVars:  []string{"ICLOUD_MEDIA_TYPE"},
+	},
+	&cli.StringSliceFlag{
+		Name:     "include",
+		Usage:    "only download the files whose name match the glob, can be set multiple times, example: `*.heic`",
+		Required: false,
+		EnvVars:  []string{"ICLOUD_INCLUDE"},
+	},
+	&cli.StringSliceFlag{
+		Name:     "exclude",
+		Usage:    "skip the files whose name match the glob, can be set multiple times, example: `*.png`",
+		Required: false,
+		EnvVars:  []string{"ICLOUD_EXCLUDE"},
+	},
+	&cli.StringFlag{
+		Name:     "near",
+		Usage:    "only download the photos taken near the place, format: `latitude,longitude,radius_km`, example: `31.23,121.47,10`",
+		Required: false,
+		EnvVars:  []string{"ICLOUD_NEAR"},
+	},
+}
+
+// assetFilter decides which assets are downloaded, the zero value matches all assets
+type assetFilter struct {
+	// Since and Until are kept as the flag values, the relative dates, e.g. 30d, are resolved at every match
+	Since      string
+	Until      string
+	DateField  string
+	MediaTypes []string
+	Include    []string
+	Exclude    []string
+	Near       *nearFilter
+}
+
+func newAssetFilter(c *cli.Context) (*assetFilter, error) {
+	now := time.Now()
+	if _, err := parseFilterDate(c.String("since"), now); err != nil {
+		return nil, fmt.Errorf("invalid since: %w", err)
+	}
+	if _, err := parseFilterDate(c.String("until"), now); err != nil {
+		return nil, fmt.Errorf("invalid until: %w", err)
+	}
+
+	filter := &assetFilter{
+		Since:     strings.TrimSpace(c.String("since")),
+		Until:     strings.TrimSpace(c.String("until")),
+		DateField: c.String("date-field"),
+		Include:   c.StringSlice("include"),
+		Exclude:   c.StringSlice("exclude"),
+	}
+	switch filter.DateField {
+	case "", "asset", "added":
+	default:
+		return nil, fmt.Errorf("invalid date-field '%s', support: asset, added", filter.DateField)
+	}
+	for _, v := range c.StringSlice("media-type") {
+		for _, mediaType := range strings.Split(v, ",") {
+			mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+			switch mediaType {
+			case "photo", "video", "live", "screenshot":
+				filter.MediaTypes = append(filter.MediaTypes, mediaType)
+			case "":
+			default:
+				return nil, fmt.Errorf("invalid media-type '%s', support: photo, video, live, screenshot", mediaType)
+			}
+		}
+	}
+	for _, pattern := range append(append([]string{}, filter.Include...), filter.Exclude...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob '%s': %w", pattern, err)
+		}
+	}
+	if near := c.String("near"); near != "" {
+		var err error
+		if filter.Near, err = parseNearFilter(near); err != nil {
+			return nil, err
+		}
+	}
+	return filter, nil
+}
+
+// fingerprint identifies the filter options, the offsets and the sync token are reset when it changes, so the assets
+// skipped by the old filter are saved
+func (r *assetFilter) fingerprint() string {
+	if r == nil {
+		return ""
+	}
+	bs, _ := json.Marshal(r)
+	return string(bs)
+}
+
+func (r *assetFilter) match(photo *icloudgo.PhotoAsset) bool {
+	if r == nil {
+		return true
+	}
+
+	date := photo.AssetDate()
+	if r.DateField == "added" {
+		date = photo.AddDate()
+	}
+	now := time.Now()
+	if since, _ := parseFilterDate(r.Since, now); !since.IsZero() && date.Before(since) {
+		return false
+	}
+	if until, _ := parseFilterDate(r.Until, now); !until.IsZero() && !date.Before(until) {
+		return false
+	}
+
+	if len(r.MediaTypes) > 0 {
+		matched := false
+		for _, mediaType := range r.MediaTypes {
+			if matchMediaType(photo, mediaType) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	name := strings.ToLower(photo.Filename(false))
+	if len(r.Include) > 0 && !matchGlobs(r.Include, name) {
+		return false
+	}
+	if matchGlobs(r.Exclude, name) {
+		return false
+	}
+
+	if r.Near != nil && !r.Near.match(photo) {
+		return false
+	}
+	return true
+}
+
+func (r *assetFilter) filter(assets []*icloudgo.PhotoAsset) []*icloudgo.PhotoAsset {
+	if r == nil {
+		return assets
+	}
+
+	var res []*icloudgo.PhotoAsset
+	for _, v := range assets {
+		if r.match(v) {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// matchMediaType checks the media type, the screenshot is guessed by the png format
+func matchMediaType(photo *icloudgo.PhotoAsset, mediaType string) bool {
+	switch mediaType {
+	case "photo":
+		return !photo.IsVideo()
+	case "video":
+		return photo.IsVideo()
+	case "live":
+		return photo.IsLivePhoto()
+	case "screenshot":
+		return photo.ItemType() == "public.png"
+	}
+	return false
+}
+
+func matchGlobs(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(strings.ToLower(pattern), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// parseFilterDate parses the date or the duration before now, empty returns zero time
+func parseFilterDate(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if strings.HasSuffix(s, "d") {
+		if days, err := strconv.Atoi(strings.TrimSuffix(s, "d")); err == nil {
+			return now.AddDate(0, 0, -days), nil
+		}
+	}
+	if duration, err := time.ParseDuration(s); err == nil {
+		return now.Add(-duration), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unsupported date '%s'", s)
+}
+
+// nearFilter matches the photos taken within radius of the coordinate
+type nearFilter struct {
+	Latitude  float64
+	Longitude float64
+	RadiusKM  float64
+}
+
+func parseNearFilter(s string) (*nearFilter, error) {
+	l := strings.Split(s, ",")
+	if len(l) != 3 {
+		return nil, fmt.Errorf("invalid near '%s', format: latitude,longitude,radius_km", s)
+	}
+	var values []float64
+	for _, v := range l {
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid near '%s': %w", s, err)
+		}
+		values = append(values, f)
+	}
+	if values[0] < -90 || values[0] > 90 || values[1] < -180 || values[1] > 180 || values[2] <= 0 {
+		return nil, fmt.Errorf("invalid near '%s', coordinate or radius out of range", s)
+	}
+	return &nearFilter{Latitude: values[0], Longitude: values[1], RadiusKM: values[2]}, nil
+}
+
+// match returns false for the photo without location
+func (r *nearFilter) match(photo *icloudgo.PhotoAsset) bool {
+	location, err := photo.Location()
+	if err != nil || location == nil {
+		return false
+	}
+	return location.DistanceTo(r.Latitude, r.Longitude) <= r.RadiusKM*1000
+}
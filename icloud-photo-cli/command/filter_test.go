@@ -0,0 +1,73 @@
+package command
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chyroc/icloudgo/icloudtest"
+)
+
+func TestFilterChanged(t *testing.T) {
+	server := icloudtest.NewServer()
+	defer server.Close()
+	old := server.AddPhoto("old.jpg", []byte("old"), time.Now().AddDate(0, 0, -10))
+	recent := server.AddPhoto("recent.png", []byte("recent"), time.Now())
+
+	cmd := newTestDownloadCommand(t, server)
+	cmd.Filter = &assetFilter{Since: "5d"}
+	if err := cmd.dalResetFilter(cmd.Filter.fingerprint()); err != nil {
+		t.Fatal(err)
+	}
+	saveTestMeta(t, cmd)
+	if status := testAssetStatus(t, cmd, old.ID); status != -1 {
+		t.Fatalf("the old photo is saved, status: %d", status)
+	}
+	if status := testAssetStatus(t, cmd, recent.ID); status != 0 {
+		t.Fatalf("the recent photo is not saved, status: %d", status)
+	}
+
+	// the same filter keeps the sync token, the changed one walks all photos again
+	if err := cmd.dalResetFilter(cmd.Filter.fingerprint()); err != nil {
+		t.Fatal(err)
+	} else if cmd.dalGetSyncToken() == "" {
+		t.Fatal("sync token is reset by the same filter")
+	}
+	cmd.Filter = &assetFilter{Since: "30d"}
+	if err := cmd.dalResetFilter(cmd.Filter.fingerprint()); err != nil {
+		t.Fatal(err)
+	} else if cmd.dalGetSyncToken() != "" {
+		t.Fatal("sync token is not reset by the changed filter")
+	}
+	saveTestMeta(t, cmd)
+	if status := testAssetStatus(t, cmd, old.ID); status != 0 {
+		t.Fatalf("the old photo is not saved after the filter changed, status: %d", status)
+	}
+}
+
+func TestFilterRelativeDate(t *testing.T) {
+	server := icloudtest.NewServer()
+	defer server.Close()
+	server.AddPhoto("a.jpg", []byte("a"), time.Now())
+
+	cmd := newTestDownloadCommand(t, server)
+	album, err := cmd.photoCli.GetAlbum("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assets, err := album.GetPhotosByOffset(0, 10)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(assets) != 1 {
+		t.Fatalf("assets: %d, expect 1", len(assets))
+	}
+
+	// the relative date is resolved when matching, not when the filter is created
+	filter := &assetFilter{Since: "1s"}
+	if !filter.match(assets[0]) {
+		t.Fatal("the photo after since is not matched")
+	}
+	time.Sleep(time.Second * 2)
+	if filter.match(assets[0]) {
+		t.Fatal("the photo before since is matched")
+	}
+}
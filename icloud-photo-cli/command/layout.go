@@ -0,0 +1,98 @@
+package command
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chyroc/icloudgo"
+)
+
+// assetPaths returns the path where the file is downloaded, and the paths where the file is linked in the other albums.
+//
+// Without the path template, the file is saved by the folder and file structure, and the albums except All Photos are
+// linked to <output>/Albums/<album>/ when downloading many albums. With the path template, the file is saved in the
+// first album of the asset, and linked in the others. The paths are only computed, see claimAssetPaths.
+func (r *downloadCommand) assetPaths(photo *icloudgo.PhotoAsset, albums []string, livePhoto bool) (string, []string, error) {
+	return r.resolveAssetPaths(photo, albums, livePhoto, false)
+}
+
+// claimAssetPaths is assetPaths, and claims the paths of the path template for the asset, it is called before the file
+// is downloaded, so the other assets with the same path get other names
+func (r *downloadCommand) claimAssetPaths(photo *icloudgo.PhotoAsset, albums []string, livePhoto bool) (string, []string, error) {
+	return r.resolveAssetPaths(photo, albums, livePhoto, true)
+}
+
+func (r *downloadCommand) resolveAssetPaths(photo *icloudgo.PhotoAsset, albums []string, livePhoto, claim bool) (string, []string, error) {
+	if len(albums) == 0 {
+		albums = []string{icloudgo.AlbumNameAll}
+	}
+
+	if r.PathTemplate == "" {
+		path := photo.LocalPath(photo.OutputDir(r.Output, r.FolderStructure), icloudgo.PhotoVersionOriginal, r.FileStructure, livePhoto)
+		if !r.isMultiAlbum() || r.AlbumLink == "none" {
+			return path, nil, nil
+		}
+		var links []string
+		for _, album := range albums {
+			if album == icloudgo.AlbumNameAll {
+				continue
+			}
+			links = append(links, filepath.Join(r.albumDir(album), filepath.Base(path)))
+		}
+		return path, links, nil
+	}
+
+	var paths []string
+	for _, name := range albums {
+		album, err := r.photoCli.GetAlbum(name)
+		if err != nil {
+			// the album is deleted in icloud, the folders of it are unknown
+			album = &icloudgo.PhotoAlbum{Name: name}
+		}
+		path, err := r.dalResolvePath(photo.FormatPath(r.PathTemplate, album, livePhoto), photo.ID(), claim)
+		if err != nil {
+			return "", nil, err
+		}
+		paths = append(paths, filepath.Join(r.Output, path))
+	}
+	if r.AlbumLink == "none" {
+		return paths[0], nil, nil
+	}
+	return paths[0], paths[1:], nil
+}
+
+func (r *downloadCommand) isMultiAlbum() bool {
+	return r.AllAlbums || len(r.AlbumNames) > 1
+}
+
+func (r *downloadCommand) albumDir(album string) string {
+	name := strings.NewReplacer("/", "_", "\\", "_").Replace(album)
+	if name == "." || name == ".." {
+		name = "_"
+	}
+	return filepath.Join(r.Output, "Albums", name)
+}
+
+// linkFile creates dst as the hardlink or symlink of src, the stale dst, e.g. the link to the replaced file, is replaced
+func linkFile(mode, src, dst string) error {
+	if dstStat, err := os.Stat(dst); err == nil {
+		if srcStat, err := os.Stat(src); err == nil && os.SameFile(srcStat, dstStat) {
+			return nil
+		}
+	}
+	if _, err := os.Lstat(dst); err == nil {
+		if err := os.Remove(dst); err != nil {
+			return err
+		}
+	}
+
+	if mode == "symlink" {
+		target, err := filepath.Rel(filepath.Dir(dst), src)
+		if err != nil {
+			target = src
+		}
+		return os.Symlink(target, dst)
+	}
+	return os.Link(src, dst)
+}
@@ -0,0 +1,115 @@
+package command
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+
+	"github.com/chyroc/icloudgo"
+	"github.com/chyroc/icloudgo/icloudtest"
+)
+
+func testClaimedPaths(t *testing.T, cmd *downloadCommand) map[string]string {
+	t.Helper()
+
+	res := map[string]string{}
+	err := cmd.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Seek(cmd.keyPathPrefix()); it.ValidForPrefix(cmd.keyPathPrefix()); it.Next() {
+			val, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			res[string(it.Item().Key())] = string(val)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestAssetPathsClaim(t *testing.T) {
+	server := icloudtest.NewServer()
+	defer server.Close()
+	a := server.AddPhoto("IMG_0001.JPG", []byte("a"), time.Now())
+	b := server.AddPhoto("IMG_0001.JPG", []byte("b"), time.Now())
+
+	cmd := newTestDownloadCommand(t, server)
+	cmd.PathTemplate = "{album}/{filename}{ext}"
+	saveTestMeta(t, cmd)
+	photoA := cmd.photoCli.NewPhotoAssetFromBytes(mustAssetData(t, cmd, a.ID))
+	photoB := cmd.photoCli.NewPhotoAssetFromBytes(mustAssetData(t, cmd, b.ID))
+	albums := []string{icloudgo.AlbumNameAll}
+
+	// computing the paths does not claim them
+	pathA, _, err := cmd.assetPaths(photoA, albums, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pathB, _, err := cmd.assetPaths(photoB, albums, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pathA != pathB {
+		t.Fatalf("unclaimed paths: %s, %s", pathA, pathB)
+	}
+	if claimed := testClaimedPaths(t, cmd); len(claimed) != 0 {
+		t.Fatalf("paths are claimed: %v", claimed)
+	}
+
+	if _, _, err := cmd.claimAssetPaths(photoA, albums, false); err != nil {
+		t.Fatal(err)
+	}
+	if pathB, _, err = cmd.claimAssetPaths(photoB, albums, false); err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(pathB) != "IMG_0001_"+b.ID[:8]+".JPG" {
+		t.Fatalf("path of the conflict asset: %s", pathB)
+	}
+	if path, _, err := cmd.assetPaths(photoB, albums, false); err != nil {
+		t.Fatal(err)
+	} else if path != pathB {
+		t.Fatalf("claimed path: %s, expect %s", path, pathB)
+	}
+
+	// the paths of a are released by the index of a
+	if err := cmd.dalReleasePaths(a.ID); err != nil {
+		t.Fatal(err)
+	}
+	claimed := testClaimedPaths(t, cmd)
+	if len(claimed) != 1 {
+		t.Fatalf("claimed paths: %v", claimed)
+	}
+	for _, id := range claimed {
+		if id != b.ID {
+			t.Fatalf("claimed paths: %v", claimed)
+		}
+	}
+}
+
+func TestIndexPathClaims(t *testing.T) {
+	server := icloudtest.NewServer()
+	defer server.Close()
+
+	// the claim saved by the old version without the index
+	cmd := newTestDownloadCommand(t, server)
+	if err := cmd.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(cmd.keyPath("All Photos/IMG_0001"), []byte("id1"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.dalIndexPathClaims(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.dalReleasePaths("id1"); err != nil {
+		t.Fatal(err)
+	}
+	if claimed := testClaimedPaths(t, cmd); len(claimed) != 0 {
+		t.Fatalf("claimed paths: %v", claimed)
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/chyroc/icloudgo"
@@ -16,6 +18,8 @@ type PhotoAssetModel struct {
 	Name   string `gorm:"column:name"`
 	Data   string `gorm:"column:data"`
 	Status int    `gorm:"column:status"`
+	// Albums is the union of the downloaded albums which contain the asset
+	Albums []string `gorm:"column:albums"`
 }
 
 func (r PhotoAssetModel) bytes() []byte {
@@ -28,7 +32,9 @@ func valToPhotoAssetModel(val []byte) (*PhotoAssetModel, error) {
 	return res, json.Unmarshal(val, res)
 }
 
-func (r *downloadCommand) dalAddAssets(assets []*icloudgo.PhotoAsset) error {
+// dalAddAssets saves the assets of the album, the downloaded asset keeps its status if its original file is unchanged,
+// so the metadata changes, e.g. favorite, do not download and verify the file again
+func (r *downloadCommand) dalAddAssets(album string, assets []*icloudgo.PhotoAsset) error {
 	r.lock.Lock()
 	defer r.lock.Unlock()
 	return r.db.Update(func(txn *badger.Txn) error {
@@ -37,30 +43,110 @@ func (r *downloadCommand) dalAddAssets(assets []*icloudgo.PhotoAsset) error {
 				ID:     v.ID(),
 				Data:   string(v.Bytes()),
 				Status: 0,
+				Albums: []string{album},
+			}
+			// the asset is stored once, and remembers all the albums it belongs to
+			if old, err := r.getAsset(txn, v.ID()); err != nil {
+				return err
+			} else if old != nil {
+				po.Albums = mergeAlbums(old.Albums, album)
+				if old.Status == 1 && isSameOriginal(r.photoCli.NewPhotoAssetFromBytes([]byte(old.Data)), v) {
+					po.Status = old.Status
+				}
 			}
 			if err := txn.Set(r.keyAssert(v.ID()), po.bytes()); err != nil {
 				return err
 			}
+			if err := txn.Set(r.keyAssetRecord(v.AssetRecordName()), []byte(v.ID())); err != nil {
+				return err
+			}
 		}
 		return nil
 	})
 }
 
+func (r *downloadCommand) dalGetAsset(id string) (*PhotoAssetModel, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var po *PhotoAssetModel
+	err := r.db.View(func(txn *badger.Txn) error {
+		var err error
+		po, err = r.getAsset(txn, id)
+		return err
+	})
+	return po, err
+}
+
+// getAsset returns nil if the asset is not found
+func (r *downloadCommand) getAsset(txn *badger.Txn, id string) (*PhotoAssetModel, error) {
+	item, err := txn.Get(r.keyAssert(id))
+	if err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	val, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, err
+	}
+	return valToPhotoAssetModel(val)
+}
+
 func (r *downloadCommand) dalDeleteAsset(id string) error {
 	r.lock.Lock()
 	defer r.lock.Unlock()
 
 	return r.db.Update(func(txn *badger.Txn) error {
+		if old, err := r.getAsset(txn, id); err != nil {
+			return err
+		} else if old != nil {
+			if err := txn.Delete(r.keyAssetRecord(r.photoCli.NewPhotoAssetFromBytes([]byte(old.Data)).AssetRecordName())); err != nil {
+				return err
+			}
+		}
 		return txn.Delete(r.keyAssert(id))
 	})
 }
 
+// dalResolveAssetID returns the id of the saved asset by the id or the record name of its CPLAsset record, it returns
+// empty if the asset is not saved
+func (r *downloadCommand) dalResolveAssetID(recordName string) (string, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var result string
+	err := r.db.View(func(txn *badger.Txn) error {
+		if po, err := r.getAsset(txn, recordName); err != nil {
+			return err
+		} else if po != nil {
+			result = po.ID
+			return nil
+		}
+		item, err := txn.Get(r.keyAssetRecord(recordName))
+		if err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return nil
+			}
+			return err
+		}
+		val, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		result = string(val)
+		return nil
+	})
+	return result, err
+}
+
 func (r *downloadCommand) dalGetUnDownloadAssets(status *int) ([]*PhotoAssetModel, error) {
 	r.lock.Lock()
 	defer r.lock.Unlock()
 
 	pos := []*PhotoAssetModel{}
-	err := r.db.Update(func(txn *badger.Txn) error {
+	err := r.db.View(func(txn *badger.Txn) error {
 		it := txn.NewIterator(badger.DefaultIteratorOptions)
 		defer it.Close()
 		for it.Seek(r.keyAssertPrefix()); it.ValidForPrefix(r.keyAssertPrefix()); it.Next() {
@@ -85,6 +171,14 @@ func (r *downloadCommand) dalGetUnDownloadAssets(status *int) ([]*PhotoAssetMode
 }
 
 func (r *downloadCommand) dalSetDownloaded(id string) error {
+	return r.dalSetStatus(id, 1)
+}
+
+func (r *downloadCommand) dalSetUnDownloaded(id string) error {
+	return r.dalSetStatus(id, 0)
+}
+
+func (r *downloadCommand) dalSetStatus(id string, status int) error {
 	r.lock.Lock()
 	defer r.lock.Unlock()
 
@@ -101,7 +195,7 @@ func (r *downloadCommand) dalSetDownloaded(id string) error {
 		if err != nil {
 			return err
 		}
-		po.Status = 1
+		po.Status = status
 		return txn.Set(r.keyAssert(id), po.bytes())
 	})
 }
@@ -114,24 +208,29 @@ func (r *downloadCommand) keyAssert(id string) []byte {
 	return []byte("assert_" + id)
 }
 
-func (r *downloadCommand) dalGetDownloadOffset(albumSize int64) int64 {
+// keyAssetRecord maps the record name of the CPLAsset record to the asset id
+func (r *downloadCommand) keyAssetRecord(recordName string) []byte {
+	return []byte("asset_record_" + recordName)
+}
+
+func (r *downloadCommand) dalGetDownloadOffset(album string, albumSize int64) int64 {
 	r.lock.Lock()
 	defer r.lock.Unlock()
 
 	var result int64
 	_ = r.db.Update(func(txn *badger.Txn) error {
-		offset, err := r.getDownloadOffset(txn, false)
+		offset, err := r.getDownloadOffset(txn, album, false)
 		if err != nil {
 			if errors.Is(err, badger.ErrKeyNotFound) {
 				return nil
 			}
-			fmt.Printf("[icloudgo] [offset] get db offset err: %s, reset to 0\n", err)
+			fmt.Printf("[icloudgo] [offset] get db offset of %s err: %s, reset to 0\n", album, err)
 			return nil
 		}
-		fmt.Printf("[icloudgo] [offset] get db offset: %d\n", offset)
+		fmt.Printf("[icloudgo] [offset] get db offset of %s: %d\n", album, offset)
 		if offset > albumSize {
 			result = 0
-			if err = r.saveDownloadOffset(txn, 0, false); err != nil {
+			if err = r.saveDownloadOffset(txn, album, 0, false); err != nil {
 				fmt.Printf("[icloudgo] [offset] db offset=%d, album_size=%d, reset to 0, and save_db failed: %s\n", offset, albumSize, err)
 			} else {
 				fmt.Printf("[icloudgo] [offset] db offset=%d, album_size=%d, reset to 0\n", offset, albumSize)
@@ -143,12 +242,12 @@ func (r *downloadCommand) dalGetDownloadOffset(albumSize int64) int64 {
 	return result
 }
 
-func (r *downloadCommand) getDownloadOffset(txn *badger.Txn, needLock bool) (int64, error) {
+func (r *downloadCommand) getDownloadOffset(txn *badger.Txn, album string, needLock bool) (int64, error) {
 	if needLock {
 		r.lock.Lock()
 		defer r.lock.Unlock()
 	}
-	item, err := txn.Get(r.keyOffset())
+	item, err := txn.Get(r.keyOffset(album))
 	if err != nil {
 		return 0, err
 	} else if item.IsDeletedOrExpired() {
@@ -161,23 +260,332 @@ func (r *downloadCommand) getDownloadOffset(txn *badger.Txn, needLock bool) (int
 	return strconv.ParseInt(string(val), 10, 64)
 }
 
-func (r *downloadCommand) saveDownloadOffset(txn *badger.Txn, offset int64, needLock bool) error {
+func (r *downloadCommand) saveDownloadOffset(txn *badger.Txn, album string, offset int64, needLock bool) error {
 	if needLock {
 		r.lock.Lock()
 		defer r.lock.Unlock()
 	}
 	if txn == nil {
 		return r.db.Update(func(txn *badger.Txn) error {
-			e := badger.NewEntry(r.keyOffset(), []byte(strconv.FormatInt(offset, 10)))
+			e := badger.NewEntry(r.keyOffset(album), []byte(strconv.FormatInt(offset, 10)))
 			e.ExpiresAt = uint64(time.Now().Add(time.Hour * 12).Unix())
 			return txn.SetEntry(e)
 		})
 	}
-	e := badger.NewEntry(r.keyOffset(), []byte(strconv.FormatInt(offset, 10)))
+	e := badger.NewEntry(r.keyOffset(album), []byte(strconv.FormatInt(offset, 10)))
 	e.ExpiresAt = uint64(time.Now().Add(time.Hour * 12).Unix())
 	return txn.SetEntry(e)
 }
 
-func (r *downloadCommand) keyOffset() []byte {
-	return []byte("download_offset_" + r.AlbumName)
+func (r *downloadCommand) keyOffsetPrefix() []byte {
+	return []byte("download_offset_")
+}
+
+func (r *downloadCommand) keyOffset(album string) []byte {
+	return []byte("download_offset_" + album)
+}
+
+// dalResolvePath returns the relative path of the asset, and claims it for the asset if claim is true.
+//
+// The path is claimed without extension, so the photo and the video of live photo are claimed together. If the path is
+// claimed by another asset, the asset id is appended to the filename, so the conflict path is stable across runs. The
+// path is only computed if claim is false, e.g. in dry-run, the database is not changed.
+func (r *downloadCommand) dalResolvePath(path, id string, claim bool) (string, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	ext := filepath.Ext(path)
+	stem := strings.TrimSuffix(path, ext)
+	shortID := id
+	if len(shortID) > 8 {
+		shortID = shortID[:8]
+	}
+
+	var result string
+	resolve := func(txn *badger.Txn) error {
+		for _, candidate := range []string{stem, stem + "_" + shortID, stem + "_" + id} {
+			item, err := txn.Get(r.keyPath(candidate))
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				result = candidate + ext
+				if !claim {
+					return nil
+				}
+				if err := txn.Set(r.keyPath(candidate), []byte(id)); err != nil {
+					return err
+				}
+				return txn.Set(r.keyPathClaim(id, candidate), nil)
+			} else if err != nil {
+				return err
+			}
+			val, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			if string(val) == id {
+				result = candidate + ext
+				return nil
+			}
+		}
+		return fmt.Errorf("path '%s' is claimed by other assets", path)
+	}
+	var err error
+	if claim {
+		err = r.db.Update(resolve)
+	} else {
+		err = r.db.View(resolve)
+	}
+	return result, err
+}
+
+// dalReleasePaths releases all the paths claimed by the asset
+func (r *downloadCommand) dalReleasePaths(id string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.db.Update(func(txn *badger.Txn) error {
+		prefix := r.keyPathClaimPrefix(id)
+		var keys [][]byte
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			keys = append(keys, it.Item().KeyCopy(nil))
+		}
+		it.Close()
+
+		for _, key := range keys {
+			path := r.keyPath(string(key[len(prefix):]))
+			if item, err := txn.Get(path); err == nil {
+				val, err := item.ValueCopy(nil)
+				if err != nil {
+					return err
+				}
+				if string(val) == id {
+					if err := txn.Delete(path); err != nil {
+						return err
+					}
+				}
+			} else if !errors.Is(err, badger.ErrKeyNotFound) {
+				return err
+			}
+			if err := txn.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// dalIndexPathClaims indexes the paths claimed by the old version which has no index of the asset, it runs once
+func (r *downloadCommand) dalIndexPathClaims() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.db.Update(func(txn *badger.Txn) error {
+		if _, err := txn.Get(r.keyPathClaimIndexed()); err == nil {
+			return nil
+		} else if !errors.Is(err, badger.ErrKeyNotFound) {
+			return err
+		}
+
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		var claims [][2]string
+		for it.Seek(r.keyPathPrefix()); it.ValidForPrefix(r.keyPathPrefix()); it.Next() {
+			val, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				it.Close()
+				return err
+			}
+			claims = append(claims, [2]string{string(val), string(it.Item().Key()[len(r.keyPathPrefix()):])})
+		}
+		it.Close()
+
+		for _, claim := range claims {
+			if err := txn.Set(r.keyPathClaim(claim[0], claim[1]), nil); err != nil {
+				return err
+			}
+		}
+		return txn.Set(r.keyPathClaimIndexed(), []byte("1"))
+	})
+}
+
+func (r *downloadCommand) keyPathPrefix() []byte {
+	return []byte("path_")
+}
+
+func (r *downloadCommand) keyPath(path string) []byte {
+	return []byte("path_" + filepath.ToSlash(path))
+}
+
+// keyPathClaimPrefix is the prefix of the paths claimed by the asset, so they are released without scanning all paths
+func (r *downloadCommand) keyPathClaimPrefix(id string) []byte {
+	return []byte("claimed_path_" + id + "/")
+}
+
+func (r *downloadCommand) keyPathClaim(id, path string) []byte {
+	return append(r.keyPathClaimPrefix(id), filepath.ToSlash(path)...)
+}
+
+func (r *downloadCommand) keyPathClaimIndexed() []byte {
+	return []byte("claimed_path_indexed")
+}
+
+func (r *downloadCommand) dalGetSyncToken() string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var result string
+	_ = r.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(r.keySyncToken())
+		if err != nil {
+			if !errors.Is(err, badger.ErrKeyNotFound) {
+				fmt.Printf("[icloudgo] [sync_token] get db sync token err: %s\n", err)
+			}
+			return nil
+		}
+		val, err := item.ValueCopy(nil)
+		if err != nil {
+			return nil
+		}
+		result = string(val)
+		return nil
+	})
+	return result
+}
+
+func (r *downloadCommand) dalSaveSyncToken(syncToken string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.db.Update(func(txn *badger.Txn) error {
+		if syncToken == "" {
+			return txn.Delete(r.keySyncToken())
+		}
+		return txn.Set(r.keySyncToken(), []byte(syncToken))
+	})
+}
+
+func (r *downloadCommand) keySyncToken() []byte {
+	return []byte("sync_token")
+}
+
+// dalResetFilter resets the offsets of all albums and the sync token if the filter is changed since the last run, so
+// the albums are walked again, and the assets skipped by the old filter are saved
+func (r *downloadCommand) dalResetFilter(fingerprint string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.db.Update(func(txn *badger.Txn) error {
+		var old string
+		if item, err := txn.Get(r.keyFilter()); err == nil {
+			val, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			old = string(val)
+		} else if !errors.Is(err, badger.ErrKeyNotFound) {
+			return err
+		} else if r.hasSyncToken(txn) {
+			// the db is saved by the old version without the fingerprint, the filter is unknown
+			old = "unknown"
+		}
+		if old == fingerprint {
+			return nil
+		}
+		if old != "" {
+			fmt.Printf("[icloudgo] [meta] filter changed, reset the offsets and the sync token\n")
+		}
+
+		var keys [][]byte
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		for it.Seek(r.keyOffsetPrefix()); it.ValidForPrefix(r.keyOffsetPrefix()); it.Next() {
+			keys = append(keys, it.Item().KeyCopy(nil))
+		}
+		it.Close()
+		keys = append(keys, r.keySyncToken())
+		for _, key := range keys {
+			if err := txn.Delete(key); err != nil {
+				return err
+			}
+		}
+		return txn.Set(r.keyFilter(), []byte(fingerprint))
+	})
+}
+
+func (r *downloadCommand) hasSyncToken(txn *badger.Txn) bool {
+	_, err := txn.Get(r.keySyncToken())
+	return err == nil
+}
+
+func (r *downloadCommand) keyFilter() []byte {
+	return []byte("filter_fingerprint")
+}
+
+// verifiedFile is the state of the local file when it passed the verification
+type verifiedFile struct {
+	Size        int64  `json:"size"`
+	ModTime     int64  `json:"mod_time"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// dalIsVerified returns true if the file at path passed the verification, and it is not changed since then
+func (r *downloadCommand) dalIsVerified(path string, file verifiedFile) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var result bool
+	_ = r.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(r.keyVerified(path))
+		if err != nil {
+			return nil
+		}
+		val, err := item.ValueCopy(nil)
+		if err != nil {
+			return nil
+		}
+		var old verifiedFile
+		if json.Unmarshal(val, &old) == nil {
+			result = old == file
+		}
+		return nil
+	})
+	return result
+}
+
+func (r *downloadCommand) dalSaveVerified(path string, file verifiedFile) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	val, _ := json.Marshal(file)
+	return r.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(r.keyVerified(path), val)
+	})
+}
+
+func (r *downloadCommand) dalDeleteVerified(path string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(r.keyVerified(path))
+	})
+}
+
+func (r *downloadCommand) keyVerified(path string) []byte {
+	return []byte("verified_" + filepath.ToSlash(path))
+}
+
+// isSameOriginal returns true if the original files of the assets are the same
+func isSameOriginal(a, b *icloudgo.PhotoAsset) bool {
+	return a.Size() == b.Size() &&
+		a.Fingerprint(icloudgo.PhotoVersionOriginal, false) == b.Fingerprint(icloudgo.PhotoVersionOriginal, false) &&
+		a.Fingerprint(icloudgo.PhotoVersionOriginal, true) == b.Fingerprint(icloudgo.PhotoVersionOriginal, true)
+}
+
+// mergeAlbums appends album to albums if it is not in albums
+func mergeAlbums(albums []string, album string) []string {
+	for _, v := range albums {
+		if v == album {
+			return albums
+		}
+	}
+	return append(albums, album)
 }
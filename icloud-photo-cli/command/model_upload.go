@@ -0,0 +1,218 @@
+package command
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/dgraph-io/badger/v3"
+
+	"github.com/chyroc/icloudgo"
+)
+
+// openUploadDB opens upload.db in the cookie dir, which saves the uploaded files of both upload and sync. It is not
+// badger.db, so upload works while download holds the lock of badger.db.
+//
+// The files saved in badger.db by the previous versions are moved to upload.db, legacy is the opened badger.db, or nil
+// to open it here, it is skipped if badger.db is locked, and moved by the next run.
+func openUploadDB(cli *icloudgo.Client, legacy *badger.DB) (*badger.DB, error) {
+	db, err := badger.Open(badger.DefaultOptions(cli.ConfigPath("upload.db")))
+	if err != nil {
+		return nil, err
+	}
+	if legacy == nil {
+		legacyPath := cli.ConfigPath("badger.db")
+		if _, err := os.Stat(legacyPath); err != nil {
+			return db, nil
+		}
+		if legacy, err = badger.Open(badger.DefaultOptions(legacyPath)); err != nil {
+			fmt.Printf("[icloudgo] [upload] skip moving the uploaded files from badger.db: %s\n", err)
+			return db, nil
+		}
+		defer legacy.Close()
+	}
+	if err := moveUploadFiles(legacy, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// moveUploadFiles moves the uploaded files from one db to another, the files already in the other db are kept
+func moveUploadFiles(from, to *badger.DB) error {
+	var keys, vals [][]byte
+	err := from.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		prefix := []byte("upload_")
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			val, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			keys = append(keys, it.Item().KeyCopy(nil))
+			vals = append(vals, val)
+		}
+		return nil
+	})
+	if err != nil || len(keys) == 0 {
+		return err
+	}
+
+	err = to.Update(func(txn *badger.Txn) error {
+		for i, key := range keys {
+			if _, err := txn.Get(key); err == nil {
+				continue
+			} else if !errors.Is(err, badger.ErrKeyNotFound) {
+				return err
+			}
+			if err := txn.Set(key, vals[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = from.Update(func(txn *badger.Txn) error {
+		for _, key := range keys {
+			if err := txn.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("[icloudgo] [upload] moved %d uploaded records from badger.db to upload.db\n", len(keys))
+	return nil
+}
+
+// UploadFileModel is the local file uploaded by the upload command
+type UploadFileModel struct {
+	Path    string `json:"path"`
+	Hash    string `json:"hash"` // sha256 of the content
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mod_time"`
+	AssetID string `json:"asset_id"` // empty if the file is duplicate in icloud and the existing asset is not found
+}
+
+func (r UploadFileModel) bytes() []byte {
+	val, _ := json.Marshal(r)
+	return val
+}
+
+// dalSaveUploadFile saves the file by its path and its hash
+func (r *uploadCommand) dalSaveUploadFile(po *UploadFileModel) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.db.Update(func(txn *badger.Txn) error {
+		if err := txn.Set(r.keyUploadPath(po.Path), po.bytes()); err != nil {
+			return err
+		}
+		return txn.Set(r.keyUploadHash(po.Hash), po.bytes())
+	})
+}
+
+// dalGetUploadFile returns nil if the path is not uploaded
+func (r *uploadCommand) dalGetUploadFile(path string) (*UploadFileModel, error) {
+	return r.getUploadFile(r.keyUploadPath(path))
+}
+
+// dalGetUploadHash returns nil if no file with the hash is uploaded
+func (r *uploadCommand) dalGetUploadHash(hash string) (*UploadFileModel, error) {
+	return r.getUploadFile(r.keyUploadHash(hash))
+}
+
+func (r *uploadCommand) getUploadFile(key []byte) (*UploadFileModel, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var po *UploadFileModel
+	err := r.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return nil
+			}
+			return err
+		}
+		val, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		po = new(UploadFileModel)
+		return json.Unmarshal(val, po)
+	})
+	return po, err
+}
+
+// dalGetUploadFiles returns all the uploaded files
+func (r *uploadCommand) dalGetUploadFiles() ([]*UploadFileModel, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var pos []*UploadFileModel
+	err := r.db.View(func(txn *badger.Txn) error {
+		prefix := r.keyUploadPath("")
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			val, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			po := new(UploadFileModel)
+			if err := json.Unmarshal(val, po); err != nil {
+				return err
+			}
+			pos = append(pos, po)
+		}
+		return nil
+	})
+	return pos, err
+}
+
+// dalDeleteUploadFile forgets the uploaded file, the hash is kept if it is saved by another file
+func (r *uploadCommand) dalDeleteUploadFile(po *UploadFileModel) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.db.Update(func(txn *badger.Txn) error {
+		if err := txn.Delete(r.keyUploadPath(po.Path)); err != nil {
+			return err
+		}
+		item, err := txn.Get(r.keyUploadHash(po.Hash))
+		if err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return nil
+			}
+			return err
+		}
+		val, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		hashPo := new(UploadFileModel)
+		if err := json.Unmarshal(val, hashPo); err != nil {
+			return err
+		}
+		if hashPo.Path != po.Path {
+			return nil
+		}
+		return txn.Delete(r.keyUploadHash(po.Hash))
+	})
+}
+
+func (r *uploadCommand) keyUploadPath(path string) []byte {
+	return []byte("upload_path_" + filepath.ToSlash(path))
+}
+
+func (r *uploadCommand) keyUploadHash(hash string) []byte {
+	return []byte("upload_hash_" + hash)
+}
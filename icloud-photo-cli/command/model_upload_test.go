@@ -0,0 +1,66 @@
+package command
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+
+	"github.com/chyroc/icloudgo"
+	"github.com/chyroc/icloudgo/icloudtest"
+)
+
+func TestOpenUploadDB(t *testing.T) {
+	server := icloudtest.NewServer()
+	defer server.Close()
+	cli, err := icloudgo.New(server.ClientOption(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	// the file uploaded by the older version is saved in badger.db
+	legacy, err := badger.Open(badger.DefaultOptions(cli.ConfigPath("badger.db")).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	po := &UploadFileModel{Path: "/photos/a.jpg", Hash: "hash", Size: 1, AssetID: "asset"}
+	if err := (&uploadCommand{db: legacy, lock: &sync.Mutex{}}).dalSaveUploadFile(po); err != nil {
+		t.Fatal(err)
+	}
+	if err := legacy.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// upload moves it to upload.db, and sync opens the same upload.db
+	db, err := openUploadDB(cli, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := (&uploadCommand{db: db, lock: &sync.Mutex{}}).dalGetUploadHash("hash"); err != nil {
+		t.Fatal(err)
+	} else if got == nil || got.AssetID != "asset" {
+		t.Fatalf("moved file: %+v", got)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if legacy, err = badger.Open(badger.DefaultOptions(cli.ConfigPath("badger.db")).WithLogger(nil)); err != nil {
+		t.Fatal(err)
+	}
+	defer legacy.Close()
+	if got, err := (&uploadCommand{db: legacy, lock: &sync.Mutex{}}).dalGetUploadFile(po.Path); err != nil {
+		t.Fatal(err)
+	} else if got != nil {
+		t.Fatalf("the file is left in badger.db: %+v", got)
+	}
+	if db, err = openUploadDB(cli, legacy); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if got, err := (&uploadCommand{db: db, lock: &sync.Mutex{}}).dalGetUploadFile(po.Path); err != nil {
+		t.Fatal(err)
+	} else if got == nil {
+		t.Fatal("the file is lost in upload.db")
+	}
+}
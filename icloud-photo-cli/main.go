@@ -28,6 +28,25 @@ func main() {
 				Flags:       command.NewUploadFlag(),
 				Action:      command.Upload,
 			},
+			{
+				Name:        "sync",
+				Aliases:     []string{"s"},
+				Description: "sync the photos between the output dir and icloud in both directions",
+				Flags:       command.NewSyncFlag(),
+				Action:      command.Sync,
+			},
+			{
+				Name:        "drive",
+				Description: "manage the files of icloud drive, the paths start from the root, example: /Documents/tax/2024.pdf",
+				Subcommands: command.NewDriveCommands(),
+			},
+			{
+				Name:        "verify",
+				Aliases:     []string{"v"},
+				Description: "verify the downloaded photos, re-download the missing or corrupted ones",
+				Flags:       command.NewVerifyFlag(),
+				Action:      command.Verify,
+			},
 			{
 				Name:        "list-db",
 				Aliases:     []string{"ld"},
@@ -9,18 +9,43 @@ func New(option *ClientOption) (*Client, error) {
 }
 
 type (
-	TextGetter   func(appleID string) (string, error)
-	Client       = internal.Client
-	ClientOption = internal.ClientOption
-	Error        = internal.Error
-	PhotoAlbum   = internal.PhotoAlbum
-	PhotoAsset   = internal.PhotoAsset
-	PhotoService = internal.PhotoService
+	TextGetter        func(appleID string) (string, error)
+	Client            = internal.Client
+	ClientOption      = internal.ClientOption
+	ClientEndpoint    = internal.ClientEndpoint
+	RetryPolicy       = internal.RetryPolicy
+	Error             = internal.Error
+	PhotoAlbum        = internal.PhotoAlbum
+	PhotoAsset        = internal.PhotoAsset
+	PhotoAssetChange  = internal.PhotoAssetChange
+	PhotoModifyResult = internal.PhotoModifyResult
+	PhotoUploadOption = internal.PhotoUploadOption
+	PhotoService      = internal.PhotoService
+	PhotoChanges      = internal.PhotoChanges
+	PhotoLocation     = internal.PhotoLocation
+	PhotoQuery        = internal.PhotoQuery
+	PhotoQueryFilter  = internal.PhotoQueryFilter
+	PhotoQueryValue   = internal.PhotoQueryValue
+	PhotoQuerySort    = internal.PhotoQuerySort
+	PhotoQueryResult  = internal.PhotoQueryResult
+	DriveService      = internal.DriveService
+	DriveFolder       = internal.DriveFolder
+	DriveWalkFunc     = internal.DriveWalkFunc
+	DriveFS           = internal.DriveFS
+	PhotoFS           = internal.PhotoFS
 )
 
 var (
 	ErrValidateCodeWrong = internal.ErrValidateCodeWrong
 	ErrPhotosIterateEnd  = internal.ErrPhotosIterateEnd
+	ErrSyncTokenExpired  = internal.ErrSyncTokenExpired
+
+	ErrChecksumMismatch    = internal.ErrChecksumMismatch
+	ErrChecksumUnsupported = internal.ErrChecksumUnsupported
+
+	ErrDriveEtagConflict = internal.ErrDriveEtagConflict
+
+	DefaultRetryPolicy = internal.DefaultRetryPolicy
 )
 
 const (
@@ -37,6 +62,11 @@ const (
 	AlbumNameHidden          = internal.AlbumNameHidden
 )
 
+const (
+	DriveRootID  = internal.DriveRootID
+	DriveTrashID = internal.DriveTrashID
+)
+
 type PhotoVersion = internal.PhotoVersion
 
 const (
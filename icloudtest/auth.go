@@ -0,0 +1,151 @@
+package icloudtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+const webAuthCookie = "X-APPLE-WEBAUTH-TOKEN"
+
+func (s *Server) serveAuth(w http.ResponseWriter, req *http.Request, path string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	switch path {
+	case "/signin":
+		body := struct {
+			AccountName string   `json:"accountName"`
+			Password    string   `json:"password"`
+			TrustTokens []string `json:"trustTokens"`
+		}{}
+		_ = json.NewDecoder(req.Body).Decode(&body)
+		if body.AccountName != s.AppleID || body.Password != s.Password {
+			writeJSON(w, http.StatusUnauthorized, serviceError("-20101", "Your Apple ID or password was incorrect."))
+			return
+		}
+
+		s.sessionID++
+		s.sessionToken = fmt.Sprintf("session-token-%d", s.sessionID)
+		trusted := false
+		for _, v := range body.TrustTokens {
+			if v != "" && v == s.trustToken {
+				trusted = true
+			}
+		}
+		if !trusted {
+			s.trustToken = ""
+		}
+		s.writeSessionHeaders(w)
+		writeJSON(w, http.StatusOK, map[string]any{"authType": "hsa2"})
+	case "/verify/trusteddevice/securitycode":
+		body := struct {
+			SecurityCode struct {
+				Code string `json:"code"`
+			} `json:"securityCode"`
+		}{}
+		_ = json.NewDecoder(req.Body).Decode(&body)
+		if body.SecurityCode.Code != s.TwoFACode {
+			writeJSON(w, http.StatusBadRequest, serviceError("-21669", "Incorrect verification code."))
+			return
+		}
+		s.writeSessionHeaders(w)
+		w.WriteHeader(http.StatusNoContent)
+	case "/2sv/trust":
+		s.trustToken = fmt.Sprintf("trust-token-%d", s.sessionID)
+		s.writeSessionHeaders(w)
+		w.Header().Set("X-Apple-TwoSV-Trust-Token", s.trustToken)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "not found: " + path})
+	}
+}
+
+func (s *Server) serveSetup(w http.ResponseWriter, req *http.Request, path string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	switch path {
+	case "/accountLogin":
+		body := struct {
+			DsWebAuthToken string `json:"dsWebAuthToken"`
+			AppleID        string `json:"apple_id"`
+			Password       string `json:"password"`
+		}{}
+		_ = json.NewDecoder(req.Body).Decode(&body)
+		if s.sessionToken == "" || body.DsWebAuthToken != s.sessionToken {
+			if body.AppleID != s.AppleID || body.Password != s.Password {
+				writeJSON(w, http.StatusUnauthorized, map[string]any{"success": false, "error": "Invalid global session"})
+				return
+			}
+		}
+		s.webAuthToken = fmt.Sprintf("webauth-%d", s.nextVersion())
+		http.SetCookie(w, &http.Cookie{Name: webAuthCookie, Value: s.webAuthToken, Path: "/"})
+		writeJSON(w, http.StatusOK, s.validateData())
+	case "/validate":
+		if !s.isWebAuth(req) {
+			writeJSON(w, http.StatusUnauthorized, map[string]any{"success": false, "error": "Missing X-APPLE-WEBAUTH-TOKEN cookie"})
+			return
+		}
+		writeJSON(w, http.StatusOK, s.validateData())
+	case "/listDevices":
+		writeJSON(w, http.StatusOK, map[string]any{"devices": []any{}})
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "not found: " + path})
+	}
+}
+
+func (s *Server) checkWebAuth(w http.ResponseWriter, req *http.Request) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !s.isWebAuth(req) {
+		writeJSON(w, http.StatusMisdirectedRequest, map[string]any{"success": false, "error": "Authentication required"})
+		return false
+	}
+	return true
+}
+
+// isWebAuth must be called with lock
+func (s *Server) isWebAuth(req *http.Request) bool {
+	cookie, err := req.Cookie(webAuthCookie)
+	return err == nil && s.webAuthToken != "" && cookie.Value == s.webAuthToken
+}
+
+// writeSessionHeaders must be called with lock
+func (s *Server) writeSessionHeaders(w http.ResponseWriter) {
+	w.Header().Set("X-Apple-Session-Token", s.sessionToken)
+	w.Header().Set("X-Apple-ID-Session-Id", fmt.Sprintf("session-id-%d", s.sessionID))
+	w.Header().Set("X-Apple-ID-Account-Country", "USA")
+	w.Header().Set("scnt", fmt.Sprintf("scnt-%d", s.sessionID))
+}
+
+// validateData must be called with lock
+func (s *Server) validateData() map[string]any {
+	return map[string]any{
+		"dsInfo": map[string]any{
+			"dsid":       "1",
+			"appleId":    s.AppleID,
+			"hsaVersion": 2,
+			"hsaEnabled": true,
+		},
+		"hsaChallengeRequired": false,
+		"hsaTrustedBrowser":    s.trustToken != "",
+		"webservices":          s.webservices(),
+		"apps":                 map[string]any{},
+	}
+}
+
+func serviceError(code, title string) map[string]any {
+	return map[string]any{
+		"service_errors": []any{map[string]any{"code": code, "title": title, "message": title}},
+		"hasError":       true,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, data any) {
+	bs, _ := json.Marshal(data)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(bs)
+}
@@ -0,0 +1,69 @@
+package icloudtest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"sort"
+	"time"
+)
+
+// encodeBplist encodes the dict to binary property list(bplist00), values can be float64, time.Time or string.
+func encodeBplist(dict map[string]any) []byte {
+	keys := make([]string, 0, len(dict))
+	for k := range dict {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	// object 0 is the dict, then the keys, then the values
+	var objects [][]byte
+	dictObject := []byte{0xD0 | byte(len(keys))}
+	for i := range keys {
+		dictObject = append(dictObject, byte(1+i))
+	}
+	for i := range keys {
+		dictObject = append(dictObject, byte(1+len(keys)+i))
+	}
+	objects = append(objects, dictObject)
+	for _, k := range keys {
+		objects = append(objects, append([]byte{0x50 | byte(len(k))}, k...))
+	}
+	for _, k := range keys {
+		switch v := dict[k].(type) {
+		case float64:
+			objects = append(objects, appendUint64([]byte{0x23}, math.Float64bits(v)))
+		case time.Time:
+			seconds := v.Sub(time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)).Seconds()
+			objects = append(objects, appendUint64([]byte{0x33}, math.Float64bits(seconds)))
+		case string:
+			objects = append(objects, append([]byte{0x50 | byte(len(v))}, v...))
+		}
+	}
+
+	buf := bytes.NewBufferString("bplist00")
+	offsets := make([]uint32, 0, len(objects))
+	for _, object := range objects {
+		offsets = append(offsets, uint32(buf.Len()))
+		buf.Write(object)
+	}
+	offsetTableOffset := uint64(buf.Len())
+	for _, offset := range offsets {
+		_ = binary.Write(buf, binary.BigEndian, offset)
+	}
+
+	trailer := make([]byte, 32)
+	trailer[6] = 4 // offset int size
+	trailer[7] = 1 // object ref size
+	binary.BigEndian.PutUint64(trailer[8:], uint64(len(objects)))
+	binary.BigEndian.PutUint64(trailer[16:], 0)
+	binary.BigEndian.PutUint64(trailer[24:], offsetTableOffset)
+	buf.Write(trailer)
+	return buf.Bytes()
+}
+
+func appendUint64(bs []byte, v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return append(bs, b...)
+}
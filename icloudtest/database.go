@@ -0,0 +1,573 @@
+package icloudtest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const ckDatabasePath = "/ckdatabasews/database/1/com.apple.photos.cloud/production/private"
+
+type queryFilter struct {
+	FieldName  string `json:"fieldName"`
+	Comparator string `json:"comparator"`
+	FieldValue struct {
+		Value any    `json:"value"`
+		Type  string `json:"type"`
+	} `json:"fieldValue"`
+}
+
+type queryBody struct {
+	Query struct {
+		RecordType string         `json:"recordType"`
+		FilterBy   []*queryFilter `json:"filterBy"`
+	} `json:"query"`
+	ResultsLimit int `json:"resultsLimit"`
+}
+
+type modifyOperation struct {
+	OperationType string `json:"operationType"`
+	Record        struct {
+		RecordName      string                     `json:"recordName"`
+		RecordType      string                     `json:"recordType"`
+		RecordChangeTag string                     `json:"recordChangeTag"`
+		Fields          map[string]json.RawMessage `json:"fields"`
+	} `json:"record"`
+}
+
+func (s *Server) serveDatabase(w http.ResponseWriter, req *http.Request, path string) {
+	bs, _ := io.ReadAll(req.Body)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	switch path {
+	case "/records/query":
+		body := new(queryBody)
+		_ = json.Unmarshal(bs, body)
+		writeJSON(w, http.StatusOK, map[string]any{
+			"records":   s.queryRecords(body),
+			"syncToken": s.syncToken(s.version),
+		})
+	case "/internal/records/query/batch":
+		body := struct {
+			Batch []*queryBody `json:"batch"`
+		}{}
+		_ = json.Unmarshal(bs, &body)
+		var batch []any
+		for _, query := range body.Batch {
+			batch = append(batch, map[string]any{"records": s.countRecords(query)})
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"batch": batch})
+	case "/records/lookup":
+		body := struct {
+			Records []struct {
+				RecordName string `json:"recordName"`
+			} `json:"records"`
+		}{}
+		_ = json.Unmarshal(bs, &body)
+		var records []any
+		for _, v := range body.Records {
+			records = append(records, s.lookupRecord(v.RecordName))
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"records": records})
+	case "/records/modify":
+		body := struct {
+			Operations []*modifyOperation `json:"operations"`
+		}{}
+		_ = json.Unmarshal(bs, &body)
+		var records []any
+		for _, op := range body.Operations {
+			records = append(records, s.modifyRecord(op))
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"records": records})
+	case "/changes/zone":
+		body := struct {
+			Zones []struct {
+				SyncToken string `json:"syncToken"`
+			} `json:"zones"`
+			ResultsLimit int `json:"resultsLimit"`
+		}{}
+		_ = json.Unmarshal(bs, &body)
+		syncToken := ""
+		if len(body.Zones) > 0 {
+			syncToken = body.Zones[0].SyncToken
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"zones": []any{s.zoneChanges(syncToken, body.ResultsLimit)}})
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "not found: " + path})
+	}
+}
+
+func (s *Server) serveUpload(w http.ResponseWriter, req *http.Request) {
+	data, err := io.ReadAll(req.Body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	}
+	filename := req.URL.Query().Get("filename")
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, photo := range s.photos {
+		if bytes.Equal(photo.Data, data) {
+			writeJSON(w, http.StatusOK, map[string]any{"isDuplicate": true})
+			return
+		}
+	}
+	photo := s.addPhoto(filename, data, time.Now())
+	writeJSON(w, http.StatusOK, map[string]any{
+		"isDuplicate": false,
+		"records": []any{
+			map[string]any{"recordName": photo.ID, "recordType": "CPLMaster"},
+			map[string]any{"recordName": photo.AssetID, "recordType": "CPLAsset"},
+		},
+	})
+}
+
+// queryRecords must be called with lock
+func (s *Server) queryRecords(body *queryBody) []any {
+	switch body.Query.RecordType {
+	case "CheckIndexingState":
+		return []any{map[string]any{
+			"recordName": "_",
+			"recordType": "CheckIndexingState",
+			"fields": map[string]any{
+				"progress": map[string]any{"value": 100, "type": "INT64"},
+				"state":    map[string]any{"value": "FINISHED", "type": "STRING"},
+			},
+		}}
+	case "CPLAlbumByPositionLive":
+		records := []any{map[string]any{"recordName": "----Root-Folder----", "recordType": "CPLAlbum", "fields": map[string]any{}}}
+		for _, album := range s.albums {
+			records = append(records, s.albumRecord(album))
+		}
+		return records
+	}
+
+	filters := map[string]any{}
+	for _, v := range body.Query.FilterBy {
+		filters[v.FieldName] = v.FieldValue.Value
+	}
+	var photos []*Photo
+	for _, photo := range s.listPhotos(body.Query.RecordType, filters) {
+		if matchQueryFilters(photo, body.Query.FilterBy) {
+			photos = append(photos, photo)
+		}
+	}
+
+	startRank := int(toInt64(filters["startRank"]))
+	limit := body.ResultsLimit
+	if limit <= 0 {
+		limit = 100
+	}
+	var page []*Photo
+	if filters["direction"] == "DESCENDING" {
+		for i := startRank; i >= 0 && i < len(photos) && len(page) < limit; i-- {
+			page = append(page, photos[i])
+		}
+	} else {
+		for i := startRank; i >= 0 && i < len(photos) && len(page) < limit; i++ {
+			page = append(page, photos[i])
+		}
+	}
+
+	records := []any{}
+	for _, photo := range page {
+		records = append(records, s.assetRecord(photo), s.masterRecord(photo))
+	}
+	return records
+}
+
+// countRecords must be called with lock
+func (s *Server) countRecords(body *queryBody) []any {
+	var records []any
+	for _, filter := range body.Query.FilterBy {
+		if filter.FieldName != "indexCountID" {
+			continue
+		}
+		values, _ := filter.FieldValue.Value.([]any)
+		for _, v := range values {
+			objType, _ := v.(string)
+			listType, filters := objTypeToListType(objType)
+			records = append(records, map[string]any{
+				"recordName": objType,
+				"recordType": "HyperionIndexCountLookup",
+				"fields": map[string]any{
+					"itemCount": map[string]any{"value": len(s.listPhotos(listType, filters)), "type": "INT64"},
+				},
+			})
+		}
+	}
+	return records
+}
+
+// listPhotos must be called with lock
+func (s *Server) listPhotos(listType string, filters map[string]any) []*Photo {
+	var match func(p *Photo) bool
+	sortByAssetDate := true
+	switch listType {
+	case "CPLAssetAndMasterByAddedDate":
+		sortByAssetDate = false
+		match = func(p *Photo) bool { return !p.IsDeleted && !p.IsHidden }
+	case "CPLAssetAndMasterByAssetDate", "CPLAssetAndMasterByAssetDateWithoutHiddenOrDeleted":
+		match = func(p *Photo) bool { return !p.IsDeleted && !p.IsHidden }
+	case "CPLAssetAndMasterInSmartAlbumByAssetDate":
+		match = func(p *Photo) bool {
+			if p.IsDeleted || p.IsHidden {
+				return false
+			}
+			switch filters["smartAlbum"] {
+			case "FAVORITE":
+				return p.IsFavorite
+			case "VIDEO":
+				return strings.Contains(p.itemType(), "movie") || strings.Contains(p.itemType(), "mpeg")
+			case "LIVE":
+				return len(p.LiveData) > 0
+			case "SCREENSHOT":
+				return p.itemType() == "public.png"
+			}
+			return false
+		}
+	case "CPLAssetAndMasterDeletedByExpungedDate":
+		match = func(p *Photo) bool { return p.IsDeleted }
+	case "CPLAssetAndMasterHiddenByAssetDate":
+		match = func(p *Photo) bool { return p.IsHidden && !p.IsDeleted }
+	case "CPLContainerRelationLiveByAssetDate":
+		album := s.findAlbum(fmt.Sprintf("%v", filters["parentId"]))
+		if album == nil || album.IsDeleted {
+			return nil
+		}
+		ids := map[string]bool{}
+		for _, id := range album.PhotoIDs {
+			ids[id] = true
+		}
+		match = func(p *Photo) bool { return ids[p.ID] && !p.IsDeleted }
+	default:
+		return nil
+	}
+
+	var photos []*Photo
+	for _, photo := range s.photos {
+		if match(photo) {
+			photos = append(photos, photo)
+		}
+	}
+	if sortByAssetDate {
+		sort.SliceStable(photos, func(i, j int) bool {
+			return photos[i].AssetDate.Before(photos[j].AssetDate)
+		})
+	}
+	return photos
+}
+
+// matchQueryFilters checks the filters of the asset fields, the filters of the list(startRank, direction, ...) are ignored
+func matchQueryFilters(photo *Photo, filters []*queryFilter) bool {
+	for _, filter := range filters {
+		var value any
+		switch filter.FieldName {
+		case "assetDate":
+			value = photo.AssetDate.UnixMilli()
+		case "addedDate":
+			value = photo.AddedDate.UnixMilli()
+		case "isFavorite":
+			value = int64(boolToInt(photo.IsFavorite))
+		case "isHidden":
+			value = int64(boolToInt(photo.IsHidden))
+		case "itemType":
+			value = photo.itemType()
+		default:
+			continue
+		}
+		if !compareQueryValue(value, filter.Comparator, filter.FieldValue.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+func compareQueryValue(value any, comparator string, expect any) bool {
+	if comparator == "IN" || comparator == "NOT_IN" {
+		list, _ := expect.([]any)
+		found := false
+		for _, v := range list {
+			if fmt.Sprintf("%v", v) == fmt.Sprintf("%v", value) {
+				found = true
+			}
+		}
+		return found == (comparator == "IN")
+	}
+
+	cmp := strings.Compare(fmt.Sprintf("%v", value), fmt.Sprintf("%v", expect))
+	if v, ok := value.(int64); ok {
+		e := toInt64(expect)
+		cmp = 0
+		if v < e {
+			cmp = -1
+		} else if v > e {
+			cmp = 1
+		}
+	}
+	switch comparator {
+	case "EQUALS":
+		return cmp == 0
+	case "NOT_EQUALS":
+		return cmp != 0
+	case "LESS_THAN":
+		return cmp < 0
+	case "LESS_THAN_OR_EQUALS":
+		return cmp <= 0
+	case "GREATER_THAN":
+		return cmp > 0
+	case "GREATER_THAN_OR_EQUALS":
+		return cmp >= 0
+	case "BEGINS_WITH":
+		return strings.HasPrefix(fmt.Sprintf("%v", value), fmt.Sprintf("%v", expect))
+	}
+	return false
+}
+
+// lookupRecord must be called with lock
+func (s *Server) lookupRecord(recordName string) any {
+	if photo := s.findPhoto(recordName); photo != nil {
+		if photo.ID == recordName {
+			return s.masterRecord(photo)
+		}
+		return s.assetRecord(photo)
+	}
+	if album := s.findAlbum(recordName); album != nil {
+		return s.albumRecord(album)
+	}
+	return recordError(recordName, "NOT_FOUND", "record not found")
+}
+
+// modifyRecord must be called with lock
+func (s *Server) modifyRecord(op *modifyOperation) any {
+	switch op.Record.RecordType {
+	case "CPLAlbum":
+		return s.modifyAlbum(op)
+	case "CPLContainerRelation":
+		return s.modifyRelation(op)
+	}
+
+	recordName := op.Record.RecordName
+	photo := s.findPhoto(recordName)
+	if photo == nil {
+		return recordError(recordName, "NOT_FOUND", "record not found")
+	} else if op.OperationType != "update" || photo.AssetID != recordName {
+		return recordError(recordName, "BAD_REQUEST", "unsupported operation")
+	} else if op.Record.RecordChangeTag != changeTag(photo.version) {
+		return recordError(recordName, "CONFLICT", "record was changed")
+	}
+
+	for name, raw := range op.Record.Fields {
+		value := fieldValue(raw)
+		switch name {
+		case "isDeleted":
+			photo.IsDeleted = toInt64(value) == 1
+		case "isFavorite":
+			photo.IsFavorite = toInt64(value) == 1
+		case "isHidden":
+			photo.IsHidden = toInt64(value) == 1
+		case "assetDate":
+			photo.AssetDate = time.UnixMilli(toInt64(value))
+		case "captionEnc":
+			bs, _ := base64.StdEncoding.DecodeString(fmt.Sprintf("%v", value))
+			photo.Caption = string(bs)
+		case "isExpunged":
+			if toInt64(value) == 1 {
+				s.expungePhoto(photo.ID)
+				return map[string]any{"recordName": recordName, "recordType": "CPLAsset", "recordChangeTag": changeTag(s.version), "deleted": true}
+			}
+		}
+	}
+	photo.version = s.nextVersion()
+	return s.assetRecord(photo)
+}
+
+// modifyAlbum must be called with lock, it creates or updates the album and folder
+func (s *Server) modifyAlbum(op *modifyOperation) any {
+	recordName := op.Record.RecordName
+	album := s.findAlbum(recordName)
+	switch op.OperationType {
+	case "create", "forceReplace":
+		if album != nil && op.OperationType == "create" {
+			return recordError(recordName, "CONFLICT", "record already exists")
+		}
+		if album == nil {
+			album = &Album{ID: recordName}
+			s.albums = append(s.albums, album)
+		}
+	case "update", "forceUpdate":
+		if album == nil {
+			return recordError(recordName, "NOT_FOUND", "record not found")
+		}
+		if op.OperationType == "update" && op.Record.RecordChangeTag != changeTag(album.version) {
+			return recordError(recordName, "CONFLICT", "record was changed")
+		}
+	default:
+		return recordError(recordName, "BAD_REQUEST", "unsupported operation")
+	}
+
+	for name, raw := range op.Record.Fields {
+		value := fieldValue(raw)
+		switch name {
+		case "albumNameEnc":
+			bs, _ := base64.StdEncoding.DecodeString(fmt.Sprintf("%v", value))
+			album.Name = string(bs)
+		case "albumType":
+			album.IsFolder = toInt64(value) == 3
+		case "parentId":
+			album.ParentID = strings.TrimPrefix(fmt.Sprintf("%v", value), "----Root-Folder----")
+		case "isDeleted":
+			album.IsDeleted = toInt64(value) == 1
+		}
+	}
+	album.version = s.nextVersion()
+	return s.albumRecord(album)
+}
+
+// modifyRelation must be called with lock, it adds or removes(isDeleted=1) the photo of the album
+func (s *Server) modifyRelation(op *modifyOperation) any {
+	recordName := op.Record.RecordName
+	fields := map[string]any{}
+	for name, raw := range op.Record.Fields {
+		fields[name] = fieldValue(raw)
+	}
+	photo := s.findPhoto(fmt.Sprintf("%v", fields["itemId"]))
+	album := s.findAlbum(fmt.Sprintf("%v", fields["containerId"]))
+	if photo == nil || album == nil || album.IsFolder {
+		return recordError(recordName, "NOT_FOUND", "photo or album not found")
+	}
+
+	var photoIDs []string
+	for _, id := range album.PhotoIDs {
+		if id != photo.ID {
+			photoIDs = append(photoIDs, id)
+		}
+	}
+	if toInt64(fields["isDeleted"]) != 1 {
+		photoIDs = append(photoIDs, photo.ID)
+	}
+	// the relation is a record of its own, the album record is not changed
+	album.PhotoIDs = photoIDs
+
+	return map[string]any{
+		"recordName":      recordName,
+		"recordType":      "CPLContainerRelation",
+		"recordChangeTag": changeTag(s.nextVersion()),
+		"zoneID":          primarySyncZone(),
+	}
+}
+
+func fieldValue(raw json.RawMessage) any {
+	field := struct {
+		Value any `json:"value"`
+	}{}
+	_ = json.Unmarshal(raw, &field)
+	return field.Value
+}
+
+func recordError(recordName, code, reason string) map[string]any {
+	return map[string]any{"recordName": recordName, "serverErrorCode": code, "reason": reason}
+}
+
+// zoneChanges must be called with lock
+func (s *Server) zoneChanges(syncToken string, limit int) map[string]any {
+	since, _ := strconv.ParseInt(strings.TrimPrefix(syncToken, "v"), 10, 64)
+	if limit <= 0 {
+		limit = 200
+	}
+
+	type change struct {
+		version int64
+		records []any
+	}
+	var changes []*change
+	for _, photo := range s.photos {
+		if photo.version <= since {
+			continue
+		}
+		records := []any{s.assetRecord(photo)}
+		if photo.createdVersion > since {
+			records = append(records, s.masterRecord(photo))
+		}
+		changes = append(changes, &change{version: photo.version, records: records})
+	}
+	for _, album := range s.albums {
+		if album.version > since {
+			changes = append(changes, &change{version: album.version, records: []any{s.albumRecord(album)}})
+		}
+	}
+	for _, v := range s.tombstones {
+		if v.version > since {
+			changes = append(changes, &change{version: v.version, records: []any{map[string]any{"recordName": v.recordName, "deleted": true}}})
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].version < changes[j].version
+	})
+
+	records := []any{}
+	version := s.version
+	moreComing := false
+	for i, v := range changes {
+		if len(records) > 0 && len(records)+len(v.records) > limit {
+			version = changes[i-1].version
+			moreComing = true
+			break
+		}
+		records = append(records, v.records...)
+	}
+
+	return map[string]any{
+		"records":    records,
+		"syncToken":  s.syncToken(version),
+		"moreComing": moreComing,
+		"zoneID":     primarySyncZone(),
+	}
+}
+
+func (s *Server) syncToken(version int64) string {
+	return fmt.Sprintf("v%d", version)
+}
+
+func objTypeToListType(objType string) (string, map[string]any) {
+	name, param, _ := strings.Cut(objType, ":")
+	switch name {
+	case "CPLAssetByAddedDate":
+		return "CPLAssetAndMasterByAddedDate", nil
+	case "CPLAssetInSmartAlbumByAssetDate":
+		return "CPLAssetAndMasterInSmartAlbumByAssetDate", map[string]any{"smartAlbum": strings.ToUpper(param)}
+	case "CPLAssetDeletedByExpungedDate":
+		return "CPLAssetAndMasterDeletedByExpungedDate", nil
+	case "CPLAssetHiddenByAssetDate":
+		return "CPLAssetAndMasterHiddenByAssetDate", nil
+	case "CPLContainerRelationNotDeletedByAssetDate":
+		return "CPLContainerRelationLiveByAssetDate", map[string]any{"parentId": param}
+	}
+	return "", nil
+}
+
+func toInt64(v any) int64 {
+	switch v := v.(type) {
+	case float64:
+		return int64(v)
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	case string:
+		i, _ := strconv.ParseInt(v, 10, 64)
+		return i
+	}
+	return 0
+}
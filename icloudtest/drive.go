@@ -0,0 +1,468 @@
+package icloudtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	DriveZone    = "com.apple.CloudDocs"
+	DriveRootID  = "FOLDER::" + DriveZone + "::root"
+	DriveTrashID = "TRASH_ROOT"
+)
+
+// DriveItem is a file or a folder of the fake iCloud Drive.
+type DriveItem struct {
+	ID           string // drivewsid, e.g. FILE::com.apple.CloudDocs::<DocID>
+	DocID        string // docwsid
+	ParentID     string // drivewsid of the parent folder, empty for the root, DriveTrashID if the item is in the trash
+	RestoreID    string // drivewsid of the parent folder before the item is moved to the trash
+	Name         string // name with the extension
+	IsFolder     bool
+	IsPackage    bool  // the package, e.g. a .pages document, is downloaded as the zip in Data
+	PackageSize  int64 // size of the package in the listing, it is not the size of the zip
+	Data         []byte
+	DateCreated  time.Time
+	DateModified time.Time
+
+	version int64
+}
+
+// driveContent is the content uploaded to the content url, it is added to a folder by update/documents
+type driveContent struct {
+	documentID string
+	data       []byte
+}
+
+// AddDriveFolder adds a folder to the parent folder, and returns a copy of it.
+func (s *Server) AddDriveFolder(name, parentID string) *DriveItem {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.addDriveItem(name, parentID, true, nil).clone()
+}
+
+// AddDriveFile adds a file to the parent folder, and returns a copy of it.
+func (s *Server) AddDriveFile(name, parentID string, data []byte) *DriveItem {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.addDriveItem(name, parentID, false, data).clone()
+}
+
+// AddDrivePackage adds a package to the parent folder, zip is its download, and returns a copy of it.
+func (s *Server) AddDrivePackage(name, parentID string, zip []byte, size int64) *DriveItem {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	item := s.addDriveItem(name, parentID, false, zip)
+	item.IsPackage = true
+	item.PackageSize = size
+	return item.clone()
+}
+
+// DriveItems returns copies of all the items, the root and the trash are not included.
+func (s *Server) DriveItems() []*DriveItem {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	res := make([]*DriveItem, 0, len(s.driveItems))
+	for _, item := range s.driveItems {
+		res = append(res, item.clone())
+	}
+	return res
+}
+
+// DriveItem returns a copy of the item, nil if not found.
+func (s *Server) DriveItem(id string) *DriveItem {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if item := s.findDriveItem(id); item != nil {
+		return item.clone()
+	}
+	return nil
+}
+
+func (s *Server) serveDriveWS(w http.ResponseWriter, req *http.Request, path string) {
+	bs, _ := io.ReadAll(req.Body)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	switch path {
+	case "/retrieveItemDetailsInFolders":
+		var body []struct {
+			Drivewsid string `json:"drivewsid"`
+		}
+		_ = json.Unmarshal(bs, &body)
+		res := []any{}
+		for _, v := range body {
+			folder := s.findDriveItem(v.Drivewsid)
+			if folder == nil || !folder.IsFolder {
+				res = append(res, map[string]any{"drivewsid": v.Drivewsid, "status": "ID_INVALID"})
+				continue
+			}
+			data := s.driveItemData(folder)
+			children := s.driveChildren(folder.ID)
+			items := []any{}
+			for _, child := range children {
+				if s.DriveListLimit > 0 && len(items) >= s.DriveListLimit {
+					break
+				}
+				items = append(items, s.driveItemData(child))
+			}
+			data["items"] = items
+			data["numberOfItems"] = len(children)
+			res = append(res, data)
+		}
+		writeJSON(w, http.StatusOK, res)
+	case "/retrieveItemDetails":
+		body := struct {
+			Items []struct {
+				Drivewsid string `json:"drivewsid"`
+			} `json:"items"`
+		}{}
+		_ = json.Unmarshal(bs, &body)
+		items := []any{}
+		for _, v := range body.Items {
+			if item := s.findDriveItem(v.Drivewsid); item != nil {
+				items = append(items, s.driveItemData(item))
+			} else {
+				items = append(items, map[string]any{"drivewsid": v.Drivewsid, "status": "ID_INVALID"})
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"items": items})
+	case "/createFolders":
+		body := struct {
+			DestinationDrivewsId string `json:"destinationDrivewsId"`
+			Folders              []struct {
+				Name string `json:"name"`
+			} `json:"folders"`
+		}{}
+		_ = json.Unmarshal(bs, &body)
+		if parent := s.findDriveItem(body.DestinationDrivewsId); parent == nil || !parent.IsFolder {
+			writeJSON(w, http.StatusNotFound, map[string]any{"error": "folder not found: " + body.DestinationDrivewsId})
+			return
+		}
+		folders := []any{}
+		for _, v := range body.Folders {
+			folders = append(folders, s.driveItemData(s.addDriveItem(v.Name, body.DestinationDrivewsId, true, nil)))
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"destinationDrivewsId": body.DestinationDrivewsId, "folders": folders})
+	case "/renameItems", "/moveItems", "/moveItemsToTrash", "/putBackItemsFromTrash", "/deleteItems":
+		body := struct {
+			DestinationDrivewsId string             `json:"destinationDrivewsId"`
+			Items                []*driveItemChange `json:"items"`
+		}{}
+		_ = json.Unmarshal(bs, &body)
+		items := []any{}
+		for _, v := range body.Items {
+			items = append(items, s.changeDriveItem(path, body.DestinationDrivewsId, v))
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"items": items})
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "not found: " + path})
+	}
+}
+
+type driveItemChange struct {
+	Drivewsid string  `json:"drivewsid"`
+	Etag      string  `json:"etag"`
+	Name      string  `json:"name"`
+	Extension *string `json:"extension"`
+}
+
+// changeDriveItem must be called with lock
+func (s *Server) changeDriveItem(action, destinationID string, change *driveItemChange) map[string]any {
+	status := func(status string) map[string]any {
+		return map[string]any{"drivewsid": change.Drivewsid, "status": status}
+	}
+	item := s.findDriveItem(change.Drivewsid)
+	if item == nil || item == s.driveRoot || item == s.driveTrash {
+		return status("ID_INVALID")
+	}
+	if change.Etag != driveEtag(item) {
+		return status("ETAG_CONFLICT")
+	}
+
+	switch action {
+	case "/renameItems":
+		item.Name = change.Name
+		if change.Extension != nil && *change.Extension != "" {
+			item.Name += "." + *change.Extension
+		}
+	case "/moveItems":
+		if destination := s.findDriveItem(destinationID); destination == nil || !destination.IsFolder || destination == s.driveTrash {
+			return status("ID_INVALID")
+		}
+		item.ParentID = destinationID
+	case "/moveItemsToTrash":
+		if item.ParentID == DriveTrashID {
+			return status("ID_INVALID")
+		}
+		item.RestoreID, item.ParentID = item.ParentID, DriveTrashID
+	case "/putBackItemsFromTrash":
+		if item.ParentID != DriveTrashID {
+			return status("ID_INVALID")
+		}
+		item.ParentID, item.RestoreID = item.RestoreID, ""
+		if s.findDriveItem(item.ParentID) == nil {
+			item.ParentID = DriveRootID
+		}
+	case "/deleteItems":
+		s.deleteDriveItem(item.ID)
+		return status("OK")
+	}
+	item.DateModified = time.Now().UTC().Truncate(time.Second)
+	item.version = s.nextVersion()
+	data := s.driveItemData(item)
+	data["status"] = "OK"
+	return data
+}
+
+// deleteDriveItem must be called with lock, the children of the folder are deleted too
+func (s *Server) deleteDriveItem(id string) {
+	for _, child := range s.driveChildren(id) {
+		s.deleteDriveItem(child.ID)
+	}
+	for i, item := range s.driveItems {
+		if item.ID == id {
+			s.driveItems = append(s.driveItems[:i], s.driveItems[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *Server) serveDocWS(w http.ResponseWriter, req *http.Request, path string) {
+	if documentID, ok := cutPrefix(path, "/content/"); ok {
+		s.serveDriveContent(w, req, documentID)
+		return
+	}
+
+	bs, _ := io.ReadAll(req.Body)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	switch {
+	case strings.HasSuffix(path, "/download/by_id"):
+		item := s.findDriveItemByDocID(req.URL.Query().Get("document_id"))
+		if item == nil || item.IsFolder {
+			writeJSON(w, http.StatusNotFound, map[string]any{"error": "document not found"})
+			return
+		}
+		tokenName := "data_token"
+		if item.IsPackage {
+			tokenName = "package_token"
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"document_id": item.DocID,
+			tokenName:     map[string]any{"url": s.URL + "/drivefiles/" + item.DocID, "token": item.DocID},
+		})
+	case strings.HasSuffix(path, "/upload/web"):
+		documentID := s.newID("document")
+		writeJSON(w, http.StatusOK, []any{map[string]any{
+			"document_id": documentID,
+			"url":         s.URL + "/docws/content/" + documentID,
+		}})
+	case strings.HasSuffix(path, "/update/documents"):
+		body := struct {
+			Command    string `json:"command"`
+			DocumentID string `json:"document_id"`
+			Path       struct {
+				StartingDocumentID string `json:"starting_document_id"`
+				Path               string `json:"path"`
+			} `json:"path"`
+			Data struct {
+				Receipt string `json:"receipt"`
+			} `json:"data"`
+		}{}
+		_ = json.Unmarshal(bs, &body)
+		content := s.driveContents[body.Data.Receipt]
+		parent := s.findDriveItemByDocID(body.Path.StartingDocumentID)
+		if body.Command != "add_file" || content == nil || content.documentID != body.DocumentID || parent == nil || !parent.IsFolder {
+			writeJSON(w, http.StatusOK, map[string]any{"results": []any{map[string]any{
+				"status": map[string]any{"status_code": 1, "error_message": "invalid update"},
+			}}})
+			return
+		}
+		delete(s.driveContents, body.Data.Receipt)
+		item := s.addDriveItem(body.Path.Path, parent.ID, false, content.data)
+		writeJSON(w, http.StatusOK, map[string]any{"results": []any{map[string]any{
+			"status":   map[string]any{"status_code": 0, "error_message": ""},
+			"document": map[string]any{"document_id": item.DocID, "name": item.Name, "size": len(item.Data)},
+		}}})
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "not found: " + path})
+	}
+}
+
+// serveDriveContent receives the multipart form of the upload
+func (s *Server) serveDriveContent(w http.ResponseWriter, req *http.Request, documentID string) {
+	file, _, err := req.FormFile(firstFormFile(req))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	receipt := s.newID("receipt")
+	s.driveContents[receipt] = &driveContent{documentID: documentID, data: data}
+	writeJSON(w, http.StatusOK, map[string]any{"singleFile": map[string]any{
+		"fileChecksum":      fingerprint(data),
+		"referenceChecksum": fingerprint(data),
+		"wrappingKey":       "key-" + documentID,
+		"size":              len(data),
+		"receipt":           receipt,
+	}})
+}
+
+func (s *Server) serveDriveFile(w http.ResponseWriter, req *http.Request, docID string) {
+	s.lock.Lock()
+	var item *DriveItem
+	if v := s.findDriveItemByDocID(docID); v != nil && !v.IsFolder {
+		item = v.clone()
+	}
+	s.lock.Unlock()
+
+	if item == nil {
+		writeJSON(w, http.StatusGone, map[string]any{"error": "resource gone"})
+		return
+	}
+	http.ServeContent(w, req, item.Name, item.DateModified, bytes.NewReader(item.Data))
+}
+
+// addDriveItem must be called with lock
+func (s *Server) addDriveItem(name, parentID string, isFolder bool, data []byte) *DriveItem {
+	now := time.Now().UTC().Truncate(time.Second)
+	docID := s.newID("doc")
+	itemType := "FILE"
+	if isFolder {
+		itemType = "FOLDER"
+	}
+	item := &DriveItem{
+		ID:           fmt.Sprintf("%s::%s::%s", itemType, DriveZone, docID),
+		DocID:        docID,
+		ParentID:     parentID,
+		Name:         name,
+		IsFolder:     isFolder,
+		Data:         append([]byte(nil), data...),
+		DateCreated:  now,
+		DateModified: now,
+		version:      s.nextVersion(),
+	}
+	s.driveItems = append(s.driveItems, item)
+	return item
+}
+
+// findDriveItem must be called with lock
+func (s *Server) findDriveItem(id string) *DriveItem {
+	if id == DriveRootID {
+		return s.driveRoot
+	}
+	if id == DriveTrashID {
+		return s.driveTrash
+	}
+	for _, item := range s.driveItems {
+		if item.ID == id {
+			return item
+		}
+	}
+	return nil
+}
+
+// findDriveItemByDocID must be called with lock
+func (s *Server) findDriveItemByDocID(docID string) *DriveItem {
+	if docID == s.driveRoot.DocID {
+		return s.driveRoot
+	}
+	for _, item := range s.driveItems {
+		if item.DocID == docID {
+			return item
+		}
+	}
+	return nil
+}
+
+// driveChildren must be called with lock
+func (s *Server) driveChildren(parentID string) []*DriveItem {
+	var res []*DriveItem
+	for _, item := range s.driveItems {
+		if item.ParentID == parentID {
+			res = append(res, item)
+		}
+	}
+	return res
+}
+
+// driveItemData must be called with lock, the name of the file is split into the name and the extension like iCloud
+func (s *Server) driveItemData(item *DriveItem) map[string]any {
+	data := map[string]any{
+		"drivewsid":   item.ID,
+		"docwsid":     item.DocID,
+		"zone":        DriveZone,
+		"name":        item.Name,
+		"parentId":    item.ParentID,
+		"etag":        driveEtag(item),
+		"dateCreated": item.DateCreated.Format(time.RFC3339),
+	}
+	if item.IsFolder {
+		data["type"] = "FOLDER"
+		data["directChildrenCount"] = len(s.driveChildren(item.ID))
+		return data
+	}
+	data["type"] = "FILE"
+	data["size"] = len(item.Data)
+	if item.IsPackage {
+		data["size"] = item.PackageSize
+	}
+	data["dateModified"] = item.DateModified.Format(time.RFC3339)
+	data["dateChanged"] = item.DateModified.Format(time.RFC3339)
+	if ext := path.Ext(item.Name); ext != "" && ext != item.Name {
+		data["name"] = strings.TrimSuffix(item.Name, ext)
+		data["extension"] = strings.TrimPrefix(ext, ".")
+	}
+	return data
+}
+
+func driveEtag(item *DriveItem) string {
+	return fmt.Sprintf("etag-%d", item.version)
+}
+
+func (item *DriveItem) clone() *DriveItem {
+	res := *item
+	res.Data = append([]byte(nil), item.Data...)
+	return &res
+}
+
+func firstFormFile(req *http.Request) string {
+	if err := req.ParseMultipartForm(32 << 20); err != nil {
+		return ""
+	}
+	for name := range req.MultipartForm.File {
+		return name
+	}
+	return ""
+}
+
+func cutPrefix(s, prefix string) (string, bool) {
+	if !strings.HasPrefix(s, prefix) {
+		return s, false
+	}
+	return s[len(prefix):], true
+}
@@ -0,0 +1,409 @@
+package icloudtest
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Photo is an asset of the fake photo library, it is rendered as a CPLMaster and a CPLAsset record.
+type Photo struct {
+	ID         string // CPLMaster record name
+	AssetID    string // CPLAsset record name
+	Filename   string
+	Data       []byte
+	LiveData   []byte // video of the live photo
+	AssetDate  time.Time
+	AddedDate  time.Time
+	IsFavorite bool
+	IsHidden   bool
+	IsDeleted  bool
+	Caption    string
+	Location   *Location
+
+	version        int64
+	createdVersion int64
+}
+
+// Album is a user album of the fake photo library, the folder is an album contains other albums.
+type Album struct {
+	ID        string
+	Name      string
+	ParentID  string // ID of the folder, empty if the album is at the top
+	PhotoIDs  []string
+	IsFolder  bool
+	IsDeleted bool
+
+	version int64
+}
+
+// Location is the place where the photo was taken, it is rendered as the locationEnc binary plist.
+type Location struct {
+	Latitude  float64
+	Longitude float64
+	Altitude  float64
+	Timestamp time.Time
+}
+
+type tombstone struct {
+	recordName string
+	version    int64
+}
+
+// AddPhoto adds a photo to the library, and returns a copy of it.
+func (s *Server) AddPhoto(filename string, data []byte, assetDate time.Time) *Photo {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.addPhoto(filename, data, assetDate).clone()
+}
+
+// AddLivePhoto adds a live photo with its video to the library, and returns a copy of it.
+func (s *Server) AddLivePhoto(filename string, data, video []byte, assetDate time.Time) *Photo {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	photo := s.addPhoto(filename, data, assetDate)
+	photo.LiveData = video
+	return photo.clone()
+}
+
+// AddAlbum adds a user album contains the photos, and returns a copy of it.
+func (s *Server) AddAlbum(name string, photoIDs ...string) *Album {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	album := &Album{
+		ID:       s.newID("album"),
+		Name:     name,
+		PhotoIDs: photoIDs,
+		version:  s.nextVersion(),
+	}
+	s.albums = append(s.albums, album)
+	return album.clone()
+}
+
+// AddFolder adds a folder in the parent folder, parentID is empty for the top folder, and returns a copy of it.
+func (s *Server) AddFolder(name, parentID string) *Album {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	folder := &Album{
+		ID:       s.newID("folder"),
+		Name:     name,
+		ParentID: parentID,
+		IsFolder: true,
+		version:  s.nextVersion(),
+	}
+	s.albums = append(s.albums, folder)
+	return folder.clone()
+}
+
+// SetAlbumParent moves the album or folder into the folder, parentID is empty for the top.
+func (s *Server) SetAlbumParent(id, parentID string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if album := s.findAlbum(id); album != nil {
+		album.ParentID = parentID
+		album.version = s.nextVersion()
+	}
+}
+
+// Photos returns copies of all photos, include the deleted ones.
+func (s *Server) Photos() []*Photo {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	res := make([]*Photo, 0, len(s.photos))
+	for _, v := range s.photos {
+		res = append(res, v.clone())
+	}
+	return res
+}
+
+// Photo returns a copy of the photo, nil if not found.
+func (s *Server) Photo(id string) *Photo {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if photo := s.findPhoto(id); photo != nil {
+		return photo.clone()
+	}
+	return nil
+}
+
+// Albums returns copies of all user albums.
+func (s *Server) Albums() []*Album {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	res := make([]*Album, 0, len(s.albums))
+	for _, v := range s.albums {
+		res = append(res, v.clone())
+	}
+	return res
+}
+
+// DeletePhoto moves the photo to the Recently Deleted album.
+func (s *Server) DeletePhoto(id string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if photo := s.findPhoto(id); photo != nil {
+		photo.IsDeleted = true
+		photo.version = s.nextVersion()
+	}
+}
+
+// SetPhotoLocation sets the location of the photo, nil removes it.
+func (s *Server) SetPhotoLocation(id string, location *Location) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if photo := s.findPhoto(id); photo != nil {
+		if location != nil {
+			v := *location
+			location = &v
+		}
+		photo.Location = location
+		photo.version = s.nextVersion()
+	}
+}
+
+// ExpungePhoto removes the photo from the library permanently.
+func (s *Server) ExpungePhoto(id string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.expungePhoto(id)
+}
+
+// expungePhoto must be called with lock
+func (s *Server) expungePhoto(id string) {
+	for i, photo := range s.photos {
+		if photo.ID == id {
+			s.photos = append(s.photos[:i], s.photos[i+1:]...)
+			version := s.nextVersion()
+			s.tombstones = append(s.tombstones, &tombstone{recordName: photo.ID, version: version}, &tombstone{recordName: photo.AssetID, version: version})
+			return
+		}
+	}
+}
+
+// addPhoto must be called with lock
+func (s *Server) addPhoto(filename string, data []byte, assetDate time.Time) *Photo {
+	photo := &Photo{
+		ID:        s.newID("master"),
+		AssetID:   s.newID("asset"),
+		Filename:  filename,
+		Data:      data,
+		AssetDate: assetDate,
+		AddedDate: time.Now(),
+		version:   s.nextVersion(),
+	}
+	photo.createdVersion = photo.version
+	s.photos = append(s.photos, photo)
+	return photo
+}
+
+// findPhoto must be called with lock, id can be the master or asset record name
+func (s *Server) findPhoto(id string) *Photo {
+	for _, photo := range s.photos {
+		if photo.ID == id || photo.AssetID == id {
+			return photo
+		}
+	}
+	return nil
+}
+
+// findAlbum must be called with lock
+func (s *Server) findAlbum(id string) *Album {
+	for _, album := range s.albums {
+		if album.ID == id {
+			return album
+		}
+	}
+	return nil
+}
+
+func (s *Server) serveAsset(w http.ResponseWriter, req *http.Request, path string) {
+	id, res, _ := strings.Cut(path, "/")
+
+	s.lock.Lock()
+	var photo *Photo
+	if v := s.findPhoto(id); v != nil {
+		photo = v.clone()
+	}
+	s.lock.Unlock()
+
+	if photo == nil {
+		writeJSON(w, http.StatusGone, map[string]any{"error": "resource gone"})
+		return
+	}
+
+	data := photo.Data
+	if res == "live" {
+		data = photo.LiveData
+	}
+	// ServeContent supports the Range header
+	http.ServeContent(w, req, photo.Filename, photo.AddedDate, bytes.NewReader(data))
+}
+
+func (p *Photo) clone() *Photo {
+	v := *p
+	if p.Location != nil {
+		location := *p.Location
+		v.Location = &location
+	}
+	return &v
+}
+
+func (a *Album) clone() *Album {
+	v := *a
+	v.PhotoIDs = append([]string{}, a.PhotoIDs...)
+	return &v
+}
+
+func (p *Photo) itemType() string {
+	switch strings.ToLower(filepath.Ext(p.Filename)) {
+	case ".mov":
+		return "com.apple.quicktime-movie"
+	case ".mp4":
+		return "public.mpeg-4"
+	case ".png":
+		return "public.png"
+	case ".heic":
+		return "public.heic"
+	default:
+		return "public.jpeg"
+	}
+}
+
+// masterRecord must be called with lock
+func (s *Server) masterRecord(p *Photo) map[string]any {
+	fields := map[string]any{
+		"filenameEnc": map[string]any{"value": base64.StdEncoding.EncodeToString([]byte(p.Filename)), "type": "ENCRYPTED_BYTES"},
+		"itemType":    map[string]any{"value": p.itemType(), "type": "STRING"},
+	}
+	setResource := func(prefix, fileType, res string, data []byte) {
+		fields[prefix+"Res"] = map[string]any{
+			"value": map[string]any{
+				"fileChecksum": fingerprint(data),
+				"size":         len(data),
+				"downloadURL":  fmt.Sprintf("%s/assets/%s/%s", s.URL, p.ID, res),
+			},
+			"type": "ASSETID",
+		}
+		fields[prefix+"FileType"] = map[string]any{"value": fileType, "type": "STRING"}
+		fields[prefix+"Fingerprint"] = map[string]any{"value": fingerprint(data), "type": "STRING"}
+	}
+	setResource("resOriginal", p.itemType(), "original", p.Data)
+	setResource("resJPEGMed", "public.jpeg", "original", p.Data)
+	setResource("resJPEGThumb", "public.jpeg", "original", p.Data)
+	if len(p.LiveData) > 0 {
+		setResource("resOriginalVidCompl", "com.apple.quicktime-movie", "live", p.LiveData)
+		setResource("resVidMed", "com.apple.quicktime-movie", "live", p.LiveData)
+		setResource("resVidSmall", "com.apple.quicktime-movie", "live", p.LiveData)
+	}
+
+	return map[string]any{
+		"recordName":      p.ID,
+		"recordType":      "CPLMaster",
+		"fields":          fields,
+		"recordChangeTag": changeTag(p.version),
+		"created":         map[string]any{"timestamp": p.AddedDate.UnixMilli()},
+		"modified":        map[string]any{"timestamp": p.AddedDate.UnixMilli()},
+		"zoneID":          primarySyncZone(),
+	}
+}
+
+// assetRecord must be called with lock
+func (s *Server) assetRecord(p *Photo) map[string]any {
+	fields := map[string]any{
+		"masterRef": map[string]any{
+			"value": map[string]any{"recordName": p.ID, "action": "DELETE_SELF", "zoneID": primarySyncZone()},
+			"type":  "REFERENCE",
+		},
+		"assetDate":  map[string]any{"value": p.AssetDate.UnixMilli(), "type": "TIMESTAMP"},
+		"addedDate":  map[string]any{"value": p.AddedDate.UnixMilli(), "type": "TIMESTAMP"},
+		"isFavorite": map[string]any{"value": boolToInt(p.IsFavorite), "type": "INT64"},
+		"isHidden":   map[string]any{"value": boolToInt(p.IsHidden), "type": "INT64"},
+		"isDeleted":  map[string]any{"value": boolToInt(p.IsDeleted), "type": "INT64"},
+	}
+	if p.Caption != "" {
+		fields["captionEnc"] = map[string]any{"value": base64.StdEncoding.EncodeToString([]byte(p.Caption)), "type": "ENCRYPTED_BYTES"}
+	}
+	if p.Location != nil {
+		location := encodeBplist(map[string]any{
+			"lat":       p.Location.Latitude,
+			"lon":       p.Location.Longitude,
+			"alt":       p.Location.Altitude,
+			"timestamp": p.Location.Timestamp,
+		})
+		fields["locationEnc"] = map[string]any{"value": base64.StdEncoding.EncodeToString(location), "type": "ENCRYPTED_BYTES"}
+	}
+
+	return map[string]any{
+		"recordName":      p.AssetID,
+		"recordType":      "CPLAsset",
+		"fields":          fields,
+		"recordChangeTag": changeTag(p.version),
+		"created":         map[string]any{"timestamp": p.AddedDate.UnixMilli()},
+		"modified":        map[string]any{"timestamp": p.AddedDate.UnixMilli()},
+		"zoneID":          primarySyncZone(),
+	}
+}
+
+// albumRecord must be called with lock
+func (s *Server) albumRecord(a *Album) map[string]any {
+	albumType, parentID := 0, a.ParentID
+	if a.IsFolder {
+		albumType = 3
+	}
+	if parentID == "" {
+		parentID = "----Root-Folder----"
+	}
+	fields := map[string]any{
+		"albumNameEnc": map[string]any{"value": base64.StdEncoding.EncodeToString([]byte(a.Name)), "type": "ENCRYPTED_BYTES"},
+		"albumType":    map[string]any{"value": albumType, "type": "INT64"},
+		"parentId":     map[string]any{"value": parentID, "type": "STRING"},
+	}
+	if a.IsDeleted {
+		fields["isDeleted"] = map[string]any{"value": 1, "type": "INT64"}
+	}
+
+	return map[string]any{
+		"recordName":      a.ID,
+		"recordType":      "CPLAlbum",
+		"fields":          fields,
+		"recordChangeTag": changeTag(a.version),
+		"zoneID":          primarySyncZone(),
+	}
+}
+
+// fingerprint is the CloudKit file signature: 0x01 + sha1(data)
+func fingerprint(data []byte) string {
+	sum := sha1.Sum(data)
+	return base64.StdEncoding.EncodeToString(append([]byte{0x01}, sum[:]...))
+}
+
+func changeTag(version int64) string {
+	return fmt.Sprintf("tag-%d", version)
+}
+
+func primarySyncZone() map[string]any {
+	return map[string]any{"zoneName": "PrimarySync", "ownerRecordName": "_owner", "zoneType": "REGULAR_CUSTOM_ZONE"}
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,200 @@
+// Package icloudtest provides a local fake iCloud server for offline end-to-end tests.
+//
+// The server emulates the auth (signin, 2FA, trust), setup (accountLogin, validate),
+// ckdatabasews (records/query, records/lookup, records/modify, changes/zone),
+// uploadimagews and asset download endpoints used by icloudgo,
+// and the drivews (items, folders) and docws (file download, upload) endpoints of iCloud Drive.
+//
+//	server := icloudtest.NewServer()
+//	defer server.Close()
+//
+//	cli, err := icloudgo.New(server.ClientOption(t.TempDir()))
+package icloudtest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/chyroc/icloudgo"
+)
+
+const (
+	DefaultAppleID   = "test@icloud.com"
+	DefaultPassword  = "password"
+	DefaultTwoFACode = "123456"
+)
+
+type Server struct {
+	*httptest.Server
+
+	// account
+	AppleID   string
+	Password  string
+	TwoFACode string
+
+	lock *sync.Mutex
+
+	// session
+	sessionID    int
+	sessionToken string
+	webAuthToken string
+	trustToken   string
+
+	// injected failures of the webservice requests
+	failStatus     int
+	failCount      int
+	failRetryAfter int
+
+	// photo library
+	version    int64
+	photos     []*Photo
+	albums     []*Album
+	tombstones []*tombstone
+
+	// iCloud Drive, DriveListLimit makes the listing of the larger folders partial, 0 means no limit
+	DriveListLimit int
+	driveRoot      *DriveItem
+	driveTrash     *DriveItem
+	driveItems     []*DriveItem
+	driveContents  map[string]*driveContent
+}
+
+func NewServer() *Server {
+	s := &Server{
+		AppleID:   DefaultAppleID,
+		Password:  DefaultPassword,
+		TwoFACode: DefaultTwoFACode,
+		lock:      new(sync.Mutex),
+
+		driveRoot:     &DriveItem{ID: DriveRootID, DocID: "root", IsFolder: true},
+		driveTrash:    &DriveItem{ID: DriveTrashID, IsFolder: true},
+		driveContents: map[string]*driveContent{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// ClientOption returns the option which points icloudgo.New to the server.
+func (s *Server) ClientOption(cookieDir string) *icloudgo.ClientOption {
+	return &icloudgo.ClientOption{
+		AppID:           s.AppleID,
+		Password:        s.Password,
+		CookieDir:       cookieDir,
+		TwoFACodeGetter: &textGetter{text: s.TwoFACode},
+		Endpoint: &icloudgo.ClientEndpoint{
+			Setup: s.URL + "/setup/ws/1",
+			Home:  s.URL,
+			Auth:  s.URL + "/appleauth/auth",
+		},
+	}
+}
+
+// FailRequests makes the next count webservice requests fail with status,
+// the Retry-After header is set when retryAfterSeconds > 0.
+func (s *Server) FailRequests(status, count, retryAfterSeconds int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.failStatus = status
+	s.failCount = count
+	s.failRetryAfter = retryAfterSeconds
+}
+
+// ExpireSession invalidates the current web auth token, the following webservice requests will get 421.
+func (s *Server) ExpireSession() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.webAuthToken = ""
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	path := req.URL.Path
+	if !strings.HasPrefix(path, "/appleauth/") && !strings.HasPrefix(path, "/setup/") && s.injectFailure(w) {
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(path, "/appleauth/auth/"):
+		s.serveAuth(w, req, strings.TrimPrefix(path, "/appleauth/auth"))
+	case strings.HasPrefix(path, "/setup/ws/1/"):
+		s.serveSetup(w, req, strings.TrimPrefix(path, "/setup/ws/1"))
+	case strings.HasPrefix(path, ckDatabasePath+"/"):
+		if !s.checkWebAuth(w, req) {
+			return
+		}
+		s.serveDatabase(w, req, strings.TrimPrefix(path, ckDatabasePath))
+	case path == "/uploadimagews/upload":
+		if !s.checkWebAuth(w, req) {
+			return
+		}
+		s.serveUpload(w, req)
+	case strings.HasPrefix(path, "/assets/"):
+		s.serveAsset(w, req, strings.TrimPrefix(path, "/assets/"))
+	case strings.HasPrefix(path, "/drivews/"):
+		if !s.checkWebAuth(w, req) {
+			return
+		}
+		s.serveDriveWS(w, req, strings.TrimPrefix(path, "/drivews"))
+	case strings.HasPrefix(path, "/docws/"):
+		if !s.checkWebAuth(w, req) {
+			return
+		}
+		s.serveDocWS(w, req, strings.TrimPrefix(path, "/docws"))
+	case strings.HasPrefix(path, "/drivefiles/"):
+		s.serveDriveFile(w, req, strings.TrimPrefix(path, "/drivefiles/"))
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "not found: " + path})
+	}
+}
+
+func (s *Server) webservices() map[string]any {
+	service := func(path string) map[string]any {
+		return map[string]any{"url": s.URL + path, "status": "active"}
+	}
+	return map[string]any{
+		"ckdatabasews":  service("/ckdatabasews"),
+		"uploadimagews": service("/uploadimagews"),
+		"photos":        service("/photos"),
+		"drivews":       service("/drivews"),
+		"docws":         service("/docws"),
+	}
+}
+
+func (s *Server) injectFailure(w http.ResponseWriter) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.failCount <= 0 {
+		return false
+	}
+	s.failCount--
+	if s.failRetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(s.failRetryAfter))
+	}
+	writeJSON(w, s.failStatus, map[string]any{"error": http.StatusText(s.failStatus)})
+	return true
+}
+
+// nextVersion must be called with lock
+func (s *Server) nextVersion() int64 {
+	s.version++
+	return s.version
+}
+
+// newID must be called with lock
+func (s *Server) newID(prefix string) string {
+	return fmt.Sprintf("%s-%d", prefix, s.nextVersion())
+}
+
+type textGetter struct {
+	text string
+}
+
+func (r *textGetter) GetText(string) (string, error) {
+	return r.text, nil
+}
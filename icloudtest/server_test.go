@@ -0,0 +1,82 @@
+package icloudtest
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestFailRequests(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	get := func(path string) *http.Response {
+		t.Helper()
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	server.FailRequests(http.StatusServiceUnavailable, 1, 3)
+
+	// the setup requests are not failed, the login of the client always works
+	if resp := get("/setup/ws/1/listDevices"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("setup status: %d, expect 200", resp.StatusCode)
+	}
+	resp := get(ckDatabasePath + "/records/query")
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") != "3" {
+		t.Fatalf("status: %d, retry after: %q, expect 503 and 3", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+	// the failure is used up, the request without the web auth cookie gets 421
+	if resp := get(ckDatabasePath + "/records/query"); resp.StatusCode != http.StatusMisdirectedRequest {
+		t.Fatalf("status: %d, expect 421", resp.StatusCode)
+	}
+}
+
+func TestZoneChanges(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	a := server.AddPhoto("a.jpg", []byte("a"), time.Now())
+	server.AddPhoto("b.jpg", []byte("b"), time.Now())
+
+	// a new photo is a CPLAsset and a CPLMaster record, the page is not split inside a photo
+	res := server.zoneChanges("", 3)
+	if records := res["records"].([]any); len(records) != 2 || res["moreComing"] != true {
+		t.Fatalf("records: %d, more: %v, expect 2 and true", len(records), res["moreComing"])
+	}
+	res = server.zoneChanges(res["syncToken"].(string), 3)
+	if records := res["records"].([]any); len(records) != 2 || res["moreComing"] != false {
+		t.Fatalf("records: %d, more: %v, expect 2 and false", len(records), res["moreComing"])
+	}
+
+	// the expunged photo is returned as the deleted records of both
+	server.ExpungePhoto(a.ID)
+	res = server.zoneChanges(res["syncToken"].(string), 0)
+	records := res["records"].([]any)
+	if len(records) != 2 {
+		t.Fatalf("records: %d, expect 2", len(records))
+	}
+	for _, v := range records {
+		if record := v.(map[string]any); record["deleted"] != true {
+			t.Fatalf("expect deleted record, got %v", record)
+		}
+	}
+	if photos := server.Photos(); len(photos) != 1 || server.Photo(a.ID) != nil {
+		t.Fatalf("expunged photo is still in the library: %d", len(photos))
+	}
+}
+
+func TestPhotoCopy(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	photo := server.AddPhoto("a.jpg", []byte("a"), time.Now())
+	photo.IsFavorite = true
+	if server.Photo(photo.ID).IsFavorite {
+		t.Fatal("the returned photo must be a copy")
+	}
+}
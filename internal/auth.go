@@ -1,11 +1,16 @@
 package internal
 
 import (
+	"context"
 	"fmt"
 	"strings"
 )
 
-func (r *Client) Authenticate(forceRefresh bool, service *string) (finalErr error) {
+func (r *Client) Authenticate(forceRefresh bool, service *string) error {
+	return r.AuthenticateContext(context.Background(), forceRefresh, service)
+}
+
+func (r *Client) AuthenticateContext(ctx context.Context, forceRefresh bool, service *string) (finalErr error) {
 	defer func() {
 		if finalErr == nil {
 			r.flush()
@@ -15,7 +20,7 @@ func (r *Client) Authenticate(forceRefresh bool, service *string) (finalErr erro
 	var errs []string
 	if r.sessionData.SessionToken != "" && !forceRefresh {
 		fmt.Printf("Checking session token validity")
-		if err := r.validateToken(); err == nil {
+		if err := r.validateToken(ctx); err == nil {
 			return nil
 		} else {
 			errs = append(errs, err.Error())
@@ -26,7 +31,7 @@ func (r *Client) Authenticate(forceRefresh bool, service *string) (finalErr erro
 	if service != nil {
 		if r.Data != nil && len(r.Data.Apps) > 0 && r.Data.Apps[*service] != nil && r.Data.Apps[*service].CanLaunchWithOneFactor {
 			fmt.Printf("Authenticating as %s for %s\n", r.appleID, *service)
-			if err := r.authWithCredentialsService(*service, r.password); err != nil {
+			if err := r.authWithCredentialsService(ctx, *service, r.password); err != nil {
 				errs = append(errs, err.Error())
 				fmt.Printf("Could not log into service. Attempting brand new login.\n")
 			} else {
@@ -38,9 +43,9 @@ func (r *Client) Authenticate(forceRefresh bool, service *string) (finalErr erro
 	// default, login to icloud.com[.cn]
 	{
 		fmt.Printf("Authenticating as %s\n", r.appleID)
-		err := r.signIn(r.password)
+		err := r.signIn(ctx, r.password)
 		if err == nil {
-			err = r.verify2Fa()
+			err = r.verify2Fa(ctx)
 			if err == nil {
 				return nil
 			}
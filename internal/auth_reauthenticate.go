@@ -0,0 +1,45 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// reauthenticate refreshes the web auth cookies when the session expired.
+//
+// authGeneration is the generation before the failed request, if other request has re-authenticated after it,
+// there is no need to authenticate again.
+func (r *Client) reauthenticate(ctx context.Context, authGeneration int64) error {
+	r.authLock.Lock()
+	defer r.authLock.Unlock()
+
+	if r.getAuthGeneration() != authGeneration {
+		return nil
+	}
+
+	// the session token may still be valid, try it before sign in again
+	if r.sessionData.SessionToken != "" {
+		if err := r.authWithToken(ctx); err == nil {
+			atomic.AddInt64(&r.authGeneration, 1)
+			return r.flush()
+		} else {
+			fmt.Printf("[icloudgo] [reauth] auth with session token failed: %s\n", err)
+		}
+	}
+
+	if err := r.AuthenticateContext(ctx, true, nil); err != nil {
+		return err
+	}
+	atomic.AddInt64(&r.authGeneration, 1)
+	return nil
+}
+
+func (r *Client) getAuthGeneration() int64 {
+	return atomic.LoadInt64(&r.authGeneration)
+}
+
+func (r *Client) isAuthURL(url string) bool {
+	return strings.HasPrefix(url, r.authEndpoint) || strings.HasPrefix(url, r.setupEndpoint)
+}
@@ -1,11 +1,12 @@
 package internal
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 )
 
-func (r *Client) signIn(password string) error {
+func (r *Client) signIn(ctx context.Context, password string) error {
 	body := map[string]any{
 		"accountName": r.appleID,
 		"password":    password,
@@ -20,7 +21,7 @@ func (r *Client) signIn(password string) error {
 	headers = setIfNotEmpty(headers, "scnt", r.sessionData.Scnt)
 	headers = setIfNotEmpty(headers, "X-Apple-ID-Session-Id", r.sessionData.SessionID)
 
-	_, err := r.request(&rawReq{
+	_, err := r.request(ctx, &rawReq{
 		Method:       http.MethodPost,
 		URL:          r.authEndpoint + "/signin",
 		Headers:      headers,
@@ -32,5 +33,5 @@ func (r *Client) signIn(password string) error {
 		return fmt.Errorf("signin failed: %w", err)
 	}
 
-	return r.authWithToken()
+	return r.authWithToken(ctx)
 }
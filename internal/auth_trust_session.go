@@ -1,17 +1,18 @@
 package internal
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 )
 
 // session trust to avoid user log in going forward
-func (r *Client) trustSession() error {
+func (r *Client) trustSession(ctx context.Context) error {
 	headers := r.getAuthHeaders(map[string]string{})
 	headers = setIfNotEmpty(headers, "scnt", r.sessionData.Scnt)
 	headers = setIfNotEmpty(headers, "X-Apple-ID-Session-Id", r.sessionData.SessionID)
 
-	_, err := r.request(&rawReq{
+	_, err := r.request(ctx, &rawReq{
 		Method:       http.MethodGet,
 		URL:          r.authEndpoint + "/2sv/trust",
 		Headers:      headers,
@@ -21,5 +22,5 @@ func (r *Client) trustSession() error {
 		return fmt.Errorf("trustSession failed: %w", err)
 	}
 
-	return r.authWithToken()
+	return r.authWithToken(ctx)
 }
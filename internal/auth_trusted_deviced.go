@@ -1,14 +1,15 @@
 package internal
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 )
 
 // Returns devices trusted for two-step authentication.
-func (r *Client) trustedDevices() ([]*device, error) {
-	text, err := r.request(&rawReq{
+func (r *Client) trustedDevices(ctx context.Context) ([]*device, error) {
+	text, err := r.request(ctx, &rawReq{
 		Method:  http.MethodPost,
 		URL:     r.setupEndpoint + "/listDevices",
 		Headers: r.getCommonHeaders(map[string]string{}),
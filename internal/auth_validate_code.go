@@ -1,18 +1,19 @@
 package internal
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 )
 
-func (r *Client) validate2FACode(code string) error {
+func (r *Client) validate2FACode(ctx context.Context, code string) error {
 	body := map[string]interface{}{"securityCode": map[string]string{"code": code}}
 
 	headers := r.getAuthHeaders(map[string]string{"Accept": "application/json"})
 	headers = setIfNotEmpty(headers, "scnt", r.sessionData.Scnt)
 	headers = setIfNotEmpty(headers, "X-Apple-ID-Session-Id", r.sessionData.SessionID)
 
-	if _, err := r.request(&rawReq{
+	if _, err := r.request(ctx, &rawReq{
 		Method:       http.MethodPost,
 		URL:          r.authEndpoint + "/verify/trusteddevice/securitycode",
 		Headers:      headers,
@@ -25,7 +26,7 @@ func (r *Client) validate2FACode(code string) error {
 		return fmt.Errorf("validate2FACode failed: %w", err)
 	}
 
-	if err := r.trustSession(); err != nil {
+	if err := r.trustSession(ctx); err != nil {
 		return err
 	}
 
@@ -1,15 +1,16 @@
 package internal
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 )
 
-func (r *Client) validateToken() error {
+func (r *Client) validateToken(ctx context.Context) error {
 	fmt.Printf("Checking session token validity\n")
 
-	text, err := r.request(&rawReq{
+	text, err := r.request(ctx, &rawReq{
 		Method:  http.MethodPost,
 		URL:     r.setupEndpoint + "/validate",
 		Headers: r.getCommonHeaders(map[string]string{}),
@@ -1,11 +1,12 @@
 package internal
 
 import (
+	"context"
 	"fmt"
 	"os"
 )
 
-func (r *Client) verify2Fa() error {
+func (r *Client) verify2Fa(ctx context.Context) error {
 	if r.Data == nil || r.Data.DsInfo == nil {
 		return fmt.Errorf("not authenticated validate data")
 	}
@@ -15,18 +16,18 @@ func (r *Client) verify2Fa() error {
 		if err != nil {
 			return fmt.Errorf("get 2fa code failed, err: %w", err)
 		}
-		if err := r.validate2FACode(code); err != nil {
+		if err := r.validate2FACode(ctx, code); err != nil {
 			return err
 		}
 
 		if !r.Data.HsaTrustedBrowser {
-			if err := r.trustSession(); err != nil {
+			if err := r.trustSession(ctx); err != nil {
 				return err
 			}
 		}
 	} else if r.isRequires2SA() {
 		fmt.Printf("Two-step authentication required. Your trusted devices are:\n")
-		devices, err := r.trustedDevices()
+		devices, err := r.trustedDevices(ctx)
 		if err != nil {
 			return err
 		}
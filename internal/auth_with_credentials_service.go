@@ -1,12 +1,13 @@
 package internal
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 )
 
-func (r *Client) authWithCredentialsService(service, password string) error {
-	_, err := r.request(&rawReq{
+func (r *Client) authWithCredentialsService(ctx context.Context, service, password string) error {
+	_, err := r.request(ctx, &rawReq{
 		Method:  http.MethodPost,
 		URL:     r.setupEndpoint + "/accountLogin",
 		Headers: r.getCommonHeaders(map[string]string{}),
@@ -20,5 +21,5 @@ func (r *Client) authWithCredentialsService(service, password string) error {
 		return fmt.Errorf("authWithCredentialsService failed, err: %w", err)
 	}
 
-	return r.validateToken()
+	return r.validateToken(ctx)
 }
@@ -1,14 +1,15 @@
 package internal
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 )
 
 // auth using session token
-func (r *Client) authWithToken() error {
-	text, err := r.request(&rawReq{
+func (r *Client) authWithToken(ctx context.Context) error {
+	text, err := r.request(ctx, &rawReq{
 		Method:  http.MethodPost,
 		URL:     r.setupEndpoint + "/accountLogin",
 		Headers: r.getCommonHeaders(map[string]string{}),
@@ -0,0 +1,223 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+	"unicode/utf16"
+)
+
+// bplistEpoch is the reference date of the binary plist date
+var bplistEpoch = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// decodeBplist decodes the binary property list(bplist00), the value is one of:
+// nil, bool, int64, float64, time.Time, []byte, string, []any, map[string]any
+func decodeBplist(data []byte) (any, error) {
+	if len(data) < 8+32 || !bytes.HasPrefix(data, []byte("bplist00")) {
+		return nil, fmt.Errorf("invalid bplist header")
+	}
+
+	trailer := data[len(data)-32:]
+	d := &bplistDecoder{
+		data:              data,
+		offsetIntSize:     int(trailer[6]),
+		objectRefSize:     int(trailer[7]),
+		numObjects:        binary.BigEndian.Uint64(trailer[8:16]),
+		topObject:         binary.BigEndian.Uint64(trailer[16:24]),
+		offsetTableOffset: binary.BigEndian.Uint64(trailer[24:32]),
+	}
+	if d.offsetIntSize == 0 || d.offsetIntSize > 8 || d.objectRefSize == 0 || d.objectRefSize > 8 {
+		return nil, fmt.Errorf("invalid bplist trailer")
+	}
+	tableEnd := uint64(len(data) - 32)
+	if d.offsetTableOffset > tableEnd || d.numObjects > (tableEnd-d.offsetTableOffset)/uint64(d.offsetIntSize) {
+		return nil, fmt.Errorf("invalid bplist offset table")
+	}
+	return d.object(d.topObject, 0)
+}
+
+type bplistDecoder struct {
+	data              []byte
+	offsetIntSize     int
+	objectRefSize     int
+	numObjects        uint64
+	topObject         uint64
+	offsetTableOffset uint64
+}
+
+func (d *bplistDecoder) object(ref uint64, depth int) (any, error) {
+	if ref >= d.numObjects {
+		return nil, fmt.Errorf("bplist object ref %d out of range", ref)
+	} else if depth > 32 {
+		return nil, fmt.Errorf("bplist too deep")
+	}
+
+	tableOffset := d.offsetTableOffset + ref*uint64(d.offsetIntSize)
+	offset := readBplistUint(d.data[tableOffset : tableOffset+uint64(d.offsetIntSize)])
+	if offset >= uint64(len(d.data)-32) {
+		return nil, fmt.Errorf("bplist object offset %d out of range", offset)
+	}
+
+	marker := d.data[offset]
+	typ, info := marker>>4, marker&0x0F
+	switch typ {
+	case 0x0:
+		switch info {
+		case 0x8:
+			return false, nil
+		case 0x9:
+			return true, nil
+		default:
+			return nil, nil
+		}
+	case 0x1:
+		bs, err := d.bytes(offset+1, 1<<info)
+		if err != nil {
+			return nil, err
+		}
+		return int64(readBplistUint(bs)), nil
+	case 0x2:
+		bs, err := d.bytes(offset+1, 1<<info)
+		if err != nil {
+			return nil, err
+		}
+		return readBplistFloat(bs)
+	case 0x3:
+		bs, err := d.bytes(offset+1, 8)
+		if err != nil {
+			return nil, err
+		}
+		seconds, err := readBplistFloat(bs)
+		if err != nil {
+			return nil, err
+		}
+		return bplistEpoch.Add(time.Duration(seconds * float64(time.Second))), nil
+	case 0x4, 0x5, 0x6:
+		unit := uint64(1)
+		if typ == 0x6 {
+			unit = 2
+		}
+		count, start, err := d.count(offset, info, unit)
+		if err != nil {
+			return nil, err
+		}
+		if typ == 0x6 {
+			bs, err := d.bytes(start, count*2)
+			if err != nil {
+				return nil, err
+			}
+			units := make([]uint16, count)
+			for i := range units {
+				units[i] = binary.BigEndian.Uint16(bs[i*2:])
+			}
+			return string(utf16.Decode(units)), nil
+		}
+		bs, err := d.bytes(start, count)
+		if err != nil {
+			return nil, err
+		}
+		if typ == 0x5 {
+			return string(bs), nil
+		}
+		return append([]byte{}, bs...), nil
+	case 0xA:
+		count, start, err := d.count(offset, info, uint64(d.objectRefSize))
+		if err != nil {
+			return nil, err
+		}
+		res := make([]any, 0, count)
+		for i := uint64(0); i < count; i++ {
+			v, err := d.ref(start, i, depth)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, v)
+		}
+		return res, nil
+	case 0xD:
+		count, start, err := d.count(offset, info, 2*uint64(d.objectRefSize))
+		if err != nil {
+			return nil, err
+		}
+		res := make(map[string]any, count)
+		for i := uint64(0); i < count; i++ {
+			k, err := d.ref(start, i, depth)
+			if err != nil {
+				return nil, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("bplist dict key is %T, not string", k)
+			}
+			v, err := d.ref(start, count+i, depth)
+			if err != nil {
+				return nil, err
+			}
+			res[key] = v
+		}
+		return res, nil
+	default:
+		return nil, fmt.Errorf("unsupported bplist object type 0x%x", typ)
+	}
+}
+
+// count returns the count of the object and the offset of its content, unit is the bytes of every element, the count is
+// checked against the remaining bytes, so the corrupted count can not make the huge allocation
+func (d *bplistDecoder) count(offset uint64, info byte, unit uint64) (uint64, uint64, error) {
+	count, start := uint64(info), offset+1
+	if info == 0x0F {
+		bs, err := d.bytes(offset+1, 1)
+		if err != nil {
+			return 0, 0, err
+		} else if bs[0]>>4 != 0x1 {
+			return 0, 0, fmt.Errorf("invalid bplist count marker 0x%x", bs[0])
+		}
+		size := uint64(1) << (bs[0] & 0x0F)
+		countBs, err := d.bytes(offset+2, size)
+		if err != nil {
+			return 0, 0, err
+		}
+		count, start = readBplistUint(countBs), offset+2+size
+	}
+	if start > uint64(len(d.data)) || count > (uint64(len(d.data))-start)/unit {
+		return 0, 0, fmt.Errorf("bplist count %d out of range", count)
+	}
+	return count, start, nil
+}
+
+func (d *bplistDecoder) ref(start, index uint64, depth int) (any, error) {
+	bs, err := d.bytes(start+index*uint64(d.objectRefSize), uint64(d.objectRefSize))
+	if err != nil {
+		return nil, err
+	}
+	return d.object(readBplistUint(bs), depth+1)
+}
+
+func (d *bplistDecoder) bytes(offset, size uint64) ([]byte, error) {
+	end := offset + size
+	if end < offset || end > uint64(len(d.data)) {
+		return nil, fmt.Errorf("bplist read out of range")
+	}
+	return d.data[offset:end], nil
+}
+
+func readBplistUint(bs []byte) uint64 {
+	var v uint64
+	for _, b := range bs {
+		v = v<<8 | uint64(b)
+	}
+	return v
+}
+
+func readBplistFloat(bs []byte) (float64, error) {
+	switch len(bs) {
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(bs))), nil
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(bs)), nil
+	default:
+		return 0, fmt.Errorf("invalid bplist real size %d", len(bs))
+	}
+}
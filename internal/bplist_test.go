@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// buildBplist builds the bplist00 of the objects, the object refs are 1 byte, the first object is the top
+func buildBplist(objects ...[]byte) []byte {
+	buf := bytes.NewBufferString("bplist00")
+	var offsets []byte
+	for _, object := range objects {
+		offsets = append(offsets, byte(buf.Len()>>8), byte(buf.Len()))
+		buf.Write(object)
+	}
+	offsetTableOffset := buf.Len()
+	buf.Write(offsets)
+
+	trailer := make([]byte, 32)
+	trailer[6] = 2 // offset int size
+	trailer[7] = 1 // object ref size
+	binary.BigEndian.PutUint64(trailer[8:], uint64(len(objects)))
+	binary.BigEndian.PutUint64(trailer[24:], uint64(offsetTableOffset))
+	buf.Write(trailer)
+	return buf.Bytes()
+}
+
+func TestDecodeBplist(t *testing.T) {
+	data := buildBplist(
+		[]byte{0xD3, 1, 2, 3, 4, 5, 6},       // dict of 3
+		[]byte{0x51, 'a'},                    // "a"
+		[]byte{0x51, 'b'},                    // "b"
+		[]byte{0x51, 'c'},                    // "c"
+		[]byte{0x61, 0x00, 0xE9},             // utf16 "é"
+		[]byte{0x11, 0x01, 0x00},             // 256
+		[]byte{0xA2, 1, 2, 0x5F, 0x10, 0x01}, // ["a", "b"], the tail is ignored
+	)
+	v, err := decodeBplist(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dict, ok := v.(map[string]any)
+	if !ok {
+		t.Fatalf("top object is %T", v)
+	}
+	if dict["a"] != "é" || dict["b"] != int64(256) {
+		t.Fatalf("unexpected dict: %v", dict)
+	}
+	if arr, ok := dict["c"].([]any); !ok || len(arr) != 2 || arr[0] != "a" || arr[1] != "b" {
+		t.Fatalf("unexpected array: %v", dict["c"])
+	}
+}
+
+func TestDecodeBplistCorrupted(t *testing.T) {
+	// the count is the 8 bytes int after 0x13
+	hugeCount := []byte{0x13, 0x80, 0, 0, 0, 0, 0, 0, 0x01}
+	tests := map[string][]byte{
+		"utf16 count overflow": buildBplist(append([]byte{0x6F}, hugeCount...)),
+		"string count":         buildBplist(append([]byte{0x5F}, hugeCount...)),
+		"array count":          buildBplist(append([]byte{0xAF}, hugeCount...)),
+		"dict count":           buildBplist(append([]byte{0xDF}, hugeCount...)),
+		"short array":          buildBplist([]byte{0xA3, 0}),
+		"ref out of range":     buildBplist([]byte{0xA1, 7}),
+		"truncated":            buildBplist([]byte{0x5F, 0x13, 0x00}),
+		"loop":                 buildBplist([]byte{0xA1, 0}),
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := decodeBplist(data); err == nil {
+				t.Fatal("expect error")
+			}
+		})
+	}
+
+	// the huge object count in the trailer
+	data := buildBplist([]byte{0x51, 'a'})
+	binary.BigEndian.PutUint64(data[len(data)-24:], 1<<62)
+	if _, err := decodeBplist(data); err == nil {
+		t.Fatal("expect error of the object count")
+	}
+}
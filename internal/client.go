@@ -4,8 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"sync"
 
-	"github.com/chyroc/gorequests"
+	cookiejar "github.com/chyroc/persistent-cookiejar"
 	uuid "github.com/satori/go.uuid"
 )
 
@@ -29,7 +30,7 @@ type Client struct {
 	clientID    string
 	sessionData *SessionData
 	Data        *ValidateData
-	httpCli     *gorequests.Session
+	cookieJar   *cookiejar.Jar
 
 	// server
 	setupEndpoint string
@@ -39,6 +40,11 @@ type Client struct {
 	// service
 	photo *PhotoService
 	drive *DriveService
+
+	// request
+	retryPolicy    *RetryPolicy
+	authLock       *sync.Mutex
+	authGeneration int64
 }
 
 type ClientOption struct {
@@ -46,7 +52,15 @@ type ClientOption struct {
 	Password        string
 	CookieDir       string
 	TwoFACodeGetter TextGetter
-	Domain          string // com,cn
+	Domain          string          // com,cn
+	Endpoint        *ClientEndpoint // override the endpoints of Domain, e.g. point to a local fake server
+	RetryPolicy     *RetryPolicy    // default is DefaultRetryPolicy
+}
+
+type ClientEndpoint struct {
+	Setup string // https://setup.icloud.com/setup/ws/1
+	Home  string // https://www.icloud.com
+	Auth  string // https://idmsa.apple.com/appleauth/auth
 }
 
 func NewClient(option *ClientOption) (*Client, error) {
@@ -56,11 +70,20 @@ func NewClient(option *ClientOption) (*Client, error) {
 func newClient(option *ClientOption) (*Client, error) {
 	cli := &Client{
 		twoFACodeGetter: option.TwoFACodeGetter,
+		retryPolicy:     option.RetryPolicy,
+		authLock:        new(sync.Mutex),
+	}
+	if cli.retryPolicy == nil {
+		cli.retryPolicy = DefaultRetryPolicy
 	}
 	var err error
 
 	// domain
-	if option.Domain == "cn" {
+	if option.Endpoint != nil {
+		cli.setupEndpoint = option.Endpoint.Setup
+		cli.homeEndpoint = option.Endpoint.Home
+		cli.authEndpoint = option.Endpoint.Auth
+	} else if option.Domain == "cn" {
 		cli.setupEndpoint = "https://setup.icloud.com.cn/setup/ws/1"
 		cli.homeEndpoint = "https://www.icloud.com.cn"
 		cli.authEndpoint = "https://idmsa.apple.com/appleauth/auth"
@@ -103,11 +126,15 @@ func newClient(option *ClientOption) (*Client, error) {
 	}
 
 	cli.appleID = option.AppID
-
-	cli.httpCli = gorequests.NewSession(
-		fmt.Sprintf("%s/session.json", cli.cookieDir),
-		gorequests.WithLogger(gorequests.NewDiscardLogger()),
-	)
+	cli.password = option.Password
+
+	cli.cookieJar, err = cookiejar.New(&cookiejar.Options{
+		Filename:   cli.ConfigPath("session.json"),
+		Persistent: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("init cookie jar failed, err: %w", err)
+	}
 
 	return cli, nil
 }
@@ -0,0 +1,88 @@
+package internal_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chyroc/icloudgo/icloudtest"
+	"github.com/chyroc/icloudgo/internal"
+)
+
+// testRetryPolicy retries without waiting, so the injected failures do not slow down the tests
+var testRetryPolicy = &internal.RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   time.Millisecond,
+	MaxDelay:    time.Millisecond * 10,
+}
+
+func newTestClient(t *testing.T, server *icloudtest.Server) *internal.Client {
+	t.Helper()
+
+	option := server.ClientOption(t.TempDir())
+	option.RetryPolicy = testRetryPolicy
+	cli, err := internal.NewClient(option)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = cli.Close() })
+	if err := cli.Authenticate(false, nil); err != nil {
+		t.Fatal(err)
+	}
+	return cli
+}
+
+func newTestPhotoService(t *testing.T, server *icloudtest.Server) *internal.PhotoService {
+	t.Helper()
+
+	photoCli, err := newTestClient(t, server).PhotoCli()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return photoCli
+}
+
+func TestAuthenticate(t *testing.T) {
+	server := icloudtest.NewServer()
+	defer server.Close()
+
+	cookieDir := t.TempDir()
+	cli, err := internal.NewClient(server.ClientOption(cookieDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.Authenticate(false, nil); err != nil {
+		t.Fatal(err)
+	}
+	if cli.Data == nil || cli.Data.DsInfo.Dsid == "" {
+		t.Fatalf("unexpected account data: %+v", cli.Data)
+	}
+	cli.Close()
+
+	// the session saved in the cookie dir is reused
+	option := server.ClientOption(cookieDir)
+	option.TwoFACodeGetter = nil
+	cli, err = internal.NewClient(option)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	if err := cli.Authenticate(false, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAuthenticateWrongPassword(t *testing.T) {
+	server := icloudtest.NewServer()
+	defer server.Close()
+
+	option := server.ClientOption(t.TempDir())
+	option.Password = "wrong"
+	cli, err := internal.NewClient(option)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	if err := cli.Authenticate(false, nil); err == nil {
+		t.Fatal("expect error of the wrong password")
+	}
+}
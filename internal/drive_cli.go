@@ -9,7 +9,9 @@ type DriveService struct {
 	serviceRoot     string
 	serviceEndpoint string
 
-	lock *sync.Mutex
+	lock       *sync.Mutex
+	pathCache  map[string]*DriveFolder   // path -> item
+	itemsCache map[string][]*DriveFolder // drivewsid of the folder -> items
 }
 
 func (r *Client) DriveCli() (*DriveService, error) {
@@ -32,7 +34,9 @@ func newDriveService(icloud *Client, serviceRoot string) (*DriveService, error)
 		serviceRoot:     serviceRoot,
 		serviceEndpoint: serviceRoot,
 
-		lock: new(sync.Mutex),
+		lock:       new(sync.Mutex),
+		pathCache:  map[string]*DriveFolder{},
+		itemsCache: map[string][]*DriveFolder{},
 	}
 
 	return photoCli, nil
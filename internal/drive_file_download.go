@@ -0,0 +1,154 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+const (
+	driveDefaultZone = "com.apple.CloudDocs"
+	driveTypeFile    = "FILE"
+)
+
+// IsFile returns true if the item is a file, the others are the folders and the app libraries.
+func (r *DriveFolder) IsFile() bool {
+	return r.Type == driveTypeFile
+}
+
+// Open returns the content of the file, the caller must close it.
+func (r *DriveService) Open(item *DriveFolder) (io.ReadCloser, error) {
+	return r.OpenContext(context.Background(), item)
+}
+
+func (r *DriveService) OpenContext(ctx context.Context, item *DriveFolder) (io.ReadCloser, error) {
+	body, _, err := r.openDriveFile(ctx, item, 0)
+	return body, err
+}
+
+// openDriveFile returns the content of the file from the offset, and whether it is the zip of a package
+func (r *DriveService) openDriveFile(ctx context.Context, item *DriveFolder, offset int64) (io.ReadCloser, bool, error) {
+	if !item.IsFile() {
+		return nil, false, fmt.Errorf("open %s failed: %s is not a file", item.Name, item.Type)
+	}
+	url, isPackage, err := r.getDownloadURL(ctx, item)
+	if err != nil {
+		return nil, false, err
+	}
+
+	timeout := transferTimeout(int64(item.Size) - offset)
+	headers := r.icloud.getCommonHeaders(map[string]string{})
+	expectStatus := newSet[int](http.StatusOK)
+	if offset > 0 {
+		headers["Range"] = fmt.Sprintf("bytes=%d-", offset)
+		expectStatus = newSet[int](http.StatusOK, http.StatusPartialContent, http.StatusRequestedRangeNotSatisfiable)
+	}
+	resp, err := r.icloud.requestStreamResponse(ctx, &rawReq{
+		Method:       http.MethodGet,
+		URL:          url,
+		Headers:      headers,
+		ExpectStatus: expectStatus,
+		Timeout:      timeout,
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("download %s(timeout: %s) failed: %w", item.Name, timeout, err)
+	}
+	body, err := rangeBody(resp, offset)
+	return body, isPackage, err
+}
+
+// Download downloads the file to target, the modified time of target is set to the one of the file.
+//
+// The file is written to target.tmp first, and renamed to target when it is complete, so the failed download does not
+// leave a broken target. The package (e.g. a .pages document) is downloaded as a zip, its size is not checked, since
+// the size of the item is the one of the package, not the zip.
+func (r *DriveService) Download(item *DriveFolder, target string) error {
+	return r.DownloadContext(context.Background(), item, target)
+}
+
+func (r *DriveService) DownloadContext(ctx context.Context, item *DriveFolder, target string) error {
+	body, isPackage, err := r.openDriveFile(ctx, item, 0)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	tmp := target + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("open file error: %v", err)
+	}
+	size, err := io.Copy(f, body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && !isPackage && item.Size > 0 && size != int64(item.Size) {
+		err = fmt.Errorf("size mismatch, expect: %d, got: %d", item.Size, size)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("download %s failed: %w", item.Name, err)
+	}
+
+	if !item.DateModified.IsZero() {
+		if err := os.Chtimes(tmp, item.DateModified, item.DateModified); err != nil {
+			return fmt.Errorf("change file time error: %v", err)
+		}
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		return fmt.Errorf("rename file error: %v", err)
+	}
+	return nil
+}
+
+// getDownloadURL returns the url of the file content, and whether it is the zip of a package, e.g. a .pages document
+func (r *DriveService) getDownloadURL(ctx context.Context, item *DriveFolder) (string, bool, error) {
+	docEndpoint, err := r.icloud.getWebServiceURL(serviceDoc)
+	if err != nil {
+		return "", false, err
+	}
+
+	text, err := r.icloud.request(ctx, &rawReq{
+		Method:  http.MethodGet,
+		URL:     fmt.Sprintf("%s/ws/%s/download/by_id", docEndpoint, item.zone()),
+		Headers: r.icloud.getCommonHeaders(map[string]string{}),
+		Querys:  map[string]string{"document_id": item.Docwsid},
+	})
+	if err != nil {
+		return "", false, fmt.Errorf("getDownloadURL failed, err: %w", err)
+	}
+
+	res := new(getDriveDownloadURLResp)
+	if err = json.Unmarshal([]byte(text), res); err != nil {
+		return "", false, fmt.Errorf("getDownloadURL unmarshal failed, err: %w, text: %s", err, text)
+	}
+	if res.DataToken != nil && res.DataToken.URL != "" {
+		return res.DataToken.URL, false, nil
+	}
+	if res.PackageToken != nil && res.PackageToken.URL != "" {
+		return res.PackageToken.URL, true, nil
+	}
+	return "", false, fmt.Errorf("getDownloadURL failed, no url in response, text: %s", text)
+}
+
+func (r *DriveFolder) zone() string {
+	if r.Zone != "" {
+		return r.Zone
+	}
+	return driveDefaultZone
+}
+
+type getDriveDownloadURLResp struct {
+	DocumentID   string              `json:"document_id"`
+	DataToken    *driveDownloadToken `json:"data_token"`
+	PackageToken *driveDownloadToken `json:"package_token"`
+}
+
+type driveDownloadToken struct {
+	URL       string `json:"url"`
+	Token     string `json:"token"`
+	Signature string `json:"signature"`
+}
@@ -0,0 +1,54 @@
+package internal_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chyroc/icloudgo/icloudtest"
+	"github.com/chyroc/icloudgo/internal"
+)
+
+func newTestDriveService(t *testing.T, server *icloudtest.Server) *internal.DriveService {
+	t.Helper()
+
+	driveCli, err := newTestClient(t, server).DriveCli()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return driveCli
+}
+
+func TestDriveDownload(t *testing.T) {
+	server := icloudtest.NewServer()
+	defer server.Close()
+	server.AddDriveFile("a.txt", icloudtest.DriveRootID, []byte("hello"))
+	// the size of the package is not the size of its zip
+	server.AddDrivePackage("b.pages", icloudtest.DriveRootID, []byte("zip"), 100)
+	driveCli := newTestDriveService(t, server)
+	dir := t.TempDir()
+
+	for name, expect := range map[string]string{"a.txt": "hello", "b.pages": "zip"} {
+		item, err := driveCli.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		target := filepath.Join(dir, name)
+		if err := driveCli.Download(item, target); err != nil {
+			t.Fatal(err)
+		}
+		if bs, err := os.ReadFile(target); err != nil {
+			t.Fatal(err)
+		} else if string(bs) != expect {
+			t.Fatalf("content of %s: %q, expect %q", name, bs, expect)
+		}
+		if f, err := os.Stat(target); err != nil {
+			t.Fatal(err)
+		} else if !f.ModTime().Equal(item.DateModified) {
+			t.Fatalf("mod time of %s: %s, expect %s", name, f.ModTime(), item.DateModified)
+		}
+		if _, err := os.Stat(target + ".tmp"); !os.IsNotExist(err) {
+			t.Fatalf("tmp file of %s is left: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Upload uploads the file to the folder, and returns the created item.
+//
+// The file is streamed in one request, if it is an io.Seeker, e.g. *os.File, the request is retried from the start of the
+// file as RetryPolicy allows, otherwise the file is read into memory first, because the size is required before the upload.
+func (r *DriveService) Upload(parentID, name string, file io.Reader) (*DriveFolder, error) {
+	return r.UploadContext(context.Background(), parentID, name, file)
+}
+
+func (r *DriveService) UploadContext(ctx context.Context, parentID, name string, file io.Reader) (*DriveFolder, error) {
+	zone, parentDocID, err := parseDriveID(parentID)
+	if err != nil {
+		return nil, fmt.Errorf("upload %s failed: %w", name, err)
+	}
+	docEndpoint, err := r.icloud.getWebServiceURL(serviceDoc)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := file.(io.Seeker); !ok {
+		bs, err := io.ReadAll(file)
+		if err != nil {
+			return nil, fmt.Errorf("upload %s failed: %w", name, err)
+		}
+		file = bytes.NewReader(bs)
+	}
+	size, err := readerSize(file)
+	if err != nil {
+		return nil, fmt.Errorf("upload %s failed: %w", name, err)
+	}
+
+	token, err := r.getUploadToken(ctx, docEndpoint, zone, name, size)
+	if err != nil {
+		return nil, fmt.Errorf("upload %s failed: %w", name, err)
+	}
+	content, err := r.uploadContent(ctx, token.URL, name, file, size)
+	if err != nil {
+		return nil, fmt.Errorf("upload %s failed: %w", name, err)
+	}
+	documentID, err := r.updateDocument(ctx, docEndpoint, zone, parentDocID, token.DocumentID, name, content)
+	r.ClearCache()
+	if err != nil {
+		return nil, fmt.Errorf("upload %s failed: %w", name, err)
+	}
+
+	item, err := r.getDriveItem(ctx, fmt.Sprintf("%s::%s::%s", driveTypeFile, zone, documentID))
+	if err != nil {
+		return nil, fmt.Errorf("upload %s succeeded, but %w", name, err)
+	}
+	return item, nil
+}
+
+// getUploadToken returns the url to upload the content, and the id of the new document
+func (r *DriveService) getUploadToken(ctx context.Context, docEndpoint, zone, name string, size int64) (*driveUploadToken, error) {
+	text, err := r.icloud.request(ctx, &rawReq{
+		Method:  http.MethodPost,
+		URL:     fmt.Sprintf("%s/ws/%s/upload/web", docEndpoint, zone),
+		Headers: r.icloud.getCommonHeaders(map[string]string{"Content-Type": "text/plain"}),
+		Body: map[string]any{
+			"filename":     name,
+			"type":         driveTypeFile,
+			"content_type": mime.TypeByExtension(filepath.Ext(name)),
+			"size":         size,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("getUploadToken failed, err: %w", err)
+	}
+
+	var res []*driveUploadToken
+	if err = json.Unmarshal([]byte(text), &res); err != nil {
+		return nil, fmt.Errorf("getUploadToken unmarshal failed, err: %w, text: %s", err, text)
+	}
+	if len(res) == 0 || res[0].URL == "" {
+		return nil, fmt.Errorf("getUploadToken failed, no url in response, text: %s", text)
+	}
+	return res[0], nil
+}
+
+// uploadContent sends the file as a multipart form, and returns the checksums which are committed by updateDocument
+func (r *DriveService) uploadContent(ctx context.Context, url, name string, file io.Reader, size int64) (*driveUploadContent, error) {
+	body, bodySize, contentType, err := newMultipartFile(name, file, size)
+	if err != nil {
+		return nil, err
+	}
+
+	text, err := r.icloud.request(ctx, &rawReq{
+		Method:        http.MethodPost,
+		URL:           url,
+		Headers:       r.icloud.getCommonHeaders(map[string]string{"Content-Type": contentType}),
+		Body:          body,
+		Timeout:       transferTimeout(size),
+		ContentLength: bodySize,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("uploadContent failed, err: %w", err)
+	}
+
+	res := new(uploadDriveContentResp)
+	if err = json.Unmarshal([]byte(text), res); err != nil {
+		return nil, fmt.Errorf("uploadContent unmarshal failed, err: %w, text: %s", err, text)
+	}
+	if res.SingleFile == nil {
+		return nil, fmt.Errorf("uploadContent failed, no file in response, text: %s", text)
+	}
+	return res.SingleFile, nil
+}
+
+// updateDocument adds the uploaded content to the folder as a file, and returns the document id of the file
+func (r *DriveService) updateDocument(ctx context.Context, docEndpoint, zone, parentDocID, documentID, name string, content *driveUploadContent) (string, error) {
+	data := map[string]any{
+		"signature":           content.FileChecksum,
+		"wrapping_key":        content.WrappingKey,
+		"reference_signature": content.ReferenceChecksum,
+		"size":                content.Size,
+	}
+	if content.Receipt != "" {
+		data["receipt"] = content.Receipt
+	}
+	now := time.Now().UnixMilli()
+
+	text, err := r.icloud.request(ctx, &rawReq{
+		Method:  http.MethodPost,
+		URL:     fmt.Sprintf("%s/ws/%s/update/documents", docEndpoint, zone),
+		Headers: r.icloud.getCommonHeaders(map[string]string{"Content-Type": "text/plain"}),
+		Body: map[string]any{
+			"command":           "add_file",
+			"create_short_guid": true,
+			"document_id":       documentID,
+			"path": map[string]any{
+				"starting_document_id": parentDocID,
+				"path":                 name,
+			},
+			"allow_conflict": true,
+			"file_flags": map[string]any{
+				"is_writable":   true,
+				"is_executable": false,
+				"is_hidden":     false,
+			},
+			"mtime": now,
+			"btime": now,
+			"data":  data,
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("updateDocument failed, err: %w", err)
+	}
+
+	res := new(updateDriveDocumentResp)
+	if err = json.Unmarshal([]byte(text), res); err != nil {
+		return "", fmt.Errorf("updateDocument unmarshal failed, err: %w, text: %s", err, text)
+	}
+	if len(res.Results) == 0 {
+		return "", fmt.Errorf("updateDocument failed, no result in response, text: %s", text)
+	}
+	if status := res.Results[0].Status; status.StatusCode != 0 {
+		return "", fmt.Errorf("updateDocument failed, status: %d, err: %s", status.StatusCode, status.ErrorMessage)
+	}
+	if res.Results[0].Document.DocumentID != "" {
+		return res.Results[0].Document.DocumentID, nil
+	}
+	return documentID, nil
+}
+
+// getDriveItem returns the item by the drivewsid, the item may be a file or a folder
+func (r *DriveService) getDriveItem(ctx context.Context, driveID string) (*DriveFolder, error) {
+	text, err := r.icloud.request(ctx, &rawReq{
+		Method:     http.MethodPost,
+		URL:        r.serviceEndpoint + "/retrieveItemDetails",
+		Idempotent: true,
+		Headers:    r.icloud.getCommonHeaders(map[string]string{"Content-type": "text/plain"}),
+		Body:       fmt.Sprintf(`{"items":[{"drivewsid":"%s","partialData":false}]}`, driveID),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("getDriveItem failed, err: %w", err)
+	}
+
+	res := new(getDriveItemResp)
+	if err = json.Unmarshal([]byte(text), res); err != nil {
+		return nil, fmt.Errorf("getDriveItem unmarshal failed, err: %w, text: %s", err, text)
+	}
+	if len(res.Items) == 0 || res.Items[0].Drivewsid == "" {
+		return nil, fmt.Errorf("getDriveItem failed, %s not found", driveID)
+	}
+	return res.Items[0], nil
+}
+
+// parseDriveID splits the drivewsid, e.g. FOLDER::com.apple.CloudDocs::root, into the zone and the docwsid
+func parseDriveID(driveID string) (string, string, error) {
+	parts := strings.SplitN(driveID, "::", 3)
+	if len(parts) != 3 || parts[1] == "" || parts[2] == "" {
+		return "", "", fmt.Errorf("invalid drive id: %s", driveID)
+	}
+	return parts[1], parts[2], nil
+}
+
+// multipartFile streams the file as the only part of a multipart form, it can be rewound to the start if the file is an
+// io.Seeker, so the failed upload is retried.
+type multipartFile struct {
+	head   []byte
+	tail   []byte
+	file   io.Reader
+	reader io.Reader
+	read   int64
+}
+
+type multipartFileSeeker struct {
+	*multipartFile
+	start int64
+}
+
+// newMultipartFile returns the form body, the size of the form(0 if fileSize is unknown) and the content type
+func newMultipartFile(name string, file io.Reader, fileSize int64) (io.Reader, int64, string, error) {
+	buf := new(bytes.Buffer)
+	writer := multipart.NewWriter(buf)
+	if _, err := writer.CreateFormFile(name, name); err != nil {
+		return nil, 0, "", err
+	}
+	head := append([]byte(nil), buf.Bytes()...)
+	buf.Reset()
+	if err := writer.Close(); err != nil {
+		return nil, 0, "", err
+	}
+
+	r := &multipartFile{head: head, tail: buf.Bytes(), file: file}
+	r.reader = io.MultiReader(bytes.NewReader(r.head), r.file, bytes.NewReader(r.tail))
+	size := int64(0)
+	if fileSize > 0 {
+		size = int64(len(r.head)) + fileSize + int64(len(r.tail))
+	}
+	if seeker, ok := file.(io.Seeker); ok {
+		start, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, 0, "", err
+		}
+		return &multipartFileSeeker{multipartFile: r, start: start}, size, writer.FormDataContentType(), nil
+	}
+	return r, size, writer.FormDataContentType(), nil
+}
+
+func (r *multipartFile) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.read += int64(n)
+	return n, err
+}
+
+// Seek only supports getting the current offset and rewinding to the start, which are used by the retry
+func (r *multipartFileSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch {
+	case whence == io.SeekCurrent && offset == 0:
+		return r.read, nil
+	case whence == io.SeekStart && offset == 0:
+		if _, err := r.file.(io.Seeker).Seek(r.start, io.SeekStart); err != nil {
+			return 0, err
+		}
+		r.read = 0
+		r.reader = io.MultiReader(bytes.NewReader(r.head), r.file, bytes.NewReader(r.tail))
+		return 0, nil
+	default:
+		return 0, errors.New("multipart file only supports seeking to the start")
+	}
+}
+
+type driveUploadToken struct {
+	URL        string `json:"url"`
+	DocumentID string `json:"document_id"`
+}
+
+type driveUploadContent struct {
+	FileChecksum      string `json:"fileChecksum"`
+	WrappingKey       string `json:"wrappingKey"`
+	ReferenceChecksum string `json:"referenceChecksum"`
+	Size              int64  `json:"size"`
+	Receipt           string `json:"receipt"`
+}
+
+type uploadDriveContentResp struct {
+	SingleFile *driveUploadContent `json:"singleFile"`
+}
+
+type updateDriveDocumentResp struct {
+	Results []struct {
+		Status struct {
+			StatusCode   int    `json:"status_code"`
+			ErrorMessage string `json:"error_message"`
+		} `json:"status"`
+		Document struct {
+			DocumentID string `json:"document_id"`
+		} `json:"document"`
+	} `json:"results"`
+}
+
+type getDriveItemResp struct {
+	Items []*DriveFolder `json:"items"`
+}
@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+)
+
+// DriveFS is the read-only fs.FS of iCloud Drive, it implements fs.ReadDirFS and fs.StatFS.
+//
+// The paths are relative to the root of iCloud Drive without the leading slash, e.g. Documents/tax/2024.pdf, the paths
+// are resolved by Stat and ReadDir of the DriveService, so the listed folders are cached in the same way.
+type DriveFS struct {
+	drive *DriveService
+	ctx   context.Context
+}
+
+var (
+	_ fs.ReadDirFS = (*DriveFS)(nil)
+	_ fs.StatFS    = (*DriveFS)(nil)
+)
+
+// FS returns the fs.FS of iCloud Drive, e.g. http.FileServer(http.FS(drive.FS())) serves iCloud Drive.
+func (r *DriveService) FS() *DriveFS {
+	return r.FSContext(context.Background())
+}
+
+// FSContext returns the fs.FS whose requests are made with ctx.
+func (r *DriveService) FSContext(ctx context.Context) *DriveFS {
+	return &DriveFS{drive: r, ctx: ctx}
+}
+
+func (r *DriveFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	item, err := r.drive.StatContext(r.ctx, name)
+	if err != nil {
+		return nil, fsPathError("open", name, err)
+	}
+
+	info := newDriveFileInfo(name, item)
+	if item.IsFile() {
+		return &fsFile{path: name, info: info, open: func(offset int64) (io.ReadCloser, error) {
+			body, _, err := r.drive.openDriveFile(r.ctx, item, offset)
+			return body, err
+		}}, nil
+	}
+	entries, err := r.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	return &fsDir{path: name, info: info, entries: entries}, nil
+}
+
+// ReadDir returns the items in the folder sorted by the name.
+func (r *DriveFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	items, err := r.drive.ReadDirContext(r.ctx, name)
+	if err != nil {
+		return nil, fsPathError("readdir", name, err)
+	}
+
+	entries := make([]fs.DirEntry, 0, len(items))
+	for _, item := range items {
+		entries = append(entries, newDriveFileInfo(item.FullName(), item))
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+func (r *DriveFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	item, err := r.drive.StatContext(r.ctx, name)
+	if err != nil {
+		return nil, fsPathError("stat", name, err)
+	}
+	return newDriveFileInfo(name, item), nil
+}
+
+// newDriveFileInfo returns the info of the item, the Sys of the info is the *DriveFolder
+func newDriveFileInfo(name string, item *DriveFolder) *fsFileInfo {
+	modTime := item.DateModified
+	if modTime.IsZero() {
+		modTime = item.DateCreated
+	}
+	return &fsFileInfo{
+		name:    path.Base(name),
+		size:    int64(item.Size),
+		modTime: modTime,
+		isDir:   item.IsFolder(),
+		sys:     item,
+	}
+}
@@ -0,0 +1,22 @@
+package internal_test
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/chyroc/icloudgo/icloudtest"
+)
+
+func TestDriveFS(t *testing.T) {
+	server := icloudtest.NewServer()
+	defer server.Close()
+	docs := server.AddDriveFolder("Documents", icloudtest.DriveRootID)
+	tax := server.AddDriveFolder("tax", docs.ID)
+	server.AddDriveFile("2024.pdf", tax.ID, []byte("pdf"))
+	server.AddDriveFile("a.txt", docs.ID, []byte("hello"))
+	driveCli := newTestDriveService(t, server)
+
+	if err := fstest.TestFS(driveCli.FS(), "Documents/a.txt", "Documents/tax/2024.pdf"); err != nil {
+		t.Fatal(err)
+	}
+}
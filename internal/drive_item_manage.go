@@ -0,0 +1,165 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// Rename renames the file or the folder, and returns the refreshed item.
+//
+// The etag of the item must be the latest, otherwise ErrDriveEtagConflict is returned, the item should be fetched again then.
+func (r *DriveService) Rename(item *DriveFolder, name string) (*DriveFolder, error) {
+	return r.RenameContext(context.Background(), item, name)
+}
+
+func (r *DriveService) RenameContext(ctx context.Context, item *DriveFolder, name string) (*DriveFolder, error) {
+	req := map[string]any{"drivewsid": item.Drivewsid, "etag": item.Etag, "name": name}
+	// the name of the file is split into the name and the extension like the listed items
+	if item.IsFile() {
+		if ext := path.Ext(name); ext != "" && ext != name {
+			req["name"] = strings.TrimSuffix(name, ext)
+			req["extension"] = strings.TrimPrefix(ext, ".")
+		} else {
+			req["extension"] = ""
+		}
+	}
+	return r.modifyDriveItem(ctx, "renameItems", item, map[string]any{"items": []any{req}})
+}
+
+// Move moves the file or the folder to the folder, and returns the refreshed item.
+func (r *DriveService) Move(item *DriveFolder, destinationID string) (*DriveFolder, error) {
+	return r.MoveContext(context.Background(), item, destinationID)
+}
+
+func (r *DriveService) MoveContext(ctx context.Context, item *DriveFolder, destinationID string) (*DriveFolder, error) {
+	return r.modifyDriveItem(ctx, "moveItems", item, map[string]any{
+		"destinationDrivewsId": destinationID,
+		"items":                []any{map[string]any{"drivewsid": item.Drivewsid, "etag": item.Etag, "clientId": r.icloud.clientID}},
+	})
+}
+
+// MoveToTrash moves the file or the folder to the trash, and returns the refreshed item, it can be restored by
+// RestoreFromTrash until the trash is emptied.
+func (r *DriveService) MoveToTrash(item *DriveFolder) (*DriveFolder, error) {
+	return r.MoveToTrashContext(context.Background(), item)
+}
+
+func (r *DriveService) MoveToTrashContext(ctx context.Context, item *DriveFolder) (*DriveFolder, error) {
+	return r.modifyDriveItem(ctx, "moveItemsToTrash", item, map[string]any{
+		"items": []any{map[string]any{"drivewsid": item.Drivewsid, "etag": item.Etag, "clientId": r.icloud.clientID}},
+	})
+}
+
+// RestoreFromTrash moves the item in the trash back to its folder, and returns the refreshed item.
+func (r *DriveService) RestoreFromTrash(item *DriveFolder) (*DriveFolder, error) {
+	return r.RestoreFromTrashContext(context.Background(), item)
+}
+
+func (r *DriveService) RestoreFromTrashContext(ctx context.Context, item *DriveFolder) (*DriveFolder, error) {
+	return r.modifyDriveItem(ctx, "putBackItemsFromTrash", item, map[string]any{
+		"items": []any{map[string]any{"drivewsid": item.Drivewsid, "etag": item.Etag}},
+	})
+}
+
+// EmptyTrash deletes all the items in the trash permanently, and returns the number of the deleted items.
+func (r *DriveService) EmptyTrash() (int, error) {
+	return r.EmptyTrashContext(context.Background())
+}
+
+func (r *DriveService) EmptyTrashContext(ctx context.Context) (int, error) {
+	_, items, err := r.getDriveFolders(ctx, DriveTrashID)
+	if err != nil {
+		return 0, err
+	}
+	if len(items) == 0 {
+		return 0, nil
+	}
+
+	var reqItems []any
+	for _, item := range items {
+		reqItems = append(reqItems, map[string]any{"drivewsid": item.Drivewsid, "etag": item.Etag})
+	}
+	res, err := r.modifyDriveItems(ctx, "deleteItems", map[string]any{"items": reqItems})
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	var errs []string
+	for _, v := range res.Items {
+		if err := v.err(); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", v.Drivewsid, err))
+			continue
+		}
+		deleted++
+	}
+	if len(errs) > 0 {
+		return deleted, fmt.Errorf("empty trash failed, %d of %d items failed: %s", len(errs), len(items), strings.Join(errs, "; "))
+	}
+	return deleted, nil
+}
+
+// modifyDriveItem applies the change of one item, and fetches the item again, because the response of some changes only
+// contains the id and the status.
+func (r *DriveService) modifyDriveItem(ctx context.Context, action string, item *DriveFolder, body map[string]any) (*DriveFolder, error) {
+	res, err := r.modifyDriveItems(ctx, action, body)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Items) == 0 {
+		return nil, fmt.Errorf("%s %s failed, no item in response", action, item.Drivewsid)
+	}
+	if err := res.Items[0].err(); err != nil {
+		return nil, fmt.Errorf("%s %s failed: %w", action, item.Drivewsid, err)
+	}
+
+	driveID := item.Drivewsid
+	if res.Items[0].Drivewsid != "" {
+		driveID = res.Items[0].Drivewsid
+	}
+	return r.getDriveItem(ctx, driveID)
+}
+
+func (r *DriveService) modifyDriveItems(ctx context.Context, action string, body map[string]any) (*modifyDriveItemsResp, error) {
+	text, err := r.icloud.request(ctx, &rawReq{
+		Method:  http.MethodPost,
+		URL:     r.serviceEndpoint + "/" + action,
+		Headers: r.icloud.getCommonHeaders(map[string]string{"Content-type": "text/plain"}),
+		Body:    body,
+	})
+	r.ClearCache()
+	if err != nil {
+		return nil, fmt.Errorf("%s failed, err: %w", action, err)
+	}
+
+	res := new(modifyDriveItemsResp)
+	if err = json.Unmarshal([]byte(text), res); err != nil {
+		return nil, fmt.Errorf("%s unmarshal failed, err: %w, text: %s", action, err, text)
+	}
+	return res, nil
+}
+
+type modifyDriveItemsResp struct {
+	Items []*modifyDriveItemResult `json:"items"`
+}
+
+type modifyDriveItemResult struct {
+	Drivewsid string `json:"drivewsid"`
+	Etag      string `json:"etag"`
+	Status    string `json:"status"`
+}
+
+func (r *modifyDriveItemResult) err() error {
+	switch r.Status {
+	case "", "OK":
+		return nil
+	case "ETAG_CONFLICT":
+		return ErrDriveEtagConflict
+	default:
+		return NewError(r.Status, "drive item change failed")
+	}
+}
@@ -0,0 +1,69 @@
+package internal_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/chyroc/icloudgo/icloudtest"
+	"github.com/chyroc/icloudgo/internal"
+)
+
+func TestDriveManage(t *testing.T) {
+	server := icloudtest.NewServer()
+	defer server.Close()
+	docs := server.AddDriveFolder("Documents", icloudtest.DriveRootID)
+	file := server.AddDriveFile("a.txt", icloudtest.DriveRootID, []byte("a"))
+	driveCli := newTestDriveService(t, server)
+
+	item, err := driveCli.Stat("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	renamed, err := driveCli.Rename(item, "b.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := server.DriveItem(file.ID).Name; name != "b.md" {
+		t.Fatalf("name: %q, expect b.md", name)
+	}
+	// the item before the rename is outdated
+	if _, err := driveCli.Move(item, docs.ID); !errors.Is(err, internal.ErrDriveEtagConflict) {
+		t.Fatalf("expect etag conflict, got %v", err)
+	}
+
+	moved, err := driveCli.Move(renamed, docs.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parentID := server.DriveItem(file.ID).ParentID; parentID != docs.ID {
+		t.Fatalf("parent: %q, expect %q", parentID, docs.ID)
+	}
+
+	trashed, err := driveCli.MoveToTrash(moved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := driveCli.RestoreFromTrash(trashed); err != nil {
+		t.Fatal(err)
+	}
+	if parentID := server.DriveItem(file.ID).ParentID; parentID != docs.ID {
+		t.Fatalf("parent after restore: %q, expect %q", parentID, docs.ID)
+	}
+
+	// the folder in the trash is deleted with its files
+	folder, err := driveCli.Stat("Documents")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := driveCli.MoveToTrash(folder); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := driveCli.EmptyTrash(); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatalf("deleted: %d, expect 1", n)
+	}
+	if server.DriveItem(docs.ID) != nil || server.DriveItem(file.ID) != nil {
+		t.Fatal("the items in the trash are not deleted")
+	}
+}
@@ -0,0 +1,198 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// FullName returns the name with the extension, the file is listed with the name and the extension split.
+func (r *DriveFolder) FullName() string {
+	if r.Extension != "" {
+		return r.Name + "." + r.Extension
+	}
+	return r.Name
+}
+
+// IsFolder returns true if the item can contain other items, e.g. the folders, the app libraries and the root.
+func (r *DriveFolder) IsFolder() bool {
+	return !r.IsFile()
+}
+
+// Stat returns the item by the path, e.g. /Documents/tax/2024.pdf, the path is relative to the root of iCloud Drive.
+//
+// The resolved items are cached, the changes made by the DriveService clear the cache, the changes made by other clients
+// are not seen until ClearCache is called. The error wraps fs.ErrNotExist if the path does not exist.
+func (r *DriveService) Stat(name string) (*DriveFolder, error) {
+	return r.StatContext(context.Background(), name)
+}
+
+func (r *DriveService) StatContext(ctx context.Context, name string) (*DriveFolder, error) {
+	name = CleanDrivePath(name)
+	if item := r.getCachedPath(name); item != nil {
+		return item, nil
+	}
+	if name == "/" {
+		folder, err := r.getDriveFolder(ctx, DriveRootID)
+		if err != nil {
+			return nil, err
+		} else if folder == nil {
+			return nil, fmt.Errorf("stat /: %w", fs.ErrNotExist)
+		}
+		r.setCachedItems(name, &folder.DriveFolder, folder.Items)
+		return &folder.DriveFolder, nil
+	}
+
+	parent, err := r.StatContext(ctx, path.Dir(name))
+	if err != nil {
+		return nil, err
+	}
+	if !parent.IsFolder() {
+		return nil, fmt.Errorf("stat %s: %s is not a folder: %w", name, path.Dir(name), fs.ErrNotExist)
+	}
+	items, err := r.readDir(ctx, path.Dir(name), parent)
+	if err != nil {
+		return nil, err
+	}
+	base := path.Base(name)
+	for _, item := range items {
+		if item.FullName() == base {
+			return item, nil
+		}
+	}
+	return nil, fmt.Errorf("stat %s: %w", name, fs.ErrNotExist)
+}
+
+// ReadDir returns the items in the folder of the path, sorted as iCloud Drive returns.
+func (r *DriveService) ReadDir(name string) ([]*DriveFolder, error) {
+	return r.ReadDirContext(context.Background(), name)
+}
+
+func (r *DriveService) ReadDirContext(ctx context.Context, name string) ([]*DriveFolder, error) {
+	name = CleanDrivePath(name)
+	folder, err := r.StatContext(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if !folder.IsFolder() {
+		return nil, fmt.Errorf("readdir %s: not a folder", name)
+	}
+	return r.readDir(ctx, name, folder)
+}
+
+// DriveWalkFunc is called for each item visited by Walk, the path is the path of the item.
+//
+// If the folder can not be read, it is called with the error, the walk stops if the returned error is not nil, except
+// fs.SkipDir, which skips the folder, or the remaining items of the folder if the item is a file.
+type DriveWalkFunc func(path string, item *DriveFolder, err error) error
+
+// Walk walks the item of the path and all the items under it in lexical order, like filepath.Walk.
+func (r *DriveService) Walk(root string, fn DriveWalkFunc) error {
+	return r.WalkContext(context.Background(), root, fn)
+}
+
+func (r *DriveService) WalkContext(ctx context.Context, root string, fn DriveWalkFunc) error {
+	root = CleanDrivePath(root)
+	item, err := r.StatContext(ctx, root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = r.walk(ctx, root, item, fn)
+	}
+	if errors.Is(err, fs.SkipDir) {
+		return nil
+	}
+	return err
+}
+
+func (r *DriveService) walk(ctx context.Context, name string, item *DriveFolder, fn DriveWalkFunc) error {
+	if !item.IsFolder() {
+		return fn(name, item, nil)
+	}
+
+	items, err := r.readDir(ctx, name, item)
+	err1 := fn(name, item, err)
+	if err != nil || err1 != nil {
+		return err1
+	}
+	items = append([]*DriveFolder(nil), items...)
+	sortDriveItems(items)
+	for _, child := range items {
+		if err := r.walk(ctx, path.Join(name, child.FullName()), child, fn); err != nil {
+			if !errors.Is(err, fs.SkipDir) {
+				return err
+			}
+			if !child.IsFolder() {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// ClearCache forgets the resolved paths and the listed folders.
+func (r *DriveService) ClearCache() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.pathCache = map[string]*DriveFolder{}
+	r.itemsCache = map[string][]*DriveFolder{}
+}
+
+// readDir returns the items of the folder, and caches the paths of the items
+func (r *DriveService) readDir(ctx context.Context, name string, folder *DriveFolder) ([]*DriveFolder, error) {
+	if items, ok := r.getCachedItems(folder.Drivewsid); ok {
+		return items, nil
+	}
+	res, err := r.getDriveFolder(ctx, folder.Drivewsid)
+	if err != nil {
+		return nil, err
+	}
+	var items []*DriveFolder
+	if res != nil {
+		items = res.Items
+	}
+	r.setCachedItems(name, folder, items)
+	return items, nil
+}
+
+func (r *DriveService) getCachedPath(name string) *DriveFolder {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.pathCache[name]
+}
+
+func (r *DriveService) getCachedItems(driveID string) ([]*DriveFolder, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	items, ok := r.itemsCache[driveID]
+	return items, ok
+}
+
+func (r *DriveService) setCachedItems(name string, folder *DriveFolder, items []*DriveFolder) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.pathCache[name] = folder
+	r.itemsCache[folder.Drivewsid] = items
+	for _, item := range items {
+		r.pathCache[path.Join(name, item.FullName())] = item
+	}
+}
+
+// CleanDrivePath returns the absolute path in iCloud Drive, e.g. Documents/../tax/ is /tax
+func CleanDrivePath(name string) string {
+	return path.Clean("/" + strings.TrimPrefix(name, "/"))
+}
+
+func sortDriveItems(items []*DriveFolder) {
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].FullName() < items[j].FullName()
+	})
+}
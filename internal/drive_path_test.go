@@ -0,0 +1,63 @@
+package internal_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/chyroc/icloudgo/icloudtest"
+	"github.com/chyroc/icloudgo/internal"
+)
+
+func TestDriveWalk(t *testing.T) {
+	server := icloudtest.NewServer()
+	defer server.Close()
+	docs := server.AddDriveFolder("Documents", icloudtest.DriveRootID)
+	tax := server.AddDriveFolder("tax", docs.ID)
+	server.AddDriveFile("2024.pdf", tax.ID, []byte("pdf"))
+	server.AddDriveFile("a.txt", docs.ID, []byte("a"))
+	driveCli := newTestDriveService(t, server)
+
+	if item, err := driveCli.Stat("/Documents/tax/2024.pdf"); err != nil {
+		t.Fatal(err)
+	} else if !item.IsFile() || item.Size != 3 {
+		t.Fatalf("unexpected item: %+v", item)
+	}
+
+	var paths []string
+	err := driveCli.Walk("Documents/", func(path string, item *internal.DriveFolder, err error) error {
+		if err != nil {
+			return err
+		}
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"/Documents", "/Documents/a.txt", "/Documents/tax", "/Documents/tax/2024.pdf"}
+	if !reflect.DeepEqual(paths, expect) {
+		t.Fatalf("walked paths: %v, expect %v", paths, expect)
+	}
+}
+
+func TestDriveReadDirPartial(t *testing.T) {
+	server := icloudtest.NewServer()
+	defer server.Close()
+	server.AddDriveFile("a.txt", icloudtest.DriveRootID, []byte("a"))
+	server.AddDriveFile("b.txt", icloudtest.DriveRootID, []byte("b"))
+	server.DriveListLimit = 1
+	driveCli := newTestDriveService(t, server)
+
+	// the partial listing is returned as the server lists it
+	items, err := driveCli.ReadDir("/")
+	if err != nil {
+		t.Fatal(err)
+	} else if len(items) != 1 || items[0].FullName() != "a.txt" {
+		t.Fatalf("unexpected items: %v", items)
+	}
+	if total, _, err := driveCli.Folders(icloudtest.DriveRootID); err != nil {
+		t.Fatal(err)
+	} else if total != 2 {
+		t.Fatalf("number of items: %d, expect 2", total)
+	}
+}
@@ -11,6 +11,12 @@ var (
 	ErrValidateCodeWrong = NewError("-21669", "validate code wrong")
 	ErrPhotosIterateEnd  = NewError("photos_iterate_end", "photos iterate end")
 	ErrResourceGone      = NewHttpError(410, "resource gone")
+	ErrSyncTokenExpired  = NewError("sync_token_expired", "sync token expired")
+
+	ErrChecksumMismatch    = NewError("checksum_mismatch", "checksum mismatch")
+	ErrChecksumUnsupported = NewError("checksum_unsupported", "checksum unsupported")
+
+	ErrDriveEtagConflict = NewError("ETAG_CONFLICT", "drive item is modified, the etag is outdated")
 )
 
 type Error struct {
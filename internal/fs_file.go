@@ -0,0 +1,153 @@
+package internal
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// fsFileInfo is the fs.FileInfo and the fs.DirEntry of the remote file or dir, the files are read-only.
+type fsFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	isDir   bool
+	sys     any
+}
+
+func (r *fsFileInfo) Name() string       { return r.name }
+func (r *fsFileInfo) Size() int64        { return r.size }
+func (r *fsFileInfo) ModTime() time.Time { return r.modTime }
+func (r *fsFileInfo) IsDir() bool        { return r.isDir }
+func (r *fsFileInfo) Sys() any           { return r.sys }
+
+func (r *fsFileInfo) Mode() fs.FileMode {
+	if r.isDir {
+		return fs.ModeDir | 0o555
+	}
+	return 0o444
+}
+
+func (r *fsFileInfo) Type() fs.FileMode {
+	return r.Mode().Type()
+}
+
+func (r *fsFileInfo) Info() (fs.FileInfo, error) {
+	return r, nil
+}
+
+// fsDir is the opened dir, the entries are listed before it is opened
+type fsDir struct {
+	path    string
+	info    *fsFileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (r *fsDir) Stat() (fs.FileInfo, error) {
+	return r.info, nil
+}
+
+func (r *fsDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: r.path, Err: errors.New("is a directory")}
+}
+
+func (r *fsDir) Close() error {
+	return nil
+}
+
+func (r *fsDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	entries := r.entries[r.offset:]
+	if n > 0 && len(entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > 0 && len(entries) > n {
+		entries = entries[:n]
+	}
+	r.offset += len(entries)
+	return entries, nil
+}
+
+// fsFile is the opened file, the content is requested at the first read, and requested again from the new offset after
+// it is seeked, so http.FileServer can serve the range requests.
+type fsFile struct {
+	path   string
+	info   *fsFileInfo
+	open   func(offset int64) (io.ReadCloser, error)
+	offset int64
+	body   io.ReadCloser
+}
+
+func (r *fsFile) Stat() (fs.FileInfo, error) {
+	return r.info, nil
+}
+
+func (r *fsFile) Read(p []byte) (int, error) {
+	if r.offset >= r.info.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		body, err := r.open(r.offset)
+		if err != nil {
+			return 0, &fs.PathError{Op: "read", Path: r.path, Err: err}
+		}
+		r.body = body
+	}
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *fsFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.info.size
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: r.path, Err: fs.ErrInvalid}
+	}
+	if offset != r.offset && r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *fsFile) Close() error {
+	if r.body != nil {
+		err := r.body.Close()
+		r.body = nil
+		return err
+	}
+	return nil
+}
+
+// rangeBody returns the body from the offset of the response to the Range request, the head of the body is skipped if
+// the server ignores the range
+func rangeBody(resp *http.Response, offset int64) (io.ReadCloser, error) {
+	switch {
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		resp.Body.Close()
+		return io.NopCloser(strings.NewReader("")), nil
+	case offset > 0 && resp.StatusCode != http.StatusPartialContent:
+		if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+	}
+	return resp.Body, nil
+}
+
+// fsPathError returns the error of the fs.FS method, fs.ErrNotExist is kept so errors.Is works with the error
+func fsPathError(op, name string, err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		err = fs.ErrNotExist
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
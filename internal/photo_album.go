@@ -1,8 +1,11 @@
 package internal
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 )
 
@@ -20,6 +23,14 @@ const (
 	AlbumNameHidden          = "Hidden"
 )
 
+const (
+	albumTypeAlbum  = 0
+	albumTypeFolder = 3
+
+	// rootFolderID is the parent of the top albums and folders
+	rootFolderID = "----Root-Folder----"
+)
+
 type PhotoAlbum struct {
 	// service
 	service *PhotoService
@@ -29,18 +40,32 @@ type PhotoAlbum struct {
 	ListType    string
 	ObjType     string
 	Direction   string
-	QueryFilter []*folderMetaDataQueryFilter
+	QueryFilter []*PhotoQueryFilter
+
+	// ID is the record name of the user album, empty for the smart albums
+	ID string
+	// ParentID is the record name of the folder contains the user album, empty if the album is at the top
+	ParentID string
+	// Folders are the names of the folders contain the album, from the top to the bottom
+	Folders []string
+	// Key is the key of the album in Albums, it is the name for the smart albums, and the folders and the name joined by
+	// "/" for the user albums, e.g. Travel/Japan, the ID is appended if the key is used, e.g. "Trip (<id>)"
+	Key string
+
+	albumType int
+	changeTag string
 
 	// cache
 	_size *int64
 	lock  *sync.Mutex
 }
 
-func (r *PhotoService) newPhotoAlbum(name, listType, objType, direction string, queryFilter []*folderMetaDataQueryFilter) *PhotoAlbum {
+func (r *PhotoService) newPhotoAlbum(name, listType, objType, direction string, queryFilter []*PhotoQueryFilter) *PhotoAlbum {
 	return &PhotoAlbum{
 		service: r,
 
 		Name:        name,
+		Key:         name,
 		ListType:    listType,
 		ObjType:     objType,
 		Direction:   direction,
@@ -51,24 +76,72 @@ func (r *PhotoService) newPhotoAlbum(name, listType, objType, direction string,
 	}
 }
 
+func (r *PhotoService) newUserAlbum(id, name, parentID string, albumType int, changeTag string) *PhotoAlbum {
+	album := r.newPhotoAlbum(name, "CPLContainerRelationLiveByAssetDate", fmt.Sprintf("CPLContainerRelationNotDeletedByAssetDate:%s", id), "ASCENDING", []*PhotoQueryFilter{{
+		FieldName:  "parentId",
+		Comparator: "EQUALS",
+		FieldValue: &PhotoQueryValue{Type: "STRING", Value: id},
+	}})
+	album.ID = id
+	album.ParentID = parentID
+	album.albumType = albumType
+	album.changeTag = changeTag
+	return album
+}
+
+// IsUserAlbum returns true if the album is created by user, false for the smart albums, e.g. All Photos, Favorites.
+func (r *PhotoAlbum) IsUserAlbum() bool {
+	return strings.HasPrefix(r.ObjType, "CPLContainerRelation")
+}
+
+// path returns the folders and the name of the album joined by "/"
+func (r *PhotoAlbum) path() string {
+	return strings.Join(append(append([]string{}, r.Folders...), r.Name), "/")
+}
+
+// IsFolder returns true if the album is a folder of the user albums, the folder has no photos.
+func (r *PhotoAlbum) IsFolder() bool {
+	return r.albumType == albumTypeFolder
+}
+
 func (r *PhotoService) GetAlbum(albumName string) (*PhotoAlbum, error) {
-	albums, err := r.Albums()
+	return r.GetAlbumContext(context.Background(), albumName)
+}
+
+// GetAlbumContext returns the album by its key in Albums, or by its name if only one album has the name, empty albumName
+// returns All Photos.
+func (r *PhotoService) GetAlbumContext(ctx context.Context, albumName string) (*PhotoAlbum, error) {
+	albums, err := r.AlbumsContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	album := albums[AlbumNameAll]
-	if albumName != "" {
-		var ok bool
-		album, ok = albums[albumName]
-		if !ok {
-			return nil, fmt.Errorf("album %s not found", albumName)
+	if albumName == "" {
+		return albums[AlbumNameAll], nil
+	} else if album, ok := albums[albumName]; ok {
+		return album, nil
+	}
+	var res *PhotoAlbum
+	for _, album := range albums {
+		if album.Name != albumName {
+			continue
+		} else if res != nil {
+			return nil, fmt.Errorf("album %s is ambiguous, use the key, e.g. %s", albumName, album.Key)
 		}
+		res = album
+	}
+	if res == nil {
+		return nil, fmt.Errorf("album %s not found", albumName)
 	}
-	return album, nil
+	return res, nil
 }
 
+// Albums returns the smart albums and the user albums(including the folders) by their keys, see PhotoAlbum.Key.
 func (r *PhotoService) Albums() (map[string]*PhotoAlbum, error) {
+	return r.AlbumsContext(context.Background())
+}
+
+func (r *PhotoService) AlbumsContext(ctx context.Context) (map[string]*PhotoAlbum, error) {
 	r.lock.Lock()
 	albumIsNil := len(r._albums) == 0
 	r.lock.Unlock()
@@ -83,11 +156,22 @@ func (r *PhotoService) Albums() (map[string]*PhotoAlbum, error) {
 		tmp[name] = r.newPhotoAlbum(name, props.ListType, props.ObjType, props.Direction, props.QueryFilter)
 	}
 
-	folders, err := r.getFolders()
+	folders, err := r.getFolders(ctx)
 	if err != nil {
 		return nil, err
 	}
 
+	folderNames := map[string]string{}
+	folderParents := map[string]string{}
+	for _, folder := range folders {
+		if name, ok := folder.albumName(); ok {
+			folderNames[folder.RecordName] = name
+		}
+		folderParents[folder.RecordName] = folder.parentID()
+	}
+
+	// the albums are keyed in the order of the record names, so the same album gets the same key in every run
+	sort.Slice(folders, func(i, j int) bool { return folders[i].RecordName < folders[j].RecordName })
 	for _, folder := range folders {
 		if folder.Fields.AlbumNameEnc == nil || folder.Fields.AlbumNameEnc.Value == "" {
 			continue
@@ -95,21 +179,29 @@ func (r *PhotoService) Albums() (map[string]*PhotoAlbum, error) {
 		if folder.Fields.IsDeleted != nil && folder.Fields.IsDeleted.Value != "" {
 			continue
 		}
-		if folder.RecordName == "----Root-Folder----" {
+		if folder.RecordName == rootFolderID {
 			continue
 		}
 		folderID := folder.RecordName
-		folderObjType := fmt.Sprintf("CPLContainerRelationNotDeletedByAssetDate:%s", folderID)
 		folderName, _ := base64.StdEncoding.DecodeString(folder.Fields.AlbumNameEnc.Value.(string))
 		if len(folderName) == 0 {
 			continue
 		}
 
-		tmp[string(folderName)] = r.newPhotoAlbum(string(folderName), "CPLContainerRelationLiveByAssetDate", folderObjType, "ASCENDING", []*folderMetaDataQueryFilter{{
-			FieldName:  "parentId",
-			Comparator: "EQUALS",
-			FieldValue: &folderTypeValue{Type: "STRING", Value: folderID},
-		}})
+		album := r.newUserAlbum(folderID, string(folderName), folder.parentID(), folder.Fields.AlbumType.Value, folder.RecordChangeTag)
+		// the depth is limited, in case of the loop of the parents
+		for parentID, depth := album.ParentID, 0; parentID != "" && depth < 32; parentID, depth = folderParents[parentID], depth+1 {
+			name, ok := folderNames[parentID]
+			if !ok {
+				break
+			}
+			album.Folders = append([]string{name}, album.Folders...)
+		}
+		album.Key = album.path()
+		if _, ok := tmp[album.Key]; ok {
+			album.Key += " (" + album.ID + ")"
+		}
+		tmp[album.Key] = album
 	}
 
 	r.lock.Lock()
@@ -129,11 +221,11 @@ var icloudPhotoFolderMeta = map[string]*folderMetaData{
 		ObjType:   "CPLAssetInSmartAlbumByAssetDate:Timelapse",
 		ListType:  "CPLAssetAndMasterInSmartAlbumByAssetDate",
 		Direction: "ASCENDING",
-		QueryFilter: []*folderMetaDataQueryFilter{
+		QueryFilter: []*PhotoQueryFilter{
 			{
 				FieldName:  "smartAlbum",
 				Comparator: "EQUALS",
-				FieldValue: &folderTypeValue{Type: "STRING", Value: "TIMELAPSE"},
+				FieldValue: &PhotoQueryValue{Type: "STRING", Value: "TIMELAPSE"},
 			},
 		},
 	},
@@ -141,11 +233,11 @@ var icloudPhotoFolderMeta = map[string]*folderMetaData{
 		ObjType:   "CPLAssetInSmartAlbumByAssetDate:Video",
 		ListType:  "CPLAssetAndMasterInSmartAlbumByAssetDate",
 		Direction: "ASCENDING",
-		QueryFilter: []*folderMetaDataQueryFilter{
+		QueryFilter: []*PhotoQueryFilter{
 			{
 				FieldName:  "smartAlbum",
 				Comparator: "EQUALS",
-				FieldValue: &folderTypeValue{Type: "STRING", Value: "VIDEO"},
+				FieldValue: &PhotoQueryValue{Type: "STRING", Value: "VIDEO"},
 			},
 		},
 	},
@@ -153,11 +245,11 @@ var icloudPhotoFolderMeta = map[string]*folderMetaData{
 		ObjType:   "CPLAssetInSmartAlbumByAssetDate:Slomo",
 		ListType:  "CPLAssetAndMasterInSmartAlbumByAssetDate",
 		Direction: "ASCENDING",
-		QueryFilter: []*folderMetaDataQueryFilter{
+		QueryFilter: []*PhotoQueryFilter{
 			{
 				FieldName:  "smartAlbum",
 				Comparator: "EQUALS",
-				FieldValue: &folderTypeValue{Type: "STRING", Value: "SLOMO"},
+				FieldValue: &PhotoQueryValue{Type: "STRING", Value: "SLOMO"},
 			},
 		},
 	},
@@ -170,11 +262,11 @@ var icloudPhotoFolderMeta = map[string]*folderMetaData{
 		ObjType:   "CPLAssetInSmartAlbumByAssetDate:Favorite",
 		ListType:  "CPLAssetAndMasterInSmartAlbumByAssetDate",
 		Direction: "ASCENDING",
-		QueryFilter: []*folderMetaDataQueryFilter{
+		QueryFilter: []*PhotoQueryFilter{
 			{
 				FieldName:  "smartAlbum",
 				Comparator: "EQUALS",
-				FieldValue: &folderTypeValue{Type: "STRING", Value: "FAVORITE"},
+				FieldValue: &PhotoQueryValue{Type: "STRING", Value: "FAVORITE"},
 			},
 		},
 	},
@@ -182,11 +274,11 @@ var icloudPhotoFolderMeta = map[string]*folderMetaData{
 		ObjType:   "CPLAssetInSmartAlbumByAssetDate:Panorama",
 		ListType:  "CPLAssetAndMasterInSmartAlbumByAssetDate",
 		Direction: "ASCENDING",
-		QueryFilter: []*folderMetaDataQueryFilter{
+		QueryFilter: []*PhotoQueryFilter{
 			{
 				FieldName:  "smartAlbum",
 				Comparator: "EQUALS",
-				FieldValue: &folderTypeValue{Type: "STRING", Value: "PANORAMA"},
+				FieldValue: &PhotoQueryValue{Type: "STRING", Value: "PANORAMA"},
 			},
 		},
 	},
@@ -194,11 +286,11 @@ var icloudPhotoFolderMeta = map[string]*folderMetaData{
 		ObjType:   "CPLAssetInSmartAlbumByAssetDate:Screenshot",
 		ListType:  "CPLAssetAndMasterInSmartAlbumByAssetDate",
 		Direction: "ASCENDING",
-		QueryFilter: []*folderMetaDataQueryFilter{
+		QueryFilter: []*PhotoQueryFilter{
 			{
 				FieldName:  "smartAlbum",
 				Comparator: "EQUALS",
-				FieldValue: &folderTypeValue{Type: "STRING", Value: "SCREENSHOT"},
+				FieldValue: &PhotoQueryValue{Type: "STRING", Value: "SCREENSHOT"},
 			},
 		},
 	},
@@ -206,11 +298,11 @@ var icloudPhotoFolderMeta = map[string]*folderMetaData{
 		ObjType:   "CPLAssetInSmartAlbumByAssetDate:Live",
 		ListType:  "CPLAssetAndMasterInSmartAlbumByAssetDate",
 		Direction: "ASCENDING",
-		QueryFilter: []*folderMetaDataQueryFilter{
+		QueryFilter: []*PhotoQueryFilter{
 			{
 				FieldName:  "smartAlbum",
 				Comparator: "EQUALS",
-				FieldValue: &folderTypeValue{Type: "STRING", Value: "LIVE"},
+				FieldValue: &PhotoQueryValue{Type: "STRING", Value: "LIVE"},
 			},
 		},
 	},
@@ -227,15 +319,9 @@ var icloudPhotoFolderMeta = map[string]*folderMetaData{
 }
 
 type folderMetaData struct {
-	ListType    string                       `json:"list_type"`
-	ObjType     string                       `json:"obj_type"`
-	Direction   string                       `json:"direction"`
-	QueryFilter []*folderMetaDataQueryFilter `json:"query_filter"`
-	PageSize    int                          `json:"page_size"`
-}
-
-type folderMetaDataQueryFilter struct {
-	FieldName  string           `json:"fieldName"`
-	Comparator string           `json:"comparator"`
-	FieldValue *folderTypeValue `json:"fieldValue"`
+	ListType    string              `json:"list_type"`
+	ObjType     string              `json:"obj_type"`
+	Direction   string              `json:"direction"`
+	QueryFilter []*PhotoQueryFilter `json:"query_filter"`
+	PageSize    int                 `json:"page_size"`
 }
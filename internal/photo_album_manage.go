@@ -0,0 +1,236 @@
+package internal
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// CreateAlbum creates a user album in the folder, folder is nil for the top.
+func (r *PhotoService) CreateAlbum(name string, folder *PhotoAlbum) (*PhotoAlbum, error) {
+	return r.CreateAlbumContext(context.Background(), name, folder)
+}
+
+func (r *PhotoService) CreateAlbumContext(ctx context.Context, name string, folder *PhotoAlbum) (*PhotoAlbum, error) {
+	return r.createAlbum(ctx, name, folder, albumTypeAlbum)
+}
+
+// CreateFolder creates a folder of the user albums in the parent folder, parent is nil for the top.
+func (r *PhotoService) CreateFolder(name string, parent *PhotoAlbum) (*PhotoAlbum, error) {
+	return r.CreateFolderContext(context.Background(), name, parent)
+}
+
+func (r *PhotoService) CreateFolderContext(ctx context.Context, name string, parent *PhotoAlbum) (*PhotoAlbum, error) {
+	return r.createAlbum(ctx, name, parent, albumTypeFolder)
+}
+
+func (r *PhotoService) RenameAlbum(album *PhotoAlbum, name string) error {
+	return r.RenameAlbumContext(context.Background(), album, name)
+}
+
+func (r *PhotoService) RenameAlbumContext(ctx context.Context, album *PhotoAlbum, name string) error {
+	if name == "" {
+		return fmt.Errorf("rename album %s failed: empty name", album.Name)
+	}
+	if err := r.updateAlbum(ctx, album, map[string]any{
+		"albumNameEnc": photoFieldValue(base64.StdEncoding.EncodeToString([]byte(name))),
+	}); err != nil {
+		return fmt.Errorf("rename album %s failed: %w", album.Name, err)
+	}
+	album.Name = name
+	album.Key = album.path()
+	return nil
+}
+
+// MoveAlbum moves the album or folder into the folder, folder is nil for the top.
+func (r *PhotoService) MoveAlbum(album, folder *PhotoAlbum) error {
+	return r.MoveAlbumContext(context.Background(), album, folder)
+}
+
+func (r *PhotoService) MoveAlbumContext(ctx context.Context, album, folder *PhotoAlbum) error {
+	parentID, folders, err := albumParent(folder)
+	if err != nil {
+		return fmt.Errorf("move album %s failed: %w", album.Name, err)
+	} else if folder != nil && folder.ID == album.ID {
+		return fmt.Errorf("move album %s failed: can not move into itself", album.Name)
+	}
+
+	if err := r.updateAlbum(ctx, album, map[string]any{
+		"parentId": photoFieldValue(parentID),
+	}); err != nil {
+		return fmt.Errorf("move album %s failed: %w", album.Name, err)
+	}
+	album.ParentID = strings.TrimPrefix(parentID, rootFolderID)
+	album.Folders = folders
+	album.Key = album.path()
+	return nil
+}
+
+// DeleteAlbum deletes the album or folder, the photos in it are not deleted.
+func (r *PhotoService) DeleteAlbum(album *PhotoAlbum) error {
+	return r.DeleteAlbumContext(context.Background(), album)
+}
+
+func (r *PhotoService) DeleteAlbumContext(ctx context.Context, album *PhotoAlbum) error {
+	if err := r.updateAlbum(ctx, album, map[string]any{
+		"isDeleted": photoFieldValue(1),
+	}); err != nil {
+		return fmt.Errorf("delete album %s failed: %w", album.Name, err)
+	}
+	return nil
+}
+
+// AddAssets adds the assets to the user album, the asset already in the album is kept.
+func (r *PhotoService) AddAssets(album *PhotoAlbum, assets ...*PhotoAsset) error {
+	return r.AddAssetsContext(context.Background(), album, assets...)
+}
+
+func (r *PhotoService) AddAssetsContext(ctx context.Context, album *PhotoAlbum, assets ...*PhotoAsset) error {
+	if err := r.modifyAlbumAssets(ctx, album, assets, 0); err != nil {
+		return fmt.Errorf("add assets to album %s failed: %w", album.Name, err)
+	}
+	return nil
+}
+
+// RemoveAssets removes the assets from the user album, the assets are not deleted.
+func (r *PhotoService) RemoveAssets(album *PhotoAlbum, assets ...*PhotoAsset) error {
+	return r.RemoveAssetsContext(context.Background(), album, assets...)
+}
+
+func (r *PhotoService) RemoveAssetsContext(ctx context.Context, album *PhotoAlbum, assets ...*PhotoAsset) error {
+	if err := r.modifyAlbumAssets(ctx, album, assets, 1); err != nil {
+		return fmt.Errorf("remove assets from album %s failed: %w", album.Name, err)
+	}
+	return nil
+}
+
+func (r *PhotoService) createAlbum(ctx context.Context, name string, parent *PhotoAlbum, albumType int) (*PhotoAlbum, error) {
+	if name == "" {
+		return nil, fmt.Errorf("create album failed: empty name")
+	}
+	parentID, folders, err := albumParent(parent)
+	if err != nil {
+		return nil, fmt.Errorf("create album %s failed: %w", name, err)
+	}
+
+	id := strings.ToUpper(uuid.NewV4().String())
+	result, err := r.modifyRecord(ctx, &photoRecordOperation{
+		OperationType: "create",
+		Record: &photoModifyRecord{
+			RecordName: id,
+			RecordType: "CPLAlbum",
+			Fields: map[string]any{
+				"albumNameEnc":  photoFieldValue(base64.StdEncoding.EncodeToString([]byte(name))),
+				"albumType":     photoFieldValue(albumType),
+				"parentId":      photoFieldValue(parentID),
+				"sortAscending": photoFieldValue(1),
+				"sortType":      photoFieldValue(0),
+				"isDeleted":     photoFieldValue(0),
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create album %s failed: %w", name, err)
+	}
+	r.ResetAlbums()
+
+	album := r.newUserAlbum(id, name, strings.TrimPrefix(parentID, rootFolderID), albumType, result.RecordChangeTag)
+	album.Folders = folders
+	album.Key = album.path()
+	return album, nil
+}
+
+func (r *PhotoService) updateAlbum(ctx context.Context, album *PhotoAlbum, fields map[string]any) error {
+	if album.ID == "" {
+		return fmt.Errorf("%s is not a user album", album.Name)
+	}
+	result, err := r.modifyRecord(ctx, &photoRecordOperation{
+		OperationType: "update",
+		Record: &photoModifyRecord{
+			RecordName:      album.ID,
+			RecordType:      "CPLAlbum",
+			RecordChangeTag: album.changeTag,
+			Fields:          fields,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	album.changeTag = result.RecordChangeTag
+	r.ResetAlbums()
+	return nil
+}
+
+// modifyAlbumAssets adds(isDeleted=0) or removes(isDeleted=1) the relations between the album and the assets
+func (r *PhotoService) modifyAlbumAssets(ctx context.Context, album *PhotoAlbum, assets []*PhotoAsset, isDeleted int) error {
+	if album.ID == "" {
+		return fmt.Errorf("%s is not a user album", album.Name)
+	} else if album.IsFolder() {
+		return fmt.Errorf("%s is a folder", album.Name)
+	} else if len(assets) == 0 {
+		return nil
+	}
+
+	operations := make([]*photoRecordOperation, 0, len(assets))
+	for i, asset := range assets {
+		operationType := "forceReplace"
+		if isDeleted == 1 {
+			operationType = "forceUpdate"
+		}
+		operations = append(operations, &photoRecordOperation{
+			OperationType: operationType,
+			Record: &photoModifyRecord{
+				RecordName: fmt.Sprintf("%s-IN-%s", asset._assetRecord.RecordName, album.ID),
+				RecordType: "CPLContainerRelation",
+				Fields: map[string]any{
+					"itemId":      photoFieldValue(asset._assetRecord.RecordName),
+					"containerId": photoFieldValue(album.ID),
+					"position":    photoFieldValue(1024 * (i + 1)),
+					"isDeleted":   photoFieldValue(isDeleted),
+				},
+			},
+		})
+	}
+
+	for start := 0; start < len(operations); start += photoModifyBatchSize {
+		end := start + photoModifyBatchSize
+		if end > len(operations) {
+			end = len(operations)
+		}
+		results, err := r.modifyRecords(ctx, operations[start:end], true)
+		if err != nil {
+			return err
+		}
+		for _, result := range results {
+			if err := result.err(); err != nil {
+				return err
+			}
+		}
+	}
+
+	album.lock.Lock()
+	album._size = nil
+	album.lock.Unlock()
+	return nil
+}
+
+// albumParent returns the parentId field and the folders of the album in the parent
+func albumParent(parent *PhotoAlbum) (string, []string, error) {
+	if parent == nil {
+		return rootFolderID, nil, nil
+	} else if parent.ID == "" || !parent.IsFolder() {
+		return "", nil, fmt.Errorf("%s is not a folder", parent.Name)
+	}
+	folders := append(append([]string{}, parent.Folders...), parent.Name)
+	return parent.ID, folders, nil
+}
+
+// ResetAlbums clears the albums cache, so the next Albums fetches the changes, e.g. the albums created in other devices
+func (r *PhotoService) ResetAlbums() {
+	r.lock.Lock()
+	r._albums = map[string]*PhotoAlbum{}
+	r.lock.Unlock()
+}
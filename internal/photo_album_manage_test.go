@@ -0,0 +1,77 @@
+package internal_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/chyroc/icloudgo/icloudtest"
+)
+
+func TestAlbumManage(t *testing.T) {
+	server := icloudtest.NewServer()
+	defer server.Close()
+	a := server.AddPhoto("a.jpg", []byte("a"), time.Now())
+	b := server.AddPhoto("b.jpg", []byte("b"), time.Now())
+	photoCli := newTestPhotoService(t, server)
+
+	findAlbum := func(id string) *icloudtest.Album {
+		t.Helper()
+		for _, album := range server.Albums() {
+			if album.ID == id {
+				return album
+			}
+		}
+		t.Fatalf("album %s not found", id)
+		return nil
+	}
+
+	folder, err := photoCli.CreateFolder("Trips", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	album, err := photoCli.CreateAlbum("Japan", folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if album.Key != "Trips/Japan" {
+		t.Fatalf("key: %q, expect Trips/Japan", album.Key)
+	}
+	if v := findAlbum(album.ID); v.Name != "Japan" || v.ParentID != folder.ID || !findAlbum(folder.ID).IsFolder {
+		t.Fatalf("unexpected album: %+v", v)
+	}
+
+	if err := photoCli.AddAssets(album, getTestAsset(t, photoCli, a.ID), getTestAsset(t, photoCli, b.ID)); err != nil {
+		t.Fatal(err)
+	}
+	if err := photoCli.RemoveAssets(album, getTestAsset(t, photoCli, a.ID)); err != nil {
+		t.Fatal(err)
+	}
+	if ids := findAlbum(album.ID).PhotoIDs; !reflect.DeepEqual(ids, []string{b.ID}) {
+		t.Fatalf("photos of the album: %v, expect %v", ids, []string{b.ID})
+	}
+
+	if err := photoCli.RenameAlbum(album, "Tokyo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := photoCli.MoveAlbum(album, nil); err != nil {
+		t.Fatal(err)
+	}
+	if v := findAlbum(album.ID); v.Name != "Tokyo" || v.ParentID != "" || album.Key != "Tokyo" {
+		t.Fatalf("unexpected album: %+v, key: %q", v, album.Key)
+	}
+	// the album can not be moved into an album
+	if err := photoCli.MoveAlbum(folder, album); err == nil {
+		t.Fatal("expect error of moving into an album")
+	}
+
+	if err := photoCli.DeleteAlbum(album); err != nil {
+		t.Fatal(err)
+	}
+	if !findAlbum(album.ID).IsDeleted {
+		t.Fatal("album is not deleted")
+	}
+	if server.Photo(b.ID) == nil {
+		t.Fatal("the photo of the deleted album is deleted")
+	}
+}
@@ -1,64 +1,47 @@
 package internal
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 )
 
 func (r *PhotoAlbum) PhotosIter(startOffset int64) PhotosIterNext {
+	return r.PhotosIterContext(context.Background(), startOffset)
+}
+
+// PhotosIterContext returns an iterator, all the requests of the iterator use ctx.
+func (r *PhotoAlbum) PhotosIterContext(ctx context.Context, startOffset int64) PhotosIterNext {
 	if r.Direction == "DESCENDING" {
-		startOffset = r.Size() - 1 - startOffset
+		startOffset = r.sizeContext(ctx) - 1 - startOffset
 	}
-	return newPhotosIterNext(r, startOffset)
+	return newPhotosIterNext(ctx, r, startOffset)
 }
 
 func (r *PhotoAlbum) GetPhotosByOffset(offset, limit int64) ([]*PhotoAsset, error) {
-	var assets []*PhotoAsset
+	return r.GetPhotosByOffsetContext(context.Background(), offset, limit)
+}
 
-	text, err := r.service.icloud.request(&rawReq{
-		Method:  "POST",
-		URL:     fmt.Sprintf("%s/records/query", r.service.serviceEndpoint),
-		Querys:  r.service.querys,
-		Headers: r.service.icloud.getCommonHeaders(map[string]string{}),
-		Body:    r.listQueryGenerate(offset, limit, r.ListType, r.Direction, r.QueryFilter),
-	})
+func (r *PhotoAlbum) GetPhotosByOffsetContext(ctx context.Context, offset, limit int64) ([]*PhotoAsset, error) {
+	res, err := r.listQuery(offset, limit).DoContext(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("get album photos failed, err: %w", err)
 	}
-	res := new(getPhotosResp)
-	if err = json.Unmarshal([]byte(text), res); err != nil {
-		return nil, fmt.Errorf("get album photos unmarshal failed, err: %w", err)
-	}
-
-	var masterRecords []*photoRecord
-	assetRecords := map[string]*photoRecord{}
-	for _, record := range res.Records {
-		if record.RecordType == "CPLAsset" {
-			masterID := record.Fields.MasterRef.Value.RecordName
-			assetRecords[masterID] = record
-		} else if record.RecordType == "CPLMaster" {
-			masterRecords = append(masterRecords, record)
-		}
-	}
-
-	for _, masterRecord := range masterRecords {
-		assets = append(assets,
-			r.service.newPhotoAsset(masterRecord, assetRecords[masterRecord.RecordName]),
-		)
-	}
-
-	return assets, nil
+	return res.Assets, nil
 }
 
 func (r *PhotoAlbum) GetPhotosByCount(count int) ([]*PhotoAsset, error) {
+	return r.GetPhotosByCountContext(context.Background(), count)
+}
+
+func (r *PhotoAlbum) GetPhotosByCountContext(ctx context.Context, count int) ([]*PhotoAsset, error) {
 	offset := int64(0)
 	if r.Direction == "DESCENDING" {
-		offset = r.Size() - 1
+		offset = r.sizeContext(ctx) - 1
 	}
 
 	var assets []*PhotoAsset
 	for {
-		tmp, err := r.GetPhotosByOffset(offset, 200)
+		tmp, err := r.GetPhotosByOffsetContext(ctx, offset, 200)
 		if err != nil {
 			return nil, err
 		}
@@ -78,12 +61,16 @@ func (r *PhotoAlbum) GetPhotosByCount(count int) ([]*PhotoAsset, error) {
 }
 
 func (r *PhotoAlbum) WalkPhotos(offset int64, f func(offset int64, assets []*PhotoAsset) error) error {
-	size := r.Size()
+	return r.WalkPhotosContext(context.Background(), offset, f)
+}
+
+func (r *PhotoAlbum) WalkPhotosContext(ctx context.Context, offset int64, f func(offset int64, assets []*PhotoAsset) error) error {
+	size := r.sizeContext(ctx)
 	if r.Direction == "DESCENDING" {
 		offset = size - 1 - offset
 	}
 	for {
-		tmp, err := r.GetPhotosByOffset(offset, 200)
+		tmp, err := r.GetPhotosByOffsetContext(ctx, offset, 200)
 		if err != nil {
 			return err
 		}
@@ -109,133 +96,114 @@ func (r *PhotoAlbum) calOffset(offset, lastAssetLen int64) int64 {
 	return offset
 }
 
-func (r *PhotoAlbum) listQueryGenerate(offset, limit int64, listType string, direction string, queryFilter []*folderMetaDataQueryFilter) any {
-	res := map[string]any{
-		"query": map[string]any{
-			"filterBy": append([]*folderMetaDataQueryFilter{
-				{
-					FieldName:  "startRank",
-					FieldValue: &folderTypeValue{Type: "INT64", Value: offset},
-					Comparator: "EQUALS",
-				},
-				{
-					FieldName:  "direction",
-					FieldValue: &folderTypeValue{Type: "STRING", Value: direction},
-					Comparator: "EQUALS",
-				},
-			}, queryFilter...),
-			"recordType": listType,
-		},
-		"resultsLimit": limit,
-		"desiredKeys": []string{
-			"resJPEGFullWidth",
-			"resJPEGFullHeight",
-			"resJPEGFullFileType",
-			"resJPEGFullFingerprint",
-			"resJPEGFullRes",
-			"resJPEGLargeWidth",
-			"resJPEGLargeHeight",
-			"resJPEGLargeFileType",
-			"resJPEGLargeFingerprint",
-			"resJPEGLargeRes",
-			"resJPEGMedWidth",
-			"resJPEGMedHeight",
-			"resJPEGMedFileType",
-			"resJPEGMedFingerprint",
-			"resJPEGMedRes",
-			"resJPEGThumbWidth",
-			"resJPEGThumbHeight",
-			"resJPEGThumbFileType",
-			"resJPEGThumbFingerprint",
-			"resJPEGThumbRes",
-			"resVidFullWidth",
-			"resVidFullHeight",
-			"resVidFullFileType",
-			"resVidFullFingerprint",
-			"resVidFullRes",
-			"resVidMedWidth",
-			"resVidMedHeight",
-			"resVidMedFileType",
-			"resVidMedFingerprint",
-			"resVidMedRes",
-			"resVidSmallWidth",
-			"resVidSmallHeight",
-			"resVidSmallFileType",
-			"resVidSmallFingerprint",
-			"resVidSmallRes",
-			"resSidecarWidth",
-			"resSidecarHeight",
-			"resSidecarFileType",
-			"resSidecarFingerprint",
-			"resSidecarRes",
-			"itemType",
-			"dataClassType",
-			"filenameEnc",
-			"originalOrientation",
-			"resOriginalWidth",
-			"resOriginalHeight",
-			"resOriginalFileType",
-			"resOriginalFingerprint",
-			"resOriginalRes",
-			"resOriginalAltWidth",
-			"resOriginalAltHeight",
-			"resOriginalAltFileType",
-			"resOriginalAltFingerprint",
-			"resOriginalAltRes",
-			"resOriginalVidComplWidth",
-			"resOriginalVidComplHeight",
-			"resOriginalVidComplFileType",
-			"resOriginalVidComplFingerprint",
-			"resOriginalVidComplRes",
-			"isDeleted",
-			"isExpunged",
-			"dateExpunged",
-			"remappedRef",
-			"recordName",
-			"recordType",
-			"recordChangeTag",
-			"masterRef",
-			"adjustmentRenderType",
-			"assetDate",
-			"addedDate",
-			"isFavorite",
-			"isHidden",
-			"orientation",
-			"duration",
-			"assetSubtype",
-			"assetSubtypeV2",
-			"assetHDRType",
-			"burstFlags",
-			"burstFlagsExt",
-			"burstId",
-			"captionEnc",
-			"locationEnc",
-			"locationV2Enc",
-			"locationLatitude",
-			"locationLongitude",
-			"adjustmentType",
-			"timeZoneOffset",
-			"vidComplDurValue",
-			"vidComplDurScale",
-			"vidComplDispValue",
-			"vidComplDispScale",
-			"vidComplVisibilityState",
-			"customRenderedValue",
-			"containerId",
-			"itemId",
-			"position",
-			"isKeyAsset",
-		},
-		"zoneID": map[string]any{"zoneName": "PrimarySync"},
-	}
-
-	return res
+// listQuery returns the query of the photos from offset(startRank) of the album.
+func (r *PhotoAlbum) listQuery(offset, limit int64) *PhotoQuery {
+	query := r.service.NewQuery(r.ListType).
+		Filter("startRank", "EQUALS", offset).
+		Filter("direction", "EQUALS", r.Direction).
+		Limit(limit)
+	query.Filters = append(query.Filters, r.QueryFilter...)
+	return query
 }
 
-type getPhotosResp struct {
-	Records            []*photoRecord `json:"records"`
-	ContinuationMarker string         `json:"continuationMarker"`
-	SyncToken          string         `json:"syncToken"`
+var photoDesiredKeys = []string{
+	"resJPEGFullWidth",
+	"resJPEGFullHeight",
+	"resJPEGFullFileType",
+	"resJPEGFullFingerprint",
+	"resJPEGFullRes",
+	"resJPEGLargeWidth",
+	"resJPEGLargeHeight",
+	"resJPEGLargeFileType",
+	"resJPEGLargeFingerprint",
+	"resJPEGLargeRes",
+	"resJPEGMedWidth",
+	"resJPEGMedHeight",
+	"resJPEGMedFileType",
+	"resJPEGMedFingerprint",
+	"resJPEGMedRes",
+	"resJPEGThumbWidth",
+	"resJPEGThumbHeight",
+	"resJPEGThumbFileType",
+	"resJPEGThumbFingerprint",
+	"resJPEGThumbRes",
+	"resVidFullWidth",
+	"resVidFullHeight",
+	"resVidFullFileType",
+	"resVidFullFingerprint",
+	"resVidFullRes",
+	"resVidMedWidth",
+	"resVidMedHeight",
+	"resVidMedFileType",
+	"resVidMedFingerprint",
+	"resVidMedRes",
+	"resVidSmallWidth",
+	"resVidSmallHeight",
+	"resVidSmallFileType",
+	"resVidSmallFingerprint",
+	"resVidSmallRes",
+	"resSidecarWidth",
+	"resSidecarHeight",
+	"resSidecarFileType",
+	"resSidecarFingerprint",
+	"resSidecarRes",
+	"itemType",
+	"dataClassType",
+	"filenameEnc",
+	"originalOrientation",
+	"resOriginalWidth",
+	"resOriginalHeight",
+	"resOriginalFileType",
+	"resOriginalFingerprint",
+	"resOriginalRes",
+	"resOriginalAltWidth",
+	"resOriginalAltHeight",
+	"resOriginalAltFileType",
+	"resOriginalAltFingerprint",
+	"resOriginalAltRes",
+	"resOriginalVidComplWidth",
+	"resOriginalVidComplHeight",
+	"resOriginalVidComplFileType",
+	"resOriginalVidComplFingerprint",
+	"resOriginalVidComplRes",
+	"isDeleted",
+	"isExpunged",
+	"dateExpunged",
+	"remappedRef",
+	"recordName",
+	"recordType",
+	"recordChangeTag",
+	"masterRef",
+	"adjustmentRenderType",
+	"assetDate",
+	"addedDate",
+	"isFavorite",
+	"isHidden",
+	"orientation",
+	"duration",
+	"assetSubtype",
+	"assetSubtypeV2",
+	"assetHDRType",
+	"burstFlags",
+	"burstFlagsExt",
+	"burstId",
+	"captionEnc",
+	"locationEnc",
+	"locationV2Enc",
+	"locationLatitude",
+	"locationLongitude",
+	"adjustmentType",
+	"timeZoneOffset",
+	"vidComplDurValue",
+	"vidComplDurScale",
+	"vidComplDispValue",
+	"vidComplDispScale",
+	"vidComplVisibilityState",
+	"customRenderedValue",
+	"containerId",
+	"itemId",
+	"position",
+	"isKeyAsset",
 }
 
 type photoRecord struct {
@@ -303,6 +271,9 @@ type photoRecord struct {
 		IsFavorite              intValue `json:"isFavorite,omitempty"`
 		VidComplDispValue       intValue `json:"vidComplDispValue,omitempty"`
 		LocationEnc             strValue `json:"locationEnc,omitempty"`
+		IsDeleted               intValue `json:"isDeleted,omitempty"`
+		IsExpunged              intValue `json:"isExpunged,omitempty"`
+		CaptionEnc              strValue `json:"captionEnc,omitempty"`
 	} `json:"fields"`
 	PluginFields    struct{}       `json:"pluginFields"`
 	RecordChangeTag string         `json:"recordChangeTag"`
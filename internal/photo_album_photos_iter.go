@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"context"
 	"sync"
 )
 
@@ -9,8 +10,9 @@ type PhotosIterNext interface {
 	Offset() int64
 }
 
-func newPhotosIterNext(album *PhotoAlbum, offset int64) PhotosIterNext {
+func newPhotosIterNext(ctx context.Context, album *PhotoAlbum, offset int64) PhotosIterNext {
 	return &photosIterNextImpl{
+		ctx:    ctx,
 		album:  album,
 		lock:   new(sync.Mutex),
 		offset: offset,
@@ -21,6 +23,7 @@ func newPhotosIterNext(album *PhotoAlbum, offset int64) PhotosIterNext {
 }
 
 type photosIterNextImpl struct {
+	ctx    context.Context
 	album  *PhotoAlbum
 	lock   *sync.Mutex
 	offset int64
@@ -42,7 +45,7 @@ func (r *photosIterNextImpl) Next() (*PhotoAsset, error) {
 		return nil, ErrPhotosIterateEnd
 	}
 
-	assets, err := r.album.GetPhotosByOffset(r.offset, 200)
+	assets, err := r.album.GetPhotosByOffsetContext(r.ctx, r.offset, 200)
 	if err != nil {
 		return nil, err
 	}
@@ -1,17 +1,26 @@
 package internal
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 )
 
 func (r *PhotoAlbum) Size() int64 {
-	size, _ := r.GetSize()
+	return r.sizeContext(context.Background())
+}
+
+func (r *PhotoAlbum) sizeContext(ctx context.Context) int64 {
+	size, _ := r.GetSizeContext(ctx)
 	return size
 }
 
 func (r *PhotoAlbum) GetSize() (int64, error) {
+	return r.GetSizeContext(context.Background())
+}
+
+func (r *PhotoAlbum) GetSizeContext(ctx context.Context) (int64, error) {
 	r.lock.Lock()
 	defer r.lock.Unlock()
 
@@ -19,7 +28,7 @@ func (r *PhotoAlbum) GetSize() (int64, error) {
 		return *r._size, nil
 	}
 
-	size, err := r.getSize()
+	size, err := r.getSize(ctx)
 	if err != nil {
 		return 0, err
 	}
@@ -28,12 +37,13 @@ func (r *PhotoAlbum) GetSize() (int64, error) {
 	return size, nil
 }
 
-func (r *PhotoAlbum) getSize() (int64, error) {
-	text, err := r.service.icloud.request(&rawReq{
-		Method:  http.MethodPost,
-		URL:     fmt.Sprintf("%s/internal/records/query/batch", r.service.serviceEndpoint),
-		Querys:  r.service.querys,
-		Headers: r.service.icloud.getCommonHeaders(map[string]string{}),
+func (r *PhotoAlbum) getSize(ctx context.Context) (int64, error) {
+	text, err := r.service.icloud.request(ctx, &rawReq{
+		Method:     http.MethodPost,
+		URL:        fmt.Sprintf("%s/internal/records/query/batch", r.service.serviceEndpoint),
+		Idempotent: true,
+		Querys:     r.service.querys,
+		Headers:    r.service.icloud.getCommonHeaders(map[string]string{}),
 		Body: map[string]any{
 			"batch": []any{
 				map[string]any{
@@ -0,0 +1,80 @@
+package internal_test
+
+import (
+	"io/fs"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/chyroc/icloudgo/icloudtest"
+	"github.com/chyroc/icloudgo/internal"
+)
+
+func TestAlbumsSameName(t *testing.T) {
+	server := icloudtest.NewServer()
+	defer server.Close()
+	a := server.AddPhoto("a.jpg", []byte("a"), time.Now())
+	b := server.AddPhoto("b.jpg", []byte("b"), time.Now())
+	c := server.AddPhoto("c.jpg", []byte("c"), time.Now())
+	travel := server.AddFolder("Travel", "")
+	work := server.AddFolder("Work", "")
+	japan1 := server.AddAlbum("Japan", a.ID)
+	server.SetAlbumParent(japan1.ID, travel.ID)
+	japan2 := server.AddAlbum("Japan", b.ID)
+	server.SetAlbumParent(japan2.ID, work.ID)
+	trip1 := server.AddAlbum("Trip", a.ID)
+	trip2 := server.AddAlbum("Trip", c.ID)
+	photoCli := newTestPhotoService(t, server)
+
+	albums, err := photoCli.Albums()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]string{
+		"Travel/Japan":            japan1.ID,
+		"Work/Japan":              japan2.ID,
+		"Trip":                    trip1.ID,
+		"Trip (" + trip2.ID + ")": trip2.ID,
+	}
+	for key, id := range expect {
+		if album := albums[key]; album == nil || album.ID != id || album.Key != key {
+			t.Fatalf("album %s: %+v, expect id %s", key, album, id)
+		}
+	}
+
+	// the plain name works only if it is unique
+	if _, err := photoCli.GetAlbum("Japan"); err == nil {
+		t.Fatal("expect error of the ambiguous name")
+	}
+	if album, err := photoCli.GetAlbum("Work/Japan"); err != nil {
+		t.Fatal(err)
+	} else if album.ID != japan2.ID {
+		t.Fatalf("album: %s, expect %s", album.ID, japan2.ID)
+	}
+	if album, err := photoCli.GetAlbum(internal.AlbumNameAll); err != nil {
+		t.Fatal(err)
+	} else if album.IsUserAlbum() {
+		t.Fatal("All Photos is a user album")
+	}
+
+	// the albums are the dirs of the fs, the same name does not hide the others
+	entries, err := fs.ReadDir(photoCli.FS(), "Albums")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	for _, name := range []string{"Travel_Japan", "Work_Japan", "Trip", "Trip (" + trip2.ID + ")"} {
+		if i := sort.SearchStrings(names, name); i >= len(names) || names[i] != name {
+			t.Fatalf("dir %s not found in %v", name, names)
+		}
+	}
+	if files, err := fs.ReadDir(photoCli.FS(), "Albums/Work_Japan"); err != nil {
+		t.Fatal(err)
+	} else if len(files) != 1 || files[0].Name() != "b.jpg" {
+		t.Fatalf("unexpected files: %v", files)
+	}
+}
@@ -95,6 +95,11 @@ func (r *PhotoAsset) ID() string {
 	return r._masterRecord.RecordName
 }
 
+// AssetRecordName returns the record name of the CPLAsset record, it is different from the ID of the CPLMaster record.
+func (r *PhotoAsset) AssetRecordName() string {
+	return r._assetRecord.RecordName
+}
+
 func (r *PhotoAsset) Size() int {
 	return r._masterRecord.Fields.ResOriginalRes.Value.Size
 }
@@ -116,7 +121,7 @@ func (r *PhotoAsset) OutputDir(output, folderStructure string) string {
 		return output
 	}
 
-	assetDate := r.AssetDate().Format(folderStructure)
+	assetDate := r.formatStructure(r.AssetDate(), folderStructure)
 	return filepath.Join(output, assetDate)
 }
 
@@ -126,10 +131,116 @@ func (r *PhotoAsset) OldOutputDir(output, folderStructure string) string {
 		return output
 	}
 
-	assetDate := r.AddDate().Format(folderStructure)
+	assetDate := r.formatStructure(r.AddDate(), folderStructure)
 	return filepath.Join(output, assetDate)
 }
 
+// formatStructure formats the time layout in structure with t, and replaces the tokens in braces:
+//
+//	{location}: coordinate of the asset, e.g. 31.23_121.47, unknown_location if the asset has no location
+func (r *PhotoAsset) formatStructure(t time.Time, structure string) string {
+	buf := new(strings.Builder)
+	for structure != "" {
+		start := strings.Index(structure, "{")
+		end := strings.Index(structure, "}")
+		if start < 0 || end < start {
+			buf.WriteString(t.Format(structure))
+			break
+		}
+		buf.WriteString(t.Format(structure[:start]))
+		buf.WriteString(r.structureToken(structure[start+1 : end]))
+		structure = structure[end+1:]
+	}
+	return buf.String()
+}
+
+func (r *PhotoAsset) structureToken(token string) string {
+	switch token {
+	case "location":
+		location, _ := r.Location()
+		if location == nil {
+			return "unknown_location"
+		}
+		return fmt.Sprintf("%.2f_%.2f", location.Latitude, location.Longitude)
+	default:
+		return "{" + token + "}"
+	}
+}
+
+// FormatPath returns the relative path of the file in the album by the template, the tokens are:
+//
+//	{album}: the album name with its folders, e.g. Travel/Japan
+//	{media_type}: photo, video, live or screenshot
+//	{date:layout}: the asset date formatted by the go time layout, e.g. {date:2006/01}
+//	{filename}: the original filename without extension
+//	{id}: the asset id
+//	{ext}: the extension of the file, e.g. .HEIC, it is appended if the template has no {ext}
+//	{location}: coordinate of the asset, same as the folder structure
+//
+// The values are sanitized, so only {album} and {date:layout} may generate many path segments.
+func (r *PhotoAsset) FormatPath(template string, album *PhotoAlbum, livePhoto bool) string {
+	filename := r.Filename(livePhoto)
+	ext := filepath.Ext(filename)
+	if !strings.Contains(template, "{ext}") {
+		template += "{ext}"
+	}
+
+	buf := new(strings.Builder)
+	for template != "" {
+		start := strings.Index(template, "{")
+		end := strings.Index(template, "}")
+		if start < 0 || end < start {
+			buf.WriteString(template)
+			break
+		}
+		buf.WriteString(template[:start])
+
+		token := template[start+1 : end]
+		switch {
+		case token == "album":
+			albumName, folders := AlbumNameAll, []string(nil)
+			if album != nil {
+				albumName, folders = album.Name, album.Folders
+			}
+			for _, folder := range folders {
+				buf.WriteString(cleanPathSegment(folder) + "/")
+			}
+			buf.WriteString(cleanPathSegment(albumName))
+		case token == "media_type":
+			buf.WriteString(r.MediaType())
+		case strings.HasPrefix(token, "date:"):
+			layout := strings.TrimPrefix(token, "date:")
+			var segments []string
+			for _, v := range strings.Split(r.AssetDate().Format(layout), "/") {
+				segments = append(segments, cleanPathSegment(v))
+			}
+			buf.WriteString(strings.Join(segments, "/"))
+		case token == "filename":
+			buf.WriteString(cleanPathSegment(strings.TrimSuffix(filename, ext)))
+		case token == "id":
+			buf.WriteString(cleanPathSegment(r.ID()))
+		case token == "ext":
+			if ext != "" {
+				buf.WriteString(cleanPathSegment(ext))
+			}
+		default:
+			buf.WriteString(cleanPathSegment(r.structureToken(token)))
+		}
+		template = template[end+1:]
+	}
+
+	var segments []string
+	for _, v := range strings.Split(buf.String(), "/") {
+		if v == "" || v == "." {
+			continue
+		} else if v == ".." {
+			v = "_"
+		}
+		segments = append(segments, v)
+	}
+	return filepath.Join(segments...)
+}
+
 func formatSize(size int) string {
 	if size < 1024 {
 		return fmt.Sprintf("%dB", size)
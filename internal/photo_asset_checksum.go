@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// fingerprintSchemeSHA1 is the leading byte of the CloudKit file signature: 0x01 + sha1(file), the scheme is the one of
+// the icloudtest server, it is not confirmed with the fingerprints of real assets yet
+const fingerprintSchemeSHA1 = 0x01
+
+// Fingerprint returns the CloudKit fingerprint of the version, empty if unknown.
+func (r *PhotoAsset) Fingerprint(version PhotoVersion, livePhoto bool) string {
+	if versionDetail, ok := r.getVersions(livePhoto)[version]; ok {
+		return versionDetail.Fingerprint
+	}
+	return ""
+}
+
+// VerifyFile checks the size and the checksum of the local file against the version.
+//
+// If the fingerprint is missing or the scheme is unknown, only the size is checked. It returns ErrChecksumMismatch if the
+// size is wrong, and ErrChecksumUnsupported if neither the size nor the fingerprint is known. The file whose signature
+// differs from the fingerprint is unverified rather than corrupted, it returns ErrChecksumUnsupported, since the
+// signature scheme is not confirmed with real assets, and a wrong scheme must not take every file as corrupted.
+func (r *PhotoAsset) VerifyFile(version PhotoVersion, livePhoto bool, path string) error {
+	versionDetail, err := r.getVersionDetail(version, livePhoto)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := stat.Size()
+	var reader io.Reader = f
+
+	// skip the EXIF segment inserted by PatchExif
+	if start, end, found, err := patchedExifRange(f); err != nil {
+		return fmt.Errorf("verify %s failed, read file err: %w", path, err)
+	} else if found {
+		size -= end - start
+		reader = io.MultiReader(io.NewSectionReader(f, 0, start), io.NewSectionReader(f, end, stat.Size()-end))
+	}
+
+	if versionDetail.Size > 0 && size != int64(versionDetail.Size) {
+		return fmt.Errorf("verify %s failed, expect size: %d, got: %d, err: %w", path, versionDetail.Size, size, ErrChecksumMismatch)
+	}
+
+	expect, err := decodeFingerprint(versionDetail.Fingerprint)
+	if err != nil {
+		if errors.Is(err, ErrChecksumUnsupported) && versionDetail.Size > 0 {
+			// fall back to the size checked above
+			return nil
+		}
+		return err
+	}
+
+	got, err := fileSignature(reader)
+	if err != nil {
+		return fmt.Errorf("verify %s failed, read file err: %w", path, err)
+	}
+	if !bytes.Equal(got, expect) {
+		return fmt.Errorf("verify %s failed, expect fingerprint: %s, got: %s, err: %w", path, versionDetail.Fingerprint, base64.StdEncoding.EncodeToString(got), ErrChecksumUnsupported)
+	}
+	return nil
+}
+
+// fileSignature computes the CloudKit file signature of reader.
+func fileSignature(reader io.Reader) ([]byte, error) {
+	h := sha1.New()
+	if _, err := io.Copy(h, reader); err != nil {
+		return nil, err
+	}
+	return h.Sum([]byte{fingerprintSchemeSHA1}), nil
+}
+
+func decodeFingerprint(fingerprint string) ([]byte, error) {
+	if fingerprint == "" {
+		return nil, fmt.Errorf("empty fingerprint: %w", ErrChecksumUnsupported)
+	}
+
+	var bs []byte
+	var err error
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if bs, err = encoding.DecodeString(strings.TrimSpace(fingerprint)); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("decode fingerprint %s failed, err: %s: %w", fingerprint, err, ErrChecksumUnsupported)
+	}
+	if len(bs) != 1+sha1.Size || bs[0] != fingerprintSchemeSHA1 {
+		return nil, fmt.Errorf("unknown fingerprint scheme %s: %w", fingerprint, ErrChecksumUnsupported)
+	}
+	return bs, nil
+}
@@ -0,0 +1,43 @@
+package internal_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chyroc/icloudgo/icloudtest"
+	"github.com/chyroc/icloudgo/internal"
+)
+
+func TestVerifyFile(t *testing.T) {
+	server := icloudtest.NewServer()
+	defer server.Close()
+	photo := server.AddPhoto("a.jpg", []byte("hello"), time.Now())
+	asset := getTestAsset(t, newTestPhotoService(t, server), photo.ID)
+	dir := t.TempDir()
+
+	tests := []struct {
+		name   string
+		data   string
+		expect error
+	}{
+		{"same", "hello", nil},
+		// the fingerprint scheme is not confirmed, the different hash is unverified, not corrupted
+		{"same size", "world", internal.ErrChecksumUnsupported},
+		{"wrong size", "hello world", internal.ErrChecksumMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name)
+			if err := os.WriteFile(path, []byte(tt.data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			err := asset.VerifyFile(internal.PhotoVersionOriginal, false, path)
+			if tt.expect == nil && err != nil || tt.expect != nil && !errors.Is(err, tt.expect) {
+				t.Fatalf("err: %v, expect %v", err, tt.expect)
+			}
+		})
+	}
+}
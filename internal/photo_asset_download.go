@@ -1,10 +1,12 @@
 package internal
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -17,26 +19,57 @@ const (
 	PhotoVersionThumb    PhotoVersion = "thumb"
 )
 
+// DownloadTo downloads the whole asset to target, the existing target is overwritten.
 func (r *PhotoAsset) DownloadTo(version PhotoVersion, livePhoto bool, target string) error {
-	body, err := r.Download(version, livePhoto)
-	if body != nil {
-		defer body.Close()
-	}
+	return r.DownloadToContext(context.Background(), version, livePhoto, target)
+}
+
+func (r *PhotoAsset) DownloadToContext(ctx context.Context, version PhotoVersion, livePhoto bool, target string) error {
+	return r.downloadTo(ctx, version, livePhoto, target, false)
+}
+
+// ResumeDownloadTo downloads the asset to the partial file left by a failed download, e.g. a .tmp file.
+//
+// The download is resumed from the end of target with a Range request, when the server ignores the range, the file is
+// truncated and downloaded again. The target of the same size is not downloaded again, so it must not be another file,
+// verify it by VerifyFile.
+func (r *PhotoAsset) ResumeDownloadTo(version PhotoVersion, livePhoto bool, target string) error {
+	return r.ResumeDownloadToContext(context.Background(), version, livePhoto, target)
+}
+
+func (r *PhotoAsset) ResumeDownloadToContext(ctx context.Context, version PhotoVersion, livePhoto bool, target string) error {
+	return r.downloadTo(ctx, version, livePhoto, target, true)
+}
+
+func (r *PhotoAsset) downloadTo(ctx context.Context, version PhotoVersion, livePhoto bool, target string, resume bool) error {
+	versionDetail, err := r.getVersionDetail(version, livePhoto)
 	if err != nil {
 		return err
 	}
+	size := int64(versionDetail.Size)
 
-	f, err := os.OpenFile(target, os.O_RDWR|os.O_CREATE, 0o644)
-	if f != nil {
-		defer f.Close()
+	offset := int64(0)
+	if f, _ := os.Stat(target); resume && f != nil && f.Mode().IsRegular() {
+		offset = f.Size()
 	}
-	if err != nil {
-		return fmt.Errorf("open file error: %v", err)
+	if size > 0 && offset > size {
+		// stale bytes of another file, restart
+		offset = 0
 	}
 
-	_, err = io.Copy(f, body)
-	if err != nil {
-		return fmt.Errorf("copy file error: %v", err)
+	if size <= 0 || offset < size {
+		if err = r.downloadFrom(ctx, versionDetail, livePhoto, target, offset); err != nil {
+			return err
+		}
+	}
+
+	if size > 0 {
+		f, err := os.Stat(target)
+		if err != nil {
+			return fmt.Errorf("stat file error: %v", err)
+		} else if f.Size() != size {
+			return fmt.Errorf("download %s size mismatch, expect: %d, got: %d", r.Filename(livePhoto), size, f.Size())
+		}
 	}
 
 	// 1676381385791 to time.time
@@ -48,35 +81,129 @@ func (r *PhotoAsset) DownloadTo(version PhotoVersion, livePhoto bool, target str
 	return nil
 }
 
-func (r *PhotoAsset) Download(version PhotoVersion, livePhoto bool) (io.ReadCloser, error) {
-	versionDetail, ok := r.getVersions(livePhoto)[version]
-	if !ok {
-		var keys []string
-		for k := range r.getVersions(livePhoto) {
-			keys = append(keys, string(k))
+func (r *PhotoAsset) downloadFrom(ctx context.Context, versionDetail *photoVersionDetail, livePhoto bool, target string, offset int64) error {
+	resp, err := r.downloadRange(ctx, versionDetail, livePhoto, offset)
+	if err != nil {
+		return err
+	}
+	if offset > 0 && (resp.StatusCode != http.StatusPartialContent || contentRangeStart(resp.Header.Get("Content-Range")) != offset) {
+		fmt.Printf("[icloudgo] [download] %s range not satisfied(status: %d), restart\n", r.Filename(livePhoto), resp.StatusCode)
+		offset = 0
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			if resp, err = r.downloadRange(ctx, versionDetail, livePhoto, 0); err != nil {
+				return err
+			}
 		}
-		return nil, fmt.Errorf("version %s not found, valid: %s", version, strings.Join(keys, ","))
 	}
+	defer resp.Body.Close()
 
-	timeout := time.Minute * 10 // 10分钟
-	if versionDetail.Size > 0 {
-		slowSecond := time.Duration(versionDetail.Size/1024/100) * time.Second // 100 KB/s 秒
-		if slowSecond > timeout {
-			timeout = slowSecond
-		}
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if offset > 0 {
+		flag = os.O_WRONLY | os.O_APPEND
+	}
+	f, err := os.OpenFile(target, flag, 0o644)
+	if err != nil {
+		return fmt.Errorf("open file error: %v", err)
+	}
+	defer f.Close()
+
+	if _, err = io.Copy(f, resp.Body); err != nil {
+		return fmt.Errorf("copy file error: %v", err)
+	}
+	return nil
+}
+
+func (r *PhotoAsset) Download(version PhotoVersion, livePhoto bool) (io.ReadCloser, error) {
+	return r.DownloadContext(context.Background(), version, livePhoto)
+}
+
+func (r *PhotoAsset) DownloadContext(ctx context.Context, version PhotoVersion, livePhoto bool) (io.ReadCloser, error) {
+	versionDetail, err := r.getVersionDetail(version, livePhoto)
+	if err != nil {
+		return nil, err
 	}
 
-	body, err := r.service.icloud.requestStream(&rawReq{
+	resp, err := r.downloadRange(ctx, versionDetail, livePhoto, 0)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// FileSize returns the size of the version, 0 if unknown.
+func (r *PhotoAsset) FileSize(version PhotoVersion, livePhoto bool) int64 {
+	if versionDetail, ok := r.getVersions(livePhoto)[version]; ok {
+		return int64(versionDetail.Size)
+	}
+	return 0
+}
+
+// downloadRange requests the version from offset, offset 0 means the whole file.
+//
+// The status of the response is 200 or 206 when offset > 0, or 416 if the range is not satisfiable.
+func (r *PhotoAsset) downloadRange(ctx context.Context, versionDetail *photoVersionDetail, livePhoto bool, offset int64) (*http.Response, error) {
+	timeout := transferTimeout(int64(versionDetail.Size) - offset)
+
+	headers := r.service.icloud.getCommonHeaders(map[string]string{})
+	expectStatus := newSet[int](http.StatusOK)
+	if offset > 0 {
+		headers["Range"] = fmt.Sprintf("bytes=%d-", offset)
+		expectStatus = newSet[int](http.StatusOK, http.StatusPartialContent, http.StatusRequestedRangeNotSatisfiable)
+	}
+
+	resp, err := r.service.icloud.requestStreamResponse(ctx, &rawReq{
 		Method:       http.MethodGet,
 		URL:          versionDetail.URL,
-		Headers:      r.service.icloud.getCommonHeaders(map[string]string{}),
-		ExpectStatus: newSet[int](http.StatusOK),
+		Headers:      headers,
+		ExpectStatus: expectStatus,
 		Timeout:      timeout,
 	})
 	if err != nil {
-		return body, fmt.Errorf("download %s(timeout: %s) failed: %w", r.Filename(livePhoto), timeout, err)
+		return nil, fmt.Errorf("download %s(timeout: %s) failed: %w", r.Filename(livePhoto), timeout, err)
+	}
+	return resp, nil
+}
+
+// transferTimeout returns the timeout to transfer size bytes, at least 10 minutes, and the size is sent at 100 KB/s
+func transferTimeout(size int64) time.Duration {
+	timeout := time.Minute * 10 // 10分钟
+	if size > 0 {
+		slowSecond := time.Duration(size/1024/100) * time.Second // 100 KB/s 秒
+		if slowSecond > timeout {
+			timeout = slowSecond
+		}
+	}
+	return timeout
+}
+
+func (r *PhotoAsset) getVersionDetail(version PhotoVersion, livePhoto bool) (*photoVersionDetail, error) {
+	versions := r.getVersions(livePhoto)
+	versionDetail, ok := versions[version]
+	if !ok {
+		var keys []string
+		for k := range versions {
+			keys = append(keys, string(k))
+		}
+		return nil, fmt.Errorf("version %s not found, valid: %s", version, strings.Join(keys, ","))
+	}
+	return versionDetail, nil
+}
+
+// contentRangeStart parses the first byte position of "bytes 100-199/200", -1 if invalid.
+func contentRangeStart(contentRange string) int64 {
+	if !strings.HasPrefix(contentRange, "bytes ") {
+		return -1
+	}
+	v, _, ok := strings.Cut(strings.TrimPrefix(contentRange, "bytes "), "-")
+	if !ok {
+		return -1
+	}
+	start, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return -1
 	}
-	return body, nil
+	return start
 }
 
 func (r *PhotoAsset) IsLivePhoto() bool {
@@ -104,54 +231,60 @@ func (r *PhotoAsset) packVersion() (map[PhotoVersion]*photoVersionDetail, map[Ph
 
 	normal := map[PhotoVersion]*photoVersionDetail{
 		PhotoVersionOriginal: {
-			Filename: r.Filename(false),
-			Width:    fields.ResOriginalWidth.Value,
-			Height:   fields.ResOriginalHeight.Value,
-			Size:     fields.ResOriginalRes.Value.Size,
-			URL:      fields.ResOriginalRes.Value.DownloadURL,
-			Type:     fields.ResOriginalFileType.Value,
+			Filename:    r.Filename(false),
+			Width:       fields.ResOriginalWidth.Value,
+			Height:      fields.ResOriginalHeight.Value,
+			Size:        fields.ResOriginalRes.Value.Size,
+			URL:         fields.ResOriginalRes.Value.DownloadURL,
+			Type:        fields.ResOriginalFileType.Value,
+			Fingerprint: fields.ResOriginalFingerprint.Value,
 		},
 		PhotoVersionMedium: {
-			Filename: r.Filename(false),
-			Width:    fields.ResJPEGMedWidth.Value,
-			Height:   fields.ResJPEGMedHeight.Value,
-			Size:     fields.ResJPEGMedRes.Value.Size,
-			URL:      fields.ResJPEGMedRes.Value.DownloadURL,
-			Type:     fields.ResJPEGMedFileType.Value,
+			Filename:    r.Filename(false),
+			Width:       fields.ResJPEGMedWidth.Value,
+			Height:      fields.ResJPEGMedHeight.Value,
+			Size:        fields.ResJPEGMedRes.Value.Size,
+			URL:         fields.ResJPEGMedRes.Value.DownloadURL,
+			Type:        fields.ResJPEGMedFileType.Value,
+			Fingerprint: fields.ResJPEGMedFingerprint.Value,
 		},
 		PhotoVersionThumb: {
-			Filename: r.Filename(false),
-			Width:    fields.ResJPEGThumbWidth.Value,
-			Height:   fields.ResJPEGThumbHeight.Value,
-			Size:     fields.ResJPEGThumbRes.Value.Size,
-			URL:      fields.ResJPEGThumbRes.Value.DownloadURL,
-			Type:     fields.ResJPEGThumbFileType.Value,
+			Filename:    r.Filename(false),
+			Width:       fields.ResJPEGThumbWidth.Value,
+			Height:      fields.ResJPEGThumbHeight.Value,
+			Size:        fields.ResJPEGThumbRes.Value.Size,
+			URL:         fields.ResJPEGThumbRes.Value.DownloadURL,
+			Type:        fields.ResJPEGThumbFileType.Value,
+			Fingerprint: fields.ResJPEGThumbFingerprint.Value,
 		},
 	}
 	livePhotoVideo := map[PhotoVersion]*photoVersionDetail{
 		PhotoVersionOriginal: {
-			Filename: r.Filename(true),
-			Width:    fields.ResOriginalVidComplWidth.Value,
-			Height:   fields.ResOriginalVidComplHeight.Value,
-			Size:     fields.ResOriginalVidComplRes.Value.Size,
-			URL:      fields.ResOriginalVidComplRes.Value.DownloadURL,
-			Type:     fields.ResOriginalVidComplFileType.Value,
+			Filename:    r.Filename(true),
+			Width:       fields.ResOriginalVidComplWidth.Value,
+			Height:      fields.ResOriginalVidComplHeight.Value,
+			Size:        fields.ResOriginalVidComplRes.Value.Size,
+			URL:         fields.ResOriginalVidComplRes.Value.DownloadURL,
+			Type:        fields.ResOriginalVidComplFileType.Value,
+			Fingerprint: fields.ResOriginalVidComplFingerprint.Value,
 		},
 		PhotoVersionMedium: {
-			Filename: r.Filename(true),
-			Width:    fields.ResVidMedWidth.Value,
-			Height:   fields.ResVidMedHeight.Value,
-			Size:     fields.ResVidMedRes.Value.Size,
-			URL:      fields.ResVidMedRes.Value.DownloadURL,
-			Type:     fields.ResVidMedFileType.Value,
+			Filename:    r.Filename(true),
+			Width:       fields.ResVidMedWidth.Value,
+			Height:      fields.ResVidMedHeight.Value,
+			Size:        fields.ResVidMedRes.Value.Size,
+			URL:         fields.ResVidMedRes.Value.DownloadURL,
+			Type:        fields.ResVidMedFileType.Value,
+			Fingerprint: fields.ResVidMedFingerprint.Value,
 		},
 		PhotoVersionThumb: {
-			Filename: r.Filename(true),
-			Width:    fields.ResVidSmallWidth.Value,
-			Height:   fields.ResVidSmallHeight.Value,
-			Size:     fields.ResVidSmallRes.Value.Size,
-			URL:      fields.ResVidSmallRes.Value.DownloadURL,
-			Type:     fields.ResVidSmallFileType.Value,
+			Filename:    r.Filename(true),
+			Width:       fields.ResVidSmallWidth.Value,
+			Height:      fields.ResVidSmallHeight.Value,
+			Size:        fields.ResVidSmallRes.Value.Size,
+			URL:         fields.ResVidSmallRes.Value.DownloadURL,
+			Type:        fields.ResVidSmallFileType.Value,
+			Fingerprint: fields.ResVidSmallFingerprint.Value,
 		},
 	}
 
@@ -165,4 +298,6 @@ type photoVersionDetail struct {
 	Size     int    `json:"size"`
 	URL      string `json:"url"`
 	Type     string `json:"type"`
+
+	Fingerprint string `json:"fingerprint"`
 }
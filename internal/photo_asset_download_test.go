@@ -0,0 +1,100 @@
+package internal_test
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chyroc/icloudgo/icloudtest"
+	"github.com/chyroc/icloudgo/internal"
+)
+
+func getTestAsset(t *testing.T, photoCli *internal.PhotoService, id string) *internal.PhotoAsset {
+	t.Helper()
+
+	album, err := photoCli.GetAlbum(internal.AlbumNameAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res *internal.PhotoAsset
+	err = album.WalkPhotos(0, func(offset int64, assets []*internal.PhotoAsset) error {
+		for _, asset := range assets {
+			if asset.ID() == id {
+				res = asset
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if res == nil {
+		t.Fatalf("asset %s not found", id)
+	}
+	return res
+}
+
+func TestDownloadTo(t *testing.T) {
+	server := icloudtest.NewServer()
+	defer server.Close()
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	date := time.Date(2023, 5, 1, 8, 0, 0, 0, time.UTC)
+	photo := server.AddPhoto("a.jpg", data, date)
+	asset := getTestAsset(t, newTestPhotoService(t, server), photo.ID)
+
+	// the other file of the same size is overwritten
+	target := filepath.Join(t.TempDir(), "a.jpg")
+	if err := os.WriteFile(target, bytes.Repeat([]byte("x"), len(data)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	server.FailRequests(http.StatusServiceUnavailable, 1, 0)
+	if err := asset.DownloadTo(internal.PhotoVersionOriginal, false, target); err != nil {
+		t.Fatal(err)
+	}
+	if bs, _ := os.ReadFile(target); !bytes.Equal(bs, data) {
+		t.Fatal("content mismatch")
+	}
+	if stat, err := os.Stat(target); err != nil {
+		t.Fatal(err)
+	} else if !stat.ModTime().Equal(date) {
+		t.Fatalf("mod time: %s, expect %s", stat.ModTime(), date)
+	}
+	if err := asset.VerifyFile(internal.PhotoVersionOriginal, false, target); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResumeDownloadTo(t *testing.T) {
+	server := icloudtest.NewServer()
+	defer server.Close()
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	photo := server.AddLivePhoto("a.heic", data, []byte("video"), time.Now())
+	asset := getTestAsset(t, newTestPhotoService(t, server), photo.ID)
+
+	// the failed range request is retried from the same offset
+	target := filepath.Join(t.TempDir(), "a.heic.tmp")
+	if err := os.WriteFile(target, data[:4000], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	server.FailRequests(http.StatusServiceUnavailable, 1, 0)
+	if err := asset.ResumeDownloadTo(internal.PhotoVersionOriginal, false, target); err != nil {
+		t.Fatal(err)
+	}
+	if bs, _ := os.ReadFile(target); !bytes.Equal(bs, data) {
+		t.Fatal("content mismatch after resume")
+	}
+
+	// the stale file longer than the asset is downloaded again
+	video := filepath.Join(t.TempDir(), "a.mov.tmp")
+	if err := os.WriteFile(video, []byte("stale video content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := asset.ResumeDownloadTo(internal.PhotoVersionOriginal, true, video); err != nil {
+		t.Fatal(err)
+	}
+	if bs, _ := os.ReadFile(video); string(bs) != "video" {
+		t.Fatalf("video content: %q", bs)
+	}
+}
@@ -0,0 +1,304 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// exifSoftware marks the EXIF segment inserted by PatchExif, so VerifyFile can skip it.
+const exifSoftware = "icloudgo"
+
+const (
+	exifTypeByte     = 1
+	exifTypeASCII    = 2
+	exifTypeLong     = 4
+	exifTypeRational = 5
+)
+
+type exifEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	data  []byte
+}
+
+// PatchExif inserts an EXIF segment with the DateTimeOriginal and GPS of the asset into the JPEG file at path.
+//
+// Only the JPEG file without EXIF segment is patched, the file which already has EXIF, or is not a JPEG(HEIC, video, ...),
+// is left untouched and false is returned. The tags missing from an existing EXIF are not added: the inserted segment is
+// skipped by VerifyFile as a whole, while editing the original segment would break the fingerprint check.
+func (r *PhotoAsset) PatchExif(path string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return false, nil
+	}
+
+	insertAt := 2
+	hasExif := false
+	if err = walkJPEGSegments(bytes.NewReader(data), func(marker byte, start, end int64, payload []byte) bool {
+		if marker == 0xE1 && bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+			hasExif = true
+			return false
+		}
+		if marker == 0xE0 && start == 2 {
+			// keep JFIF APP0 as the first segment
+			insertAt = int(end)
+		}
+		return true
+	}); err != nil {
+		return false, err
+	} else if hasExif {
+		return false, nil
+	}
+
+	segment, err := r.exifSegment()
+	if err != nil {
+		return false, err
+	}
+
+	patched := make([]byte, 0, len(data)+len(segment))
+	patched = append(patched, data[:insertAt]...)
+	patched = append(patched, segment...)
+	patched = append(patched, data[insertAt:]...)
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".exif")
+	if err = os.WriteFile(tmp, patched, stat.Mode().Perm()); err != nil {
+		return false, err
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return false, err
+	}
+	if err = os.Chtimes(path, stat.ModTime(), stat.ModTime()); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *PhotoAsset) exifSegment() ([]byte, error) {
+	assetDate := r.LocalAssetDate()
+
+	ifd0 := []exifEntry{
+		exifASCII(0x0131, exifSoftware), // Software
+	}
+	exifIFD := []exifEntry{
+		exifASCII(0x9003, assetDate.Format("2006:01:02 15:04:05")), // DateTimeOriginal
+		exifASCII(0x9011, assetDate.Format("-07:00")),              // OffsetTimeOriginal
+	}
+
+	var gpsIFD []exifEntry
+	if location, _ := r.Location(); location != nil {
+		gpsIFD = exifGPSEntries(location)
+	}
+
+	tiff := buildTIFF(ifd0, exifIFD, gpsIFD)
+	if len(tiff)+8 > 0xFFFF {
+		return nil, fmt.Errorf("exif segment too large: %d", len(tiff))
+	}
+
+	buf := new(bytes.Buffer)
+	buf.Write([]byte{0xFF, 0xE1})
+	_ = binary.Write(buf, binary.BigEndian, uint16(2+6+len(tiff)))
+	buf.WriteString("Exif\x00\x00")
+	buf.Write(tiff)
+	return buf.Bytes(), nil
+}
+
+// buildTIFF returns the big endian TIFF structure of the EXIF segment, exifIFD and gpsIFD(optional) are linked from ifd0.
+func buildTIFF(ifd0, exifIFD, gpsIFD []exifEntry) []byte {
+	ifd0 = append(ifd0, exifEntry{tag: 0x8769, typ: exifTypeLong, count: 1, data: make([]byte, 4)}) // ExifIFDPointer
+	if len(gpsIFD) > 0 {
+		ifd0 = append(ifd0, exifEntry{tag: 0x8825, typ: exifTypeLong, count: 1, data: make([]byte, 4)}) // GPSInfoIFDPointer
+	}
+	sortExifEntries(ifd0)
+	sortExifEntries(exifIFD)
+	sortExifEntries(gpsIFD)
+
+	ifd0Offset := uint32(8)
+	exifOffset := ifd0Offset + exifIFDSize(ifd0)
+	gpsOffset := exifOffset + exifIFDSize(exifIFD)
+	for i := range ifd0 {
+		switch ifd0[i].tag {
+		case 0x8769:
+			binary.BigEndian.PutUint32(ifd0[i].data, exifOffset)
+		case 0x8825:
+			binary.BigEndian.PutUint32(ifd0[i].data, gpsOffset)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	buf.WriteString("MM")
+	_ = binary.Write(buf, binary.BigEndian, uint16(42))
+	_ = binary.Write(buf, binary.BigEndian, ifd0Offset)
+	writeExifIFD(buf, ifd0, ifd0Offset)
+	writeExifIFD(buf, exifIFD, exifOffset)
+	if len(gpsIFD) > 0 {
+		writeExifIFD(buf, gpsIFD, gpsOffset)
+	}
+	return buf.Bytes()
+}
+
+func exifGPSEntries(location *PhotoLocation) []exifEntry {
+	latRef, lonRef := "N", "E"
+	if location.Latitude < 0 {
+		latRef = "S"
+	}
+	if location.Longitude < 0 {
+		lonRef = "W"
+	}
+	altRef := byte(0)
+	if location.Altitude < 0 {
+		altRef = 1
+	}
+
+	return []exifEntry{
+		{tag: 0x0000, typ: exifTypeByte, count: 4, data: []byte{2, 2, 0, 0}}, // GPSVersionID
+		exifASCII(0x0001, latRef),
+		exifRationals(0x0002, exifDegrees(location.Latitude)...),
+		exifASCII(0x0003, lonRef),
+		exifRationals(0x0004, exifDegrees(location.Longitude)...),
+		{tag: 0x0005, typ: exifTypeByte, count: 1, data: []byte{altRef}}, // GPSAltitudeRef
+		exifRationals(0x0006, [2]uint32{uint32(math.Round(math.Abs(location.Altitude) * 100)), 100}),
+	}
+}
+
+// exifDegrees converts the coordinate to degrees, minutes and seconds rationals
+func exifDegrees(v float64) [][2]uint32 {
+	v = math.Abs(v)
+	degrees := math.Floor(v)
+	minutes := math.Floor((v - degrees) * 60)
+	seconds := (v - degrees - minutes/60) * 3600
+	return [][2]uint32{{uint32(degrees), 1}, {uint32(minutes), 1}, {uint32(math.Round(seconds * 10000)), 10000}}
+}
+
+func exifRationals(tag uint16, values ...[2]uint32) exifEntry {
+	data := make([]byte, 8*len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint32(data[i*8:], v[0])
+		binary.BigEndian.PutUint32(data[i*8+4:], v[1])
+	}
+	return exifEntry{tag: tag, typ: exifTypeRational, count: uint32(len(values)), data: data}
+}
+
+func exifIFDSize(entries []exifEntry) uint32 {
+	size := uint32(2 + 12*len(entries) + 4)
+	for _, entry := range entries {
+		if len(entry.data) > 4 {
+			size += uint32(len(entry.data)+1) &^ 1
+		}
+	}
+	return size
+}
+
+func writeExifIFD(buf *bytes.Buffer, entries []exifEntry, offset uint32) {
+	dataOffset := offset + uint32(2+12*len(entries)+4)
+	var data []byte
+
+	_ = binary.Write(buf, binary.BigEndian, uint16(len(entries)))
+	for _, entry := range entries {
+		_ = binary.Write(buf, binary.BigEndian, entry.tag)
+		_ = binary.Write(buf, binary.BigEndian, entry.typ)
+		_ = binary.Write(buf, binary.BigEndian, entry.count)
+		if len(entry.data) <= 4 {
+			value := make([]byte, 4)
+			copy(value, entry.data)
+			buf.Write(value)
+			continue
+		}
+		_ = binary.Write(buf, binary.BigEndian, dataOffset+uint32(len(data)))
+		data = append(data, entry.data...)
+		if len(data)%2 == 1 {
+			data = append(data, 0)
+		}
+	}
+	_ = binary.Write(buf, binary.BigEndian, uint32(0)) // next ifd
+	buf.Write(data)
+}
+
+func sortExifEntries(entries []exifEntry) {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].tag < entries[j].tag })
+}
+
+func exifASCII(tag uint16, value string) exifEntry {
+	return exifEntry{tag: tag, typ: exifTypeASCII, count: uint32(len(value) + 1), data: append([]byte(value), 0)}
+}
+
+// walkJPEGSegments calls f with the marker, the byte range and the payload of the segments before the image data,
+// the payload is only read for APP1 segment. Walking stops when f returns false.
+func walkJPEGSegments(reader io.ReaderAt, f func(marker byte, start, end int64, payload []byte) bool) error {
+	// a truncated file is not an error here, the size check tells it
+	header := make([]byte, 4)
+	if _, err := reader.ReadAt(header[:2], 0); err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	} else if header[0] != 0xFF || header[1] != 0xD8 {
+		return nil
+	}
+
+	offset := int64(2)
+	for {
+		if _, err := reader.ReadAt(header, offset); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if header[0] != 0xFF {
+			return nil
+		}
+		marker := header[1]
+		if marker == 0xDA || marker == 0xD9 {
+			// start of scan or end of image
+			return nil
+		}
+		length := int64(binary.BigEndian.Uint16(header[2:]))
+		if length < 2 {
+			return nil
+		}
+		end := offset + 2 + length
+
+		var payload []byte
+		if marker == 0xE1 {
+			payload = make([]byte, end-offset-4)
+			if _, err := reader.ReadAt(payload, offset+4); err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				return err
+			}
+		}
+		if !f(marker, offset, end, payload) {
+			return nil
+		}
+		offset = end
+	}
+}
+
+// patchedExifRange returns the byte range of the EXIF segment inserted by PatchExif, found is false if the file is not patched.
+func patchedExifRange(reader io.ReaderAt) (start, end int64, found bool, err error) {
+	err = walkJPEGSegments(reader, func(marker byte, segStart, segEnd int64, payload []byte) bool {
+		if marker == 0xE1 && bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+			if bytes.Contains(payload, []byte(exifSoftware+"\x00")) {
+				start, end, found = segStart, segEnd, true
+			}
+			return false
+		}
+		return true
+	})
+	return start, end, found, err
+}
@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"time"
+)
+
+// PhotoLocation is the place where the asset was taken.
+type PhotoLocation struct {
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	Altitude  float64   `json:"altitude"`  // meters
+	Course    float64   `json:"course"`    // degrees relative to due north, negative if invalid
+	Speed     float64   `json:"speed"`     // meters per second, negative if invalid
+	Timestamp time.Time `json:"timestamp"` // zero if unknown
+}
+
+// Location decodes the locationEnc(base64 binary plist) of the asset, nil if the asset has no location.
+func (r *PhotoAsset) Location() (*PhotoLocation, error) {
+	locationEnc := r._assetRecord.Fields.LocationEnc.Value
+	if locationEnc == "" {
+		locationEnc = r._masterRecord.Fields.LocationEnc.Value
+	}
+	if locationEnc == "" {
+		return nil, nil
+	}
+
+	bs, err := base64.StdEncoding.DecodeString(locationEnc)
+	if err != nil {
+		return nil, fmt.Errorf("decode location of %s failed, err: %w", r.ID(), err)
+	}
+	v, err := decodeBplist(bs)
+	if err != nil {
+		return nil, fmt.Errorf("decode location of %s failed, err: %w", r.ID(), err)
+	}
+	dict, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("decode location of %s failed, err: plist is %T, not dict", r.ID(), v)
+	}
+
+	lat, latOK := plistFloat(dict["lat"])
+	lon, lonOK := plistFloat(dict["lon"])
+	if !latOK || !lonOK {
+		return nil, nil
+	}
+	location := &PhotoLocation{
+		Latitude:  lat,
+		Longitude: lon,
+		Course:    -1,
+		Speed:     -1,
+	}
+	if v, ok := plistFloat(dict["alt"]); ok {
+		location.Altitude = v
+	}
+	if v, ok := plistFloat(dict["course"]); ok {
+		location.Course = v
+	}
+	if v, ok := plistFloat(dict["speed"]); ok {
+		location.Speed = v
+	}
+	switch v := dict["timestamp"].(type) {
+	case time.Time:
+		location.Timestamp = v
+	case float64:
+		location.Timestamp = bplistEpoch.Add(time.Duration(v * float64(time.Second)))
+	}
+	return location, nil
+}
+
+// DistanceTo returns the great-circle distance in meters to the coordinate.
+func (r *PhotoLocation) DistanceTo(latitude, longitude float64) float64 {
+	const earthRadius = 6371000.0
+
+	lat1, lat2 := r.Latitude*math.Pi/180, latitude*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (longitude - r.Longitude) * math.Pi / 180
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// String returns the coordinate with 2 decimals(about 1km), e.g. "31.23,121.47"
+func (r *PhotoLocation) String() string {
+	return fmt.Sprintf("%.2f,%.2f", r.Latitude, r.Longitude)
+}
+
+func plistFloat(v any) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,159 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+func (r *PhotoAsset) IsFavorite() bool {
+	return r._assetRecord.Fields.IsFavorite.Value == 1
+}
+
+func (r *PhotoAsset) IsHidden() bool {
+	return r._assetRecord.Fields.IsHidden.Value == 1
+}
+
+// IsDeleted returns true if the asset is in the Recently Deleted album.
+func (r *PhotoAsset) IsDeleted() bool {
+	return r._assetRecord.Fields.IsDeleted.Value == 1
+}
+
+// Caption returns the title of the asset, empty if not set.
+func (r *PhotoAsset) Caption() string {
+	bs, _ := base64.StdEncoding.DecodeString(r._assetRecord.Fields.CaptionEnc.Value)
+	return string(bs)
+}
+
+// ItemType returns the uniform type identifier of the original, e.g. public.jpeg, public.heic, com.apple.quicktime-movie
+func (r *PhotoAsset) ItemType() string {
+	return r._masterRecord.Fields.ItemType.Value
+}
+
+func (r *PhotoAsset) IsVideo() bool {
+	itemType := strings.ToLower(r.ItemType())
+	return strings.Contains(itemType, "movie") || strings.Contains(itemType, "video") || strings.Contains(itemType, "mpeg")
+}
+
+// MediaType returns video, live, screenshot or photo, the screenshot is guessed by the png format.
+func (r *PhotoAsset) MediaType() string {
+	switch {
+	case r.IsVideo():
+		return "video"
+	case r.IsLivePhoto():
+		return "live"
+	case r.ItemType() == "public.png":
+		return "screenshot"
+	default:
+		return "photo"
+	}
+}
+
+// Orientation returns the EXIF orientation(1-8) of the asset, 0 if unknown.
+func (r *PhotoAsset) Orientation() int {
+	if v := r._assetRecord.Fields.Orientation.Value; v > 0 {
+		return int(v)
+	}
+	return int(r._masterRecord.Fields.OriginalOrientation.Value)
+}
+
+// LocalAssetDate returns the asset date in the time zone where the photo was taken,
+// if the time zone is unknown, the local time zone is used.
+func (r *PhotoAsset) LocalAssetDate() time.Time {
+	assetDate := r.AssetDate()
+	if r._assetRecord.Fields.TimeZoneOffset.Type == "" {
+		return assetDate
+	}
+	offset := int(r._assetRecord.Fields.TimeZoneOffset.Value)
+	return assetDate.In(time.FixedZone("", offset))
+}
+
+// XMPSidecar returns the XMP sidecar of the asset, which contains the date, rating(5 for favorite), orientation, GPS,
+// and the keywords, e.g. the names of the albums contain the asset.
+func (r *PhotoAsset) XMPSidecar(keywords ...string) []byte {
+	assetDate := r.LocalAssetDate().Format("2006-01-02T15:04:05-07:00")
+	rating := 0
+	if r.IsFavorite() {
+		rating = 5
+	}
+
+	attrs := [][2]string{
+		{"exif:DateTimeOriginal", assetDate},
+		{"photoshop:DateCreated", assetDate},
+		{"xmp:CreateDate", assetDate},
+		{"xmp:Rating", fmt.Sprintf("%d", rating)},
+	}
+	if orientation := r.Orientation(); orientation > 0 {
+		attrs = append(attrs, [2]string{"tiff:Orientation", fmt.Sprintf("%d", orientation)})
+	}
+	if location, _ := r.Location(); location != nil {
+		attrs = append(attrs, xmpGPSAttrs(location)...)
+	}
+
+	buf := new(bytes.Buffer)
+	buf.WriteString("<?xpacket begin=\"\xef\xbb\xbf\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	buf.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\" x:xmptk=\"icloudgo\">\n")
+	buf.WriteString(" <rdf:RDF xmlns:rdf=\"http://www.w3.org/1999/02/22-rdf-syntax-ns#\">\n")
+	buf.WriteString("  <rdf:Description rdf:about=\"\"\n")
+	buf.WriteString("    xmlns:dc=\"http://purl.org/dc/elements/1.1/\"\n")
+	buf.WriteString("    xmlns:exif=\"http://ns.adobe.com/exif/1.0/\"\n")
+	buf.WriteString("    xmlns:photoshop=\"http://ns.adobe.com/photoshop/1.0/\"\n")
+	buf.WriteString("    xmlns:tiff=\"http://ns.adobe.com/tiff/1.0/\"\n")
+	buf.WriteString("    xmlns:xmp=\"http://ns.adobe.com/xap/1.0/\"")
+	for _, attr := range attrs {
+		fmt.Fprintf(buf, "\n    %s=\"%s\"", attr[0], xmlEscape(attr[1]))
+	}
+	buf.WriteString(">\n")
+	if len(keywords) > 0 {
+		buf.WriteString("   <dc:subject>\n    <rdf:Bag>\n")
+		for _, keyword := range keywords {
+			fmt.Fprintf(buf, "     <rdf:li>%s</rdf:li>\n", xmlEscape(keyword))
+		}
+		buf.WriteString("    </rdf:Bag>\n   </dc:subject>\n")
+	}
+	buf.WriteString("  </rdf:Description>\n </rdf:RDF>\n</x:xmpmeta>\n<?xpacket end=\"w\"?>\n")
+	return buf.Bytes()
+}
+
+func xmpGPSAttrs(location *PhotoLocation) [][2]string {
+	altRef := 0
+	if location.Altitude < 0 {
+		altRef = 1
+	}
+	attrs := [][2]string{
+		{"exif:GPSVersionID", "2.2.0.0"},
+		{"exif:GPSLatitude", xmpCoordinate(location.Latitude, "N", "S")},
+		{"exif:GPSLongitude", xmpCoordinate(location.Longitude, "E", "W")},
+		{"exif:GPSAltitudeRef", fmt.Sprintf("%d", altRef)},
+		{"exif:GPSAltitude", fmt.Sprintf("%d/100", int64(math.Round(math.Abs(location.Altitude)*100)))},
+	}
+	if location.Course >= 0 {
+		attrs = append(attrs, [2]string{"exif:GPSTrackRef", "T"}, [2]string{"exif:GPSTrack", fmt.Sprintf("%d/100", int64(math.Round(location.Course*100)))})
+	}
+	if location.Speed >= 0 {
+		// m/s to km/h
+		attrs = append(attrs, [2]string{"exif:GPSSpeedRef", "K"}, [2]string{"exif:GPSSpeed", fmt.Sprintf("%d/100", int64(math.Round(location.Speed*3.6*100)))})
+	}
+	return attrs
+}
+
+// xmpCoordinate formats the coordinate as "DDD,MM.mmk", e.g. "31,13.800000N"
+func xmpCoordinate(v float64, positive, negative string) string {
+	ref := positive
+	if v < 0 {
+		ref = negative
+		v = -v
+	}
+	degrees := math.Floor(v)
+	return fmt.Sprintf("%d,%.6f%s", int64(degrees), (v-degrees)*60, ref)
+}
+
+func xmlEscape(s string) string {
+	buf := new(bytes.Buffer)
+	_ = xml.EscapeText(buf, []byte(s))
+	return buf.String()
+}
@@ -0,0 +1,301 @@
+package internal
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PhotoAssetChange is the change of the asset fields, the nil field is not changed.
+type PhotoAssetChange struct {
+	IsFavorite *bool
+	IsHidden   *bool
+	IsDeleted  *bool
+	// IsExpunged removes the deleted asset from the Recently Deleted album, it can not be undone
+	IsExpunged bool
+	Caption    *string
+	// AssetDate is the taken date of the asset
+	AssetDate *time.Time
+}
+
+// PhotoModifyResult is the result of one asset of ModifyAssets, Err is nil if the asset is changed.
+type PhotoModifyResult struct {
+	Asset *PhotoAsset
+	Err   error
+}
+
+const (
+	// photoModifyRetry is the times to retry the operations failed by the stale recordChangeTag
+	photoModifyRetry = 3
+	// photoModifyBatchSize is the max operations of one records/modify request
+	photoModifyBatchSize = 200
+)
+
+func (r *PhotoAsset) SetFavorite(favorite bool) error {
+	return r.SetFavoriteContext(context.Background(), favorite)
+}
+
+func (r *PhotoAsset) SetFavoriteContext(ctx context.Context, favorite bool) error {
+	return r.UpdateContext(ctx, &PhotoAssetChange{IsFavorite: &favorite})
+}
+
+func (r *PhotoAsset) SetHidden(hidden bool) error {
+	return r.SetHiddenContext(context.Background(), hidden)
+}
+
+func (r *PhotoAsset) SetHiddenContext(ctx context.Context, hidden bool) error {
+	return r.UpdateContext(ctx, &PhotoAssetChange{IsHidden: &hidden})
+}
+
+// Restore moves the deleted asset back from the Recently Deleted album.
+func (r *PhotoAsset) Restore() error {
+	return r.RestoreContext(context.Background())
+}
+
+func (r *PhotoAsset) RestoreContext(ctx context.Context) error {
+	deleted := false
+	return r.UpdateContext(ctx, &PhotoAssetChange{IsDeleted: &deleted})
+}
+
+// PermanentlyDelete deletes the asset from the Recently Deleted album, the asset is deleted first if it is not.
+func (r *PhotoAsset) PermanentlyDelete() error {
+	return r.PermanentlyDeleteContext(context.Background())
+}
+
+func (r *PhotoAsset) PermanentlyDeleteContext(ctx context.Context) error {
+	deleted := true
+	return r.UpdateContext(ctx, &PhotoAssetChange{IsDeleted: &deleted, IsExpunged: true})
+}
+
+// SetCaption sets the title of the asset, empty caption clears it.
+func (r *PhotoAsset) SetCaption(caption string) error {
+	return r.SetCaptionContext(context.Background(), caption)
+}
+
+func (r *PhotoAsset) SetCaptionContext(ctx context.Context, caption string) error {
+	return r.UpdateContext(ctx, &PhotoAssetChange{Caption: &caption})
+}
+
+func (r *PhotoAsset) Update(change *PhotoAssetChange) error {
+	return r.UpdateContext(context.Background(), change)
+}
+
+func (r *PhotoAsset) UpdateContext(ctx context.Context, change *PhotoAssetChange) error {
+	if err := r.service.UpdateAssetsContext(ctx, []*PhotoAsset{r}, change); err != nil {
+		return fmt.Errorf("update %s failed: %w", r.Filename(false), err)
+	}
+	return nil
+}
+
+// UpdateAssets applies the change to the assets, and returns an error if any asset failed, see ModifyAssets.
+func (r *PhotoService) UpdateAssets(assets []*PhotoAsset, change *PhotoAssetChange) error {
+	return r.UpdateAssetsContext(context.Background(), assets, change)
+}
+
+func (r *PhotoService) UpdateAssetsContext(ctx context.Context, assets []*PhotoAsset, change *PhotoAssetChange) error {
+	results, err := r.ModifyAssetsContext(ctx, assets, change)
+	if err != nil {
+		return err
+	}
+	return modifyResultsErr(results)
+}
+
+// DeleteAssets moves the assets to the Recently Deleted album, see ModifyAssets.
+func (r *PhotoService) DeleteAssets(assets []*PhotoAsset) ([]*PhotoModifyResult, error) {
+	return r.DeleteAssetsContext(context.Background(), assets)
+}
+
+func (r *PhotoService) DeleteAssetsContext(ctx context.Context, assets []*PhotoAsset) ([]*PhotoModifyResult, error) {
+	deleted := true
+	return r.ModifyAssetsContext(ctx, assets, &PhotoAssetChange{IsDeleted: &deleted})
+}
+
+// ModifyAssets applies the change to the assets by records/modify, the assets are sent in batches of 200.
+//
+// The results are in the order of the assets, the Err of the result is nil if the asset is changed. The operation failed
+// by the stale recordChangeTag, e.g. the asset is changed on another device, is retried with the latest record, and the
+// fields of the assets are updated after success. The error is returned if the request failed, the assets not changed
+// yet have the same error in the results.
+func (r *PhotoService) ModifyAssets(assets []*PhotoAsset, change *PhotoAssetChange) ([]*PhotoModifyResult, error) {
+	return r.ModifyAssetsContext(context.Background(), assets, change)
+}
+
+func (r *PhotoService) ModifyAssetsContext(ctx context.Context, assets []*PhotoAsset, change *PhotoAssetChange) ([]*PhotoModifyResult, error) {
+	results := make([]*PhotoModifyResult, 0, len(assets))
+	for _, asset := range assets {
+		results = append(results, &PhotoModifyResult{Asset: asset})
+	}
+	if len(change.fields()) == 0 {
+		return results, nil
+	}
+
+	for start := 0; start < len(results); start += photoModifyBatchSize {
+		end := start + photoModifyBatchSize
+		if end > len(results) {
+			end = len(results)
+		}
+		if err := r.modifyAssetsBatch(ctx, results[start:end], change); err != nil {
+			for _, result := range results[end:] {
+				result.Err = err
+			}
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// modifyAssetsBatch sends the batch, and retries the conflicts, the Err of results are set
+func (r *PhotoService) modifyAssetsBatch(ctx context.Context, results []*PhotoModifyResult, change *PhotoAssetChange) error {
+	fields := change.fields()
+	pending := results
+	for i := 0; ; i++ {
+		operations := make([]*photoRecordOperation, 0, len(pending))
+		for _, result := range pending {
+			operations = append(operations, result.Asset.updateOperation(fields))
+		}
+		records, err := r.modifyRecords(ctx, operations, false)
+		if err != nil {
+			for _, result := range pending {
+				result.Err = err
+			}
+			return err
+		}
+
+		var conflicts []*PhotoModifyResult
+		for j, result := range pending {
+			if j >= len(records) {
+				result.Err = fmt.Errorf("%s: no record response", result.Asset.ID())
+				continue
+			}
+			record := records[j]
+			if err := record.err(); err == nil {
+				change.apply(result.Asset._assetRecord)
+				result.Asset._assetRecord.RecordChangeTag = record.RecordChangeTag
+				result.Err = nil
+			} else if IsErrorCode(err, "CONFLICT") && i < photoModifyRetry {
+				conflicts = append(conflicts, result)
+			} else {
+				result.Err = err
+			}
+		}
+		if len(conflicts) == 0 {
+			return nil
+		}
+
+		conflictAssets := make([]*PhotoAsset, 0, len(conflicts))
+		for _, result := range conflicts {
+			conflictAssets = append(conflictAssets, result.Asset)
+		}
+		if err := r.refreshAssetRecords(ctx, conflictAssets); err != nil {
+			for _, result := range conflicts {
+				result.Err = err
+			}
+			return err
+		}
+		pending = conflicts
+	}
+}
+
+// modifyResultsErr returns an error contains the errors of the failed results
+func modifyResultsErr(results []*PhotoModifyResult) error {
+	var errs []string
+	for _, result := range results {
+		if result.Err != nil {
+			errs = append(errs, result.Err.Error())
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d of %d assets failed: %s", len(errs), len(results), strings.Join(errs, "; "))
+}
+
+// refreshAssetRecords fetches the latest CPLAsset records of the assets
+func (r *PhotoService) refreshAssetRecords(ctx context.Context, assets []*PhotoAsset) error {
+	names := make([]string, 0, len(assets))
+	for _, asset := range assets {
+		names = append(names, asset._assetRecord.RecordName)
+	}
+	records, err := r.lookupRecords(ctx, names)
+	if err != nil {
+		return err
+	}
+	latest := map[string]*photoRecord{}
+	for _, record := range records {
+		latest[record.RecordName] = record
+	}
+	for _, asset := range assets {
+		record, ok := latest[asset._assetRecord.RecordName]
+		if !ok || record.RecordChangeTag == "" {
+			return fmt.Errorf("refresh %s failed: record not found", asset.ID())
+		}
+		asset._assetRecord = record
+	}
+	return nil
+}
+
+func (r *PhotoAsset) updateOperation(fields map[string]any) *photoRecordOperation {
+	return &photoRecordOperation{
+		OperationType: "update",
+		Record: &photoModifyRecord{
+			RecordName:      r._assetRecord.RecordName,
+			RecordType:      r._assetRecord.RecordType,
+			RecordChangeTag: r._assetRecord.RecordChangeTag,
+			Fields:          fields,
+		},
+	}
+}
+
+func (r *PhotoAssetChange) fields() map[string]any {
+	fields := map[string]any{}
+	if r.IsFavorite != nil {
+		fields["isFavorite"] = photoFieldValue(boolToInt(*r.IsFavorite))
+	}
+	if r.IsHidden != nil {
+		fields["isHidden"] = photoFieldValue(boolToInt(*r.IsHidden))
+	}
+	if r.IsDeleted != nil {
+		fields["isDeleted"] = photoFieldValue(boolToInt(*r.IsDeleted))
+	}
+	if r.IsExpunged {
+		fields["isExpunged"] = photoFieldValue(1)
+	}
+	if r.Caption != nil {
+		fields["captionEnc"] = photoFieldValue(base64.StdEncoding.EncodeToString([]byte(*r.Caption)))
+	}
+	if r.AssetDate != nil {
+		fields["assetDate"] = photoFieldValue(r.AssetDate.UnixMilli())
+	}
+	return fields
+}
+
+// apply updates the record as the server does, so the asset is up to date without another lookup
+func (r *PhotoAssetChange) apply(record *photoRecord) {
+	if r.IsFavorite != nil {
+		record.Fields.IsFavorite.Value = boolToInt(*r.IsFavorite)
+	}
+	if r.IsHidden != nil {
+		record.Fields.IsHidden.Value = boolToInt(*r.IsHidden)
+	}
+	if r.IsDeleted != nil {
+		record.Fields.IsDeleted.Value = boolToInt(*r.IsDeleted)
+	}
+	if r.IsExpunged {
+		record.Fields.IsExpunged.Value = 1
+	}
+	if r.Caption != nil {
+		record.Fields.CaptionEnc.Value = base64.StdEncoding.EncodeToString([]byte(*r.Caption))
+	}
+	if r.AssetDate != nil {
+		record.Fields.AssetDate.Value = r.AssetDate.UnixMilli()
+	}
+}
+
+func boolToInt(v bool) int64 {
+	if v {
+		return 1
+	}
+	return 0
+}
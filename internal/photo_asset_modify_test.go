@@ -0,0 +1,51 @@
+package internal_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chyroc/icloudgo/icloudtest"
+)
+
+func TestAssetModify(t *testing.T) {
+	server := icloudtest.NewServer()
+	defer server.Close()
+	a := server.AddPhoto("a.jpg", []byte("a"), time.Now())
+	photoCli := newTestPhotoService(t, server)
+	asset := getTestAsset(t, photoCli, a.ID)
+
+	// the asset is changed after it is fetched, the stale change tag is retried with the latest record
+	server.SetPhotoLocation(a.ID, &icloudtest.Location{Latitude: 35.6, Longitude: 139.7})
+	if err := asset.SetFavorite(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := asset.SetCaption("tokyo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := asset.SetHidden(true); err != nil {
+		t.Fatal(err)
+	}
+	if photo := server.Photo(a.ID); !photo.IsFavorite || !photo.IsHidden || photo.Caption != "tokyo" {
+		t.Fatalf("unexpected photo: %+v", photo)
+	}
+	if !asset.IsFavorite() || !asset.IsHidden() || asset.Caption() != "tokyo" {
+		t.Fatal("the fields of the asset are not updated")
+	}
+
+	if err := asset.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if err := asset.Restore(); err != nil {
+		t.Fatal(err)
+	}
+	if photo := server.Photo(a.ID); photo.IsDeleted {
+		t.Fatal("photo is not restored")
+	}
+
+	if err := asset.PermanentlyDelete(); err != nil {
+		t.Fatal(err)
+	}
+	if server.Photo(a.ID) != nil {
+		t.Fatal("photo is not expunged")
+	}
+}
@@ -1,35 +1,287 @@
 package internal
 
 import (
+	"context"
+	"crypto/sha1"
 	"encoding/json"
 	"fmt"
+	"hash"
 	"io"
 	"net/http"
+	"time"
 )
 
-func (r *PhotoService) Upload(filename string, file io.Reader) (bool, error) {
+// PhotoUploadOption is the option of Upload, nil uploads the file to the library as it is.
+type PhotoUploadOption struct {
+	// Album is the user album the uploaded asset is added to
+	Album *PhotoAlbum
+	// AssetDate overrides the taken date read from the file by icloud
+	AssetDate time.Time
+	Favorite  bool
+	// Size is the size of the file, it is read from the io.Seeker if not set, the file is sent chunked if it is unknown
+	Size int64
+	// Progress is called with the uploaded bytes during the upload, it starts from 0 again when the upload is retried
+	Progress func(uploaded, total int64)
+	// FindDuplicate finds the existing asset of the duplicate file by its fingerprint, and applies the options to it, the
+	// first lookup walks All Photos and Hidden once, the later uploads of the PhotoService reuse the result
+	FindDuplicate bool
+}
+
+// Upload uploads the file to the library, and returns the created asset.
+//
+// If the same file is already in the library, isDuplicate is true, and the asset is nil, the options are not applied.
+// Set FindDuplicate to get the existing asset with the options applied, the asset is still nil if it is not found, e.g.
+// it is in the recently deleted album.
+//
+// The file is streamed in one request, the timeout grows with the size like Download. If the file is an io.Seeker, e.g.
+// *os.File, the request is retried from the start of the file as RetryPolicy allows, the upload is not retried after it
+// is sent, because the server may have saved it. The reader which is not an io.Seeker fails at the first error.
+func (r *PhotoService) Upload(filename string, file io.Reader, option *PhotoUploadOption) (*PhotoAsset, bool, error) {
+	return r.UploadContext(context.Background(), filename, file, option)
+}
+
+func (r *PhotoService) UploadContext(ctx context.Context, filename string, file io.Reader, option *PhotoUploadOption) (*PhotoAsset, bool, error) {
+	if option == nil {
+		option = &PhotoUploadOption{}
+	}
+	if option.Album != nil && (option.Album.ID == "" || option.Album.IsFolder()) {
+		return nil, false, fmt.Errorf("upload %s failed: %s is not a user album", filename, option.Album.Name)
+	}
+
 	webServiceURL, err := r.icloud.getWebServiceURL(serviceUploadImage)
 	if err != nil {
-		return false, err
+		return nil, false, err
+	}
+
+	size := option.Size
+	if size <= 0 {
+		if size, err = readerSize(file); err != nil {
+			return nil, false, fmt.Errorf("upload %s failed: %w", filename, err)
+		}
+	}
+	// the fingerprint finds the existing asset if the file is a duplicate, the io.Seeker is read again then, the other
+	// reader is hashed during the upload
+	var fingerprint hash.Hash
+	var start int64
+	if seeker, ok := file.(io.Seeker); ok && option.FindDuplicate {
+		if start, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+			return nil, false, fmt.Errorf("upload %s failed: %w", filename, err)
+		}
+	} else if option.FindDuplicate {
+		fingerprint = sha1.New()
+		file = io.TeeReader(file, fingerprint)
 	}
+	if option.Progress != nil {
+		file = newProgressReader(file, size, option.Progress)
+	}
+	reader := file
 
 	resp := new(uploadPhotoResp)
-	body, err := r.icloud.request(&rawReq{
-		Method:  http.MethodPost,
-		URL:     webServiceURL + "/upload",
-		Headers: r.icloud.getCommonHeaders(map[string]string{"Content-Type": "text/plain"}),
-		Querys:  map[string]string{"filename": filename},
-		Body:    file,
+	body, err := r.icloud.request(ctx, &rawReq{
+		Method:        http.MethodPost,
+		URL:           webServiceURL + "/upload",
+		Headers:       r.icloud.getCommonHeaders(map[string]string{"Content-Type": "text/plain"}),
+		Querys:        map[string]string{"filename": filename},
+		Body:          file,
+		Timeout:       transferTimeout(size),
+		ContentLength: size,
 	})
 	if err != nil {
-		return false, fmt.Errorf("upload %s failed: %w", filename, err)
+		return nil, false, fmt.Errorf("upload %s failed: %w", filename, err)
 	}
 	if err := json.Unmarshal([]byte(body), resp); err != nil {
-		return false, fmt.Errorf("upload %s unmarshal failed: %w", filename, err)
+		return nil, false, fmt.Errorf("upload %s unmarshal failed: %w", filename, err)
+	}
+	isDuplicate := resp.IsDuplicate
+
+	var asset *PhotoAsset
+	if isDuplicate && !option.FindDuplicate {
+		return nil, true, nil
+	} else if isDuplicate {
+		var signature []byte
+		if fingerprint != nil {
+			signature = fingerprint.Sum([]byte{fingerprintSchemeSHA1})
+		} else if signature, err = seekerSignature(reader, start); err != nil {
+			return nil, true, fmt.Errorf("upload %s is duplicate, read file err: %w", filename, err)
+		}
+		if asset, err = r.findAssetBySignature(ctx, signature); err != nil {
+			return nil, true, fmt.Errorf("upload %s is duplicate, find the existing asset err: %w", filename, err)
+		} else if asset == nil {
+			return nil, true, nil
+		}
+	} else if asset, err = r.uploadedAsset(ctx, resp); err != nil {
+		return nil, false, fmt.Errorf("upload %s failed: %w", filename, err)
+	} else {
+		r.addFingerprint(asset)
+	}
+
+	change := &PhotoAssetChange{}
+	if !option.AssetDate.IsZero() {
+		change.AssetDate = &option.AssetDate
+	}
+	if option.Favorite {
+		change.IsFavorite = &option.Favorite
+	}
+	if err := r.UpdateAssetsContext(ctx, []*PhotoAsset{asset}, change); err != nil {
+		return asset, isDuplicate, fmt.Errorf("upload %s succeeded, but update failed: %w", filename, err)
+	}
+	if option.Album != nil {
+		if err := r.AddAssetsContext(ctx, option.Album, asset); err != nil {
+			return asset, isDuplicate, fmt.Errorf("upload %s succeeded, but %w", filename, err)
+		}
+	}
+	return asset, isDuplicate, nil
+}
+
+// seekerSignature reads the io.Seeker from start again, and returns its CloudKit file signature
+func seekerSignature(reader io.Reader, start int64) ([]byte, error) {
+	seeker, ok := reader.(io.Seeker)
+	if !ok {
+		return nil, fmt.Errorf("reader is not an io.Seeker")
+	}
+	if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return fileSignature(reader)
+}
+
+// findAssetBySignature returns the asset whose original file has the signature, nil if it is not found, the assets of
+// All Photos and Hidden are indexed at the first call
+func (r *PhotoService) findAssetBySignature(ctx context.Context, signature []byte) (*PhotoAsset, error) {
+	r.fingerprintsLock.Lock()
+	defer r.fingerprintsLock.Unlock()
+
+	if r.fingerprints == nil {
+		fingerprints := map[string]*PhotoAsset{}
+		for _, name := range []string{AlbumNameAll, AlbumNameHidden} {
+			album, err := r.GetAlbumContext(ctx, name)
+			if err != nil {
+				return nil, err
+			}
+			err = album.WalkPhotosContext(ctx, 0, func(offset int64, assets []*PhotoAsset) error {
+				for _, asset := range assets {
+					if signature, err := decodeFingerprint(asset.Fingerprint(PhotoVersionOriginal, false)); err == nil {
+						fingerprints[string(signature)] = asset
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		r.fingerprints = fingerprints
+	}
+	return r.fingerprints[string(signature)], nil
+}
+
+// addFingerprint adds the uploaded asset to the index, so the same file uploaded again is found without walking
+func (r *PhotoService) addFingerprint(asset *PhotoAsset) {
+	r.fingerprintsLock.Lock()
+	defer r.fingerprintsLock.Unlock()
+
+	if r.fingerprints == nil {
+		return
+	}
+	if signature, err := decodeFingerprint(asset.Fingerprint(PhotoVersionOriginal, false)); err == nil {
+		r.fingerprints[string(signature)] = asset
+	}
+}
+
+// uploadedAsset fetches the CPLMaster and CPLAsset records created by the upload
+func (r *PhotoService) uploadedAsset(ctx context.Context, resp *uploadPhotoResp) (*PhotoAsset, error) {
+	var assetName string
+	for _, record := range resp.Records {
+		if record.RecordType == "CPLAsset" {
+			assetName = record.RecordName
+			break
+		}
+	}
+	if assetName == "" {
+		return nil, fmt.Errorf("no asset record in the response")
+	}
+
+	assets, err := r.lookupRecords(ctx, []string{assetName})
+	if err != nil {
+		return nil, err
+	} else if len(assets) == 0 || assets[0].RecordChangeTag == "" {
+		return nil, fmt.Errorf("asset %s not found", assetName)
+	}
+	masterName := assets[0].Fields.MasterRef.Value.RecordName
+	masters, err := r.lookupRecords(ctx, []string{masterName})
+	if err != nil {
+		return nil, err
+	} else if len(masters) == 0 || masters[0].RecordChangeTag == "" {
+		return nil, fmt.Errorf("master %s not found", masterName)
+	}
+	return r.newPhotoAsset(masters[0], assets[0]), nil
+}
+
+// readerSize returns the remaining size of the io.Seeker, 0 if the reader is not an io.Seeker
+func readerSize(reader io.Reader) (int64, error) {
+	seeker, ok := reader.(io.Seeker)
+	if !ok {
+		return 0, nil
+	}
+	offset, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	end, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return end - offset, nil
+}
+
+// progressReader reports the read bytes, the progressReadSeeker resets the bytes when it is seeked for the retry
+type progressReader struct {
+	reader   io.Reader
+	read     int64
+	total    int64
+	progress func(uploaded, total int64)
+}
+
+type progressReadSeeker struct {
+	*progressReader
+	start int64
+}
+
+func newProgressReader(reader io.Reader, total int64, progress func(uploaded, total int64)) io.Reader {
+	r := &progressReader{reader: reader, total: total, progress: progress}
+	if seeker, ok := reader.(io.Seeker); ok {
+		start, err := seeker.Seek(0, io.SeekCurrent)
+		if err == nil {
+			return &progressReadSeeker{progressReader: r, start: start}
+		}
+	}
+	return r
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.read += int64(n)
+		r.progress(r.read, r.total)
+	}
+	return n, err
+}
+
+func (r *progressReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	n, err := r.reader.(io.Seeker).Seek(offset, whence)
+	if err == nil {
+		r.read = n - r.start
 	}
-	return resp.IsDuplicate, nil
+	return n, err
 }
 
 type uploadPhotoResp struct {
 	IsDuplicate bool `json:"isDuplicate"`
+	Records     []struct {
+		RecordName string `json:"recordName"`
+		RecordType string `json:"recordType"`
+	} `json:"records"`
 }
@@ -0,0 +1,108 @@
+package internal_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chyroc/icloudgo/icloudtest"
+	"github.com/chyroc/icloudgo/internal"
+)
+
+func TestUploadDuplicate(t *testing.T) {
+	server := icloudtest.NewServer()
+	defer server.Close()
+	server.AddPhoto("b.jpg", []byte("b"), time.Now())
+	a := server.AddPhoto("a.jpg", []byte("a"), time.Now())
+	trip := server.AddAlbum("Trip")
+	photoCli := newTestPhotoService(t, server)
+
+	album, err := photoCli.GetAlbum("Trip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assetDate := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// the seeker is read again, the other reader is hashed during the upload
+	readers := map[string]func() io.Reader{
+		"seeker": func() io.Reader { return bytes.NewReader([]byte("a")) },
+		"reader": func() io.Reader { return strings.NewReader("a") },
+	}
+	for name, reader := range readers {
+		t.Run(name, func(t *testing.T) {
+			asset, isDuplicate, err := photoCli.Upload("a.jpg", reader(), &internal.PhotoUploadOption{
+				Album:         album,
+				AssetDate:     assetDate,
+				Favorite:      true,
+				Size:          1,
+				FindDuplicate: true,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !isDuplicate {
+				t.Fatal("expect duplicate")
+			}
+			if asset == nil || asset.ID() != a.ID {
+				t.Fatalf("asset: %v, expect %s", asset, a.ID)
+			}
+		})
+	}
+
+	// the duplicate is not looked up by default
+	if asset, isDuplicate, err := photoCli.Upload("b.jpg", strings.NewReader("b"), nil); err != nil {
+		t.Fatal(err)
+	} else if !isDuplicate || asset != nil {
+		t.Fatalf("asset: %v, duplicate: %v, expect nil and duplicate", asset, isDuplicate)
+	}
+
+	photo := server.Photo(a.ID)
+	if !photo.IsFavorite || !photo.AssetDate.Equal(assetDate) {
+		t.Fatalf("options are not applied: %+v", photo)
+	}
+	for _, album := range server.Albums() {
+		if album.ID == trip.ID && (len(album.PhotoIDs) != 1 || album.PhotoIDs[0] != a.ID) {
+			t.Fatalf("album photos: %v", album.PhotoIDs)
+		}
+	}
+}
+
+func TestUploadProgress(t *testing.T) {
+	server := icloudtest.NewServer()
+	defer server.Close()
+	photoCli := newTestPhotoService(t, server)
+
+	// the size of the seeker is known, the other reader is sent chunked with the unknown total
+	readers := map[string]func(data []byte) (io.Reader, int64){
+		"seeker": func(data []byte) (io.Reader, int64) { return bytes.NewReader(data), int64(len(data)) },
+		"reader": func(data []byte) (io.Reader, int64) { return io.MultiReader(bytes.NewReader(data)), 0 },
+	}
+	for name, newReader := range readers {
+		t.Run(name, func(t *testing.T) {
+			data := bytes.Repeat([]byte(name), 1<<18)
+			reader, expectTotal := newReader(data)
+			var last int64
+			asset, _, err := photoCli.Upload(name+".mov", reader, &internal.PhotoUploadOption{
+				Progress: func(uploaded, total int64) {
+					if uploaded < last || total != expectTotal {
+						t.Errorf("progress: %d/%d after %d, expect total %d", uploaded, total, last, expectTotal)
+					}
+					last = uploaded
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			} else if asset == nil {
+				t.Fatal("expect the uploaded asset")
+			}
+			if last != int64(len(data)) {
+				t.Fatalf("uploaded: %d, expect %d", last, len(data))
+			}
+			if photo := server.Photo(asset.ID()); photo == nil || !bytes.Equal(photo.Data, data) {
+				t.Fatal("the uploaded data is not saved")
+			}
+		})
+	}
+}
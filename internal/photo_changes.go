@@ -0,0 +1,166 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// PhotoChanges is one page of the PrimarySync zone changes.
+//
+// Added contains the assets whose CPLMaster record is part of the changes,
+// Modified contains the assets whose CPLAsset record changed alone (favorite, hidden, date, ...),
+// Deleted contains the ids of the assets moved to the Recently Deleted album,
+// Expunged contains the record names of the expunged records, the tombstone has no record type, so the name is the id
+// of the asset if it is the CPLMaster record, or the AssetRecordName of the asset if it is the CPLAsset record.
+type PhotoChanges struct {
+	Added      []*PhotoAsset
+	Modified   []*PhotoAsset
+	Deleted    []string
+	Expunged   []string
+	SyncToken  string
+	MoreComing bool
+}
+
+// Changes returns the records changed after syncToken, when syncToken is empty, all records are returned.
+//
+// Only one page is returned, when MoreComing is true, call Changes again with the returned SyncToken.
+func (r *PhotoService) Changes(syncToken string) (*PhotoChanges, error) {
+	return r.ChangesContext(context.Background(), syncToken)
+}
+
+func (r *PhotoService) ChangesContext(ctx context.Context, syncToken string) (*PhotoChanges, error) {
+	zone := map[string]any{
+		"zoneID":      map[string]any{"zoneName": "PrimarySync"},
+		"desiredKeys": photoDesiredKeys,
+		"reverse":     false,
+	}
+	if syncToken != "" {
+		zone["syncToken"] = syncToken
+	}
+
+	text, err := r.icloud.request(ctx, &rawReq{
+		Method:     http.MethodPost,
+		URL:        fmt.Sprintf("%s/changes/zone", r.serviceEndpoint),
+		Idempotent: true,
+		Querys:     r.querys,
+		Headers:    r.icloud.getCommonHeaders(map[string]string{}),
+		Body: map[string]any{
+			"zones":        []any{zone},
+			"resultsLimit": 200,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get photo changes failed, err: %w", err)
+	}
+
+	res := new(getChangesZoneResp)
+	if err = json.Unmarshal([]byte(text), res); err != nil {
+		return nil, fmt.Errorf("get photo changes unmarshal failed, err: %w, text: %s", err, text)
+	} else if len(res.Zones) == 0 {
+		return nil, fmt.Errorf("get photo changes failed, err: no zone response")
+	}
+
+	zoneRes := res.Zones[0]
+	if zoneRes.ServerErrorCode != "" {
+		if zoneRes.ServerErrorCode == "CHANGE_TOKEN_EXPIRED" || zoneRes.ServerErrorCode == "SYNC_TOKEN_EXPIRED" {
+			return nil, ErrSyncTokenExpired
+		}
+		return nil, fmt.Errorf("get photo changes failed, err: %w", NewError(zoneRes.ServerErrorCode, zoneRes.Reason))
+	}
+
+	return r.packChanges(ctx, zoneRes)
+}
+
+// WalkChanges calls Changes until there are no more changes, and returns the final sync token.
+func (r *PhotoService) WalkChanges(syncToken string, f func(changes *PhotoChanges) error) (string, error) {
+	return r.WalkChangesContext(context.Background(), syncToken, f)
+}
+
+func (r *PhotoService) WalkChangesContext(ctx context.Context, syncToken string, f func(changes *PhotoChanges) error) (string, error) {
+	for {
+		changes, err := r.ChangesContext(ctx, syncToken)
+		if err != nil {
+			return syncToken, err
+		}
+		if err := f(changes); err != nil {
+			return syncToken, err
+		}
+		syncToken = changes.SyncToken
+
+		if !changes.MoreComing {
+			return syncToken, nil
+		}
+	}
+}
+
+func (r *PhotoService) packChanges(ctx context.Context, zone *getChangesZoneItem) (*PhotoChanges, error) {
+	changes := &PhotoChanges{
+		SyncToken:  zone.SyncToken,
+		MoreComing: zone.MoreComing,
+	}
+
+	masterRecords := map[string]*photoRecord{}
+	var assetRecords []*photoRecord
+	for _, record := range zone.Records {
+		if record.Deleted {
+			// tombstone of expunged record, there is no record type or field
+			changes.Expunged = append(changes.Expunged, record.RecordName)
+			continue
+		}
+		switch record.RecordType {
+		case "CPLMaster":
+			masterRecords[record.RecordName] = record
+		case "CPLAsset":
+			assetRecords = append(assetRecords, record)
+		}
+	}
+
+	// asset changed without master, lookup the master record
+	var lookupMasterIDs []string
+	for _, record := range assetRecords {
+		masterID := record.Fields.MasterRef.Value.RecordName
+		if _, ok := masterRecords[masterID]; !ok && record.Fields.IsDeleted.Value == 0 {
+			lookupMasterIDs = append(lookupMasterIDs, masterID)
+		}
+	}
+	lookupMasterRecords, err := r.lookupRecords(ctx, lookupMasterIDs)
+	if err != nil {
+		return nil, err
+	}
+	lookupMasters := map[string]*photoRecord{}
+	for _, record := range lookupMasterRecords {
+		if record.RecordType == "CPLMaster" {
+			lookupMasters[record.RecordName] = record
+		}
+	}
+
+	for _, record := range assetRecords {
+		masterID := record.Fields.MasterRef.Value.RecordName
+		if record.Fields.IsDeleted.Value == 1 {
+			changes.Deleted = append(changes.Deleted, masterID)
+			continue
+		}
+		if masterRecord, ok := masterRecords[masterID]; ok {
+			changes.Added = append(changes.Added, r.newPhotoAsset(masterRecord, record))
+		} else if masterRecord, ok := lookupMasters[masterID]; ok {
+			changes.Modified = append(changes.Modified, r.newPhotoAsset(masterRecord, record))
+		}
+	}
+
+	return changes, nil
+}
+
+type getChangesZoneResp struct {
+	Zones []*getChangesZoneItem `json:"zones"`
+}
+
+type getChangesZoneItem struct {
+	Records         []*photoRecord `json:"records"`
+	SyncToken       string         `json:"syncToken"`
+	MoreComing      bool           `json:"moreComing"`
+	ZoneID          zoneValue      `json:"zoneID"`
+	ServerErrorCode string         `json:"serverErrorCode"`
+	Reason          string         `json:"reason"`
+}
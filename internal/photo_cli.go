@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"context"
 	"fmt"
 	"sync"
 )
@@ -13,15 +14,24 @@ type PhotoService struct {
 
 	_albums map[string]*PhotoAlbum
 	lock    *sync.Mutex
+
+	// fingerprints is the assets by the signature of their original file, it finds the existing asset of a duplicate
+	// upload, it is built at the first lookup
+	fingerprints     map[string]*PhotoAsset
+	fingerprintsLock sync.Mutex
 }
 
 func (r *Client) PhotoCli() (*PhotoService, error) {
+	return r.PhotoCliContext(context.Background())
+}
+
+func (r *Client) PhotoCliContext(ctx context.Context) (*PhotoService, error) {
 	if r.photo == nil {
 		ckDatabaseWS, err := r.getWebServiceURL(serviceDatabase)
 		if err != nil {
 			return nil, err
 		}
-		r.photo, err = newPhotoService(r, ckDatabaseWS)
+		r.photo, err = newPhotoService(ctx, r, ckDatabaseWS)
 		if err != nil {
 			return nil, err
 		}
@@ -29,7 +39,7 @@ func (r *Client) PhotoCli() (*PhotoService, error) {
 	return r.photo, nil
 }
 
-func newPhotoService(icloud *Client, serviceRoot string) (*PhotoService, error) {
+func newPhotoService(ctx context.Context, icloud *Client, serviceRoot string) (*PhotoService, error) {
 	photoCli := &PhotoService{
 		icloud:          icloud,
 		serviceRoot:     serviceRoot,
@@ -40,7 +50,7 @@ func newPhotoService(icloud *Client, serviceRoot string) (*PhotoService, error)
 		lock:    new(sync.Mutex),
 	}
 
-	if err := photoCli.checkPhotoServiceState(); err != nil {
+	if err := photoCli.checkPhotoServiceState(ctx); err != nil {
 		return nil, err
 	}
 
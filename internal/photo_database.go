@@ -1,26 +1,17 @@
 package internal
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 )
 
-func (r *PhotoService) checkPhotoServiceState() error {
-	text, err := r.icloud.request(&rawReq{
-		Method:  http.MethodPost,
-		URL:     fmt.Sprintf("%s/records/query", r.serviceEndpoint),
-		Body:    `{"query":{"recordType":"CheckIndexingState"},"zoneID":{"zoneName":"PrimarySync"}}`,
-		Headers: r.icloud.getCommonHeaders(map[string]string{"Content-type": "text/plain"}),
-		Querys:  r.querys,
-	})
+func (r *PhotoService) checkPhotoServiceState(ctx context.Context) error {
+	res, err := r.getPhotoDatabase(ctx)
 	if err != nil {
 		return fmt.Errorf("checkPhotoServiceState failed, err: %w", err)
 	}
-	res := new(getPhotoDatabaseResp)
-	if err = json.Unmarshal([]byte(text), res); err != nil {
-		return fmt.Errorf("checkPhotoServiceState unmarshal failed, err: %w, text: %s", err, text)
-	}
 
 	if len(res.Records) > 0 {
 		if res.Records[0].Fields.State.Value != "FINISHED" {
@@ -31,6 +22,39 @@ func (r *PhotoService) checkPhotoServiceState() error {
 	return nil
 }
 
+// CurrentSyncToken returns the latest sync token of the PrimarySync zone,
+// it can be passed to Changes to get the records changed after this moment.
+func (r *PhotoService) CurrentSyncToken() (string, error) {
+	return r.CurrentSyncTokenContext(context.Background())
+}
+
+func (r *PhotoService) CurrentSyncTokenContext(ctx context.Context) (string, error) {
+	res, err := r.getPhotoDatabase(ctx)
+	if err != nil {
+		return "", fmt.Errorf("get current sync token failed, err: %w", err)
+	}
+	return res.SyncToken, nil
+}
+
+func (r *PhotoService) getPhotoDatabase(ctx context.Context) (*getPhotoDatabaseResp, error) {
+	text, err := r.icloud.request(ctx, &rawReq{
+		Method:     http.MethodPost,
+		URL:        fmt.Sprintf("%s/records/query", r.serviceEndpoint),
+		Idempotent: true,
+		Body:       `{"query":{"recordType":"CheckIndexingState"},"zoneID":{"zoneName":"PrimarySync"}}`,
+		Headers:    r.icloud.getCommonHeaders(map[string]string{"Content-type": "text/plain"}),
+		Querys:     r.querys,
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := new(getPhotoDatabaseResp)
+	if err = json.Unmarshal([]byte(text), res); err != nil {
+		return nil, fmt.Errorf("unmarshal failed, err: %w, text: %s", err, text)
+	}
+	return res, nil
+}
+
 type getPhotoDatabaseResp struct {
 	Records   []*photoDatabaseRecord `json:"records"`
 	SyncToken string                 `json:"syncToken"`
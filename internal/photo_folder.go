@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -13,28 +14,47 @@ const (
 )
 
 func (r *DriveService) Folders(driveID string) (int, []*DriveFolder, error) {
-	return r.getDriveFolders(driveID)
+	return r.FoldersContext(context.Background(), driveID)
 }
 
-func (r *DriveService) getDriveFolders(driveID string) (int, []*DriveFolder, error) {
-	text, err := r.icloud.request(&rawReq{
-		Method:  http.MethodPost,
-		URL:     r.serviceEndpoint + "/retrieveItemDetailsInFolders",
-		Headers: r.icloud.getCommonHeaders(map[string]string{"Content-type": "text/plain"}),
-		Body:    fmt.Sprintf(`[{"drivewsid":"%s","partialData":false,"includeHierarchy":true}]`, driveID),
+func (r *DriveService) FoldersContext(ctx context.Context, driveID string) (int, []*DriveFolder, error) {
+	return r.getDriveFolders(ctx, driveID)
+}
+
+func (r *DriveService) getDriveFolders(ctx context.Context, driveID string) (int, []*DriveFolder, error) {
+	folder, err := r.getDriveFolder(ctx, driveID)
+	if err != nil || folder == nil {
+		return 0, nil, err
+	}
+	return folder.NumberOfItems, folder.Items, nil
+}
+
+// getDriveFolder returns the folder with its items, the items of the sub folders are not included.
+//
+// The items are returned as the server lists them in one response, no paging of the listing is known.
+func (r *DriveService) getDriveFolder(ctx context.Context, driveID string) (*getDriveFoldersResp, error) {
+	text, err := r.icloud.request(ctx, &rawReq{
+		Method:     http.MethodPost,
+		URL:        r.serviceEndpoint + "/retrieveItemDetailsInFolders",
+		Idempotent: true,
+		Headers:    r.icloud.getCommonHeaders(map[string]string{"Content-type": "text/plain"}),
+		Body:       fmt.Sprintf(`[{"drivewsid":"%s","partialData":false,"includeHierarchy":true}]`, driveID),
 	})
 	if err != nil {
-		return 0, nil, fmt.Errorf("getDriveFolders failed, err: %w", err)
+		return nil, fmt.Errorf("getDriveFolders failed, err: %w", err)
 	}
 
 	var res []*getDriveFoldersResp
 	if err = json.Unmarshal([]byte(text), &res); err != nil {
-		return 0, nil, fmt.Errorf("getDriveFolders unmarshal failed, err: %w, text: %s", err, text)
+		return nil, fmt.Errorf("getDriveFolders unmarshal failed, err: %w, text: %s", err, text)
 	}
 	if len(res) == 0 {
-		return 0, nil, nil
+		return nil, nil
+	}
+	if res[0].Status != "" && res[0].Status != "OK" {
+		return nil, fmt.Errorf("getDriveFolders %s failed, status: %s", driveID, res[0].Status)
 	}
-	return res[0].NumberOfItems, res[0].Items, nil
+	return res[0], nil
 }
 
 type DriveFolder struct {
@@ -51,7 +71,7 @@ type DriveFolder struct {
 	ShareCount          int       `json:"shareCount,omitempty"`
 	ShareAliasCount     int       `json:"shareAliasCount,omitempty"`
 	DirectChildrenCount int       `json:"directChildrenCount,omitempty"`
-	MaxDepth            string    `json:"maxDepth,omitempty"`
+	MaxDepth            string    `json:"maxDepth,omitempty"` // depth of the sub folders allowed, e.g. ANY, it does not limit the listing
 	Icons               []struct {
 		Url  string `json:"url"`
 		Type string `json:"type"`
@@ -66,6 +86,8 @@ type DriveFolder struct {
 }
 
 type getDriveFoldersResp struct {
+	DriveFolder
 	NumberOfItems int            `json:"numberOfItems"`
 	Items         []*DriveFolder `json:"items"`
+	Status        string         `json:"status"`
 }
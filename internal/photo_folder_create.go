@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -9,17 +10,22 @@ import (
 )
 
 func (r *DriveService) CreateFolder(parentDriveID, name string) (*DriveFolder, error) {
-	return r.createDriveFolder(parentDriveID, name)
+	return r.CreateFolderContext(context.Background(), parentDriveID, name)
 }
 
-func (r *DriveService) createDriveFolder(parentDriveID, name string) (*DriveFolder, error) {
+func (r *DriveService) CreateFolderContext(ctx context.Context, parentDriveID, name string) (*DriveFolder, error) {
+	return r.createDriveFolder(ctx, parentDriveID, name)
+}
+
+func (r *DriveService) createDriveFolder(ctx context.Context, parentDriveID, name string) (*DriveFolder, error) {
 	clientID := uuid.NewV4().String()
-	text, err := r.icloud.request(&rawReq{
+	text, err := r.icloud.request(ctx, &rawReq{
 		Method:  http.MethodPost,
 		URL:     r.serviceEndpoint + "/createFolders",
 		Headers: r.icloud.getCommonHeaders(map[string]string{"Content-type": "text/plain"}),
 		Body:    fmt.Sprintf(`{"destinationDrivewsId":"%s","folders":[{"clientId":"FOLDER::%s::%s","name":"%s"}]}`, parentDriveID, clientID, clientID, name),
 	})
+	r.ClearCache()
 	if err != nil {
 		return nil, fmt.Errorf("createDriveFolder failed, err: %w", err)
 	}
@@ -1,17 +1,20 @@
 package internal
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/http"
 )
 
-func (r *PhotoService) getFolders() ([]*folderRecord, error) {
-	text, err := r.icloud.request(&rawReq{
-		Method:  http.MethodPost,
-		URL:     r.serviceEndpoint + "/records/query",
-		Headers: r.icloud.getCommonHeaders(map[string]string{"Content-type": "text/plain"}),
-		Body:    `{"query":{"recordType":"CPLAlbumByPositionLive"},"zoneID":{"zoneName":"PrimarySync"}}`,
+func (r *PhotoService) getFolders(ctx context.Context) ([]*folderRecord, error) {
+	text, err := r.icloud.request(ctx, &rawReq{
+		Method:     http.MethodPost,
+		URL:        r.serviceEndpoint + "/records/query",
+		Idempotent: true,
+		Headers:    r.icloud.getCommonHeaders(map[string]string{"Content-type": "text/plain"}),
+		Body:       `{"query":{"recordType":"CPLAlbumByPositionLive"},"zoneID":{"zoneName":"PrimarySync"}}`,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("getFolders failed, err: %w", err)
@@ -63,6 +66,7 @@ type folderRecord struct {
 		} `json:"importedByBundleIdentifierEnc,omitempty"`
 		AlbumNameEnc *folderTypeValue `json:"albumNameEnc,omitempty"`
 		IsDeleted    *folderTypeValue `json:"isDeleted,omitempty"`
+		ParentID     *folderTypeValue `json:"parentId,omitempty"`
 	} `json:"fields"`
 	PluginFields    struct{} `json:"pluginFields"`
 	RecordChangeTag string   `json:"recordChangeTag"`
@@ -84,6 +88,31 @@ type folderRecord struct {
 	} `json:"zoneID"`
 }
 
+// albumName returns the decoded name, false if the folder has no name or is deleted
+func (r *folderRecord) albumName() (string, bool) {
+	if r.Fields.AlbumNameEnc == nil || r.Fields.IsDeleted != nil && r.Fields.IsDeleted.Value != "" {
+		return "", false
+	}
+	v, ok := r.Fields.AlbumNameEnc.Value.(string)
+	if !ok {
+		return "", false
+	}
+	name, _ := base64.StdEncoding.DecodeString(v)
+	return string(name), len(name) > 0
+}
+
+// parentID returns the record name of the parent folder, empty if the parent is the root folder
+func (r *folderRecord) parentID() string {
+	if r.Fields.ParentID == nil {
+		return ""
+	}
+	v, _ := r.Fields.ParentID.Value.(string)
+	if v == rootFolderID {
+		return ""
+	}
+	return v
+}
+
 type folderTypeValue struct {
 	Value any    `json:"value"`
 	Type  string `json:"type"`
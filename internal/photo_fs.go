@@ -0,0 +1,315 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	photoFSAlbums = "Albums"
+	photoFSDates  = "Dates"
+)
+
+// PhotoFS is the read-only fs.FS of the photo library, it implements fs.ReadDirFS and fs.StatFS.
+//
+// The original versions of the assets are organized by the album and the taken date:
+//
+//	Albums/<album key>/<filename>, e.g. Albums/Travel_Japan/IMG_0001.HEIC
+//	Dates/<year>/<month>/<filename>, e.g. Dates/2024/05/IMG_0001.HEIC
+//
+// The folders of the albums are joined into the dir name of the album, the filename is suffixed with the asset id if the
+// same name is in the dir.
+// The dirs are listed once when they are opened first, create a new PhotoFS to see the changes of the library.
+type PhotoFS struct {
+	service *PhotoService
+	ctx     context.Context
+
+	lock *sync.Mutex
+	dirs map[string]*photoFSDir // path -> listed dir
+}
+
+var (
+	_ fs.ReadDirFS = (*PhotoFS)(nil)
+	_ fs.StatFS    = (*PhotoFS)(nil)
+)
+
+type photoFSDir struct {
+	entries []*fsFileInfo // sorted by the name
+	assets  map[string]*PhotoAsset
+}
+
+// FS returns the fs.FS of the photo library.
+func (r *PhotoService) FS() *PhotoFS {
+	return r.FSContext(context.Background())
+}
+
+// FSContext returns the fs.FS whose requests are made with ctx.
+func (r *PhotoService) FSContext(ctx context.Context) *PhotoFS {
+	return &PhotoFS{
+		service: r,
+		ctx:     ctx,
+		lock:    new(sync.Mutex),
+		dirs:    map[string]*photoFSDir{},
+	}
+}
+
+func (r *PhotoFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	info, asset, err := r.stat(name)
+	if err != nil {
+		return nil, fsPathError("open", name, err)
+	}
+
+	if asset != nil {
+		return &fsFile{path: name, info: info, open: func(offset int64) (io.ReadCloser, error) {
+			return asset.openRange(r.ctx, offset)
+		}}, nil
+	}
+	entries, err := r.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	return &fsDir{path: name, info: info, entries: entries}, nil
+}
+
+func (r *PhotoFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	dir, err := r.readDir(name)
+	if err != nil {
+		return nil, fsPathError("readdir", name, err)
+	}
+
+	entries := make([]fs.DirEntry, 0, len(dir.entries))
+	for _, entry := range dir.entries {
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (r *PhotoFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	info, _, err := r.stat(name)
+	if err != nil {
+		return nil, fsPathError("stat", name, err)
+	}
+	return info, nil
+}
+
+// stat returns the info of the path, and the asset if the path is a file
+func (r *PhotoFS) stat(name string) (*fsFileInfo, *PhotoAsset, error) {
+	if name == "." {
+		return &fsFileInfo{name: ".", isDir: true}, nil, nil
+	}
+	dir, err := r.readDir(path.Dir(name))
+	if err != nil {
+		return nil, nil, err
+	}
+	base := path.Base(name)
+	for _, entry := range dir.entries {
+		if entry.name == base {
+			return entry, dir.assets[base], nil
+		}
+	}
+	return nil, nil, fmt.Errorf("%s: %w", name, fs.ErrNotExist)
+}
+
+// readDir lists the dir, the dirs of the dates are listed together from all the photos
+func (r *PhotoFS) readDir(name string) (*photoFSDir, error) {
+	r.lock.Lock()
+	dir := r.dirs[name]
+	r.lock.Unlock()
+	if dir != nil {
+		return dir, nil
+	}
+
+	parts := strings.Split(name, "/")
+	switch {
+	case name == ".":
+		dir = newPhotoFSDir([]string{photoFSAlbums, photoFSDates}, nil)
+	case name == photoFSAlbums:
+		albums, err := r.albums()
+		if err != nil {
+			return nil, err
+		}
+		var names []string
+		for albumName := range albums {
+			names = append(names, albumName)
+		}
+		dir = newPhotoFSDir(names, nil)
+	case parts[0] == photoFSAlbums && len(parts) == 2:
+		albums, err := r.albums()
+		if err != nil {
+			return nil, err
+		}
+		album, ok := albums[parts[1]]
+		if !ok {
+			return nil, fmt.Errorf("%s: %w", name, fs.ErrNotExist)
+		}
+		assets, err := r.albumAssets(album)
+		if err != nil {
+			return nil, err
+		}
+		dir = newPhotoFSDir(nil, assets)
+	case parts[0] == photoFSDates && len(parts) <= 3:
+		r.lock.Lock()
+		datesRead := r.dirs[photoFSDates] != nil
+		r.lock.Unlock()
+		if !datesRead {
+			if err := r.readDateDirs(); err != nil {
+				return nil, err
+			}
+		}
+		r.lock.Lock()
+		dir = r.dirs[name]
+		r.lock.Unlock()
+		if dir == nil {
+			return nil, fmt.Errorf("%s: %w", name, fs.ErrNotExist)
+		}
+		return dir, nil
+	default:
+		return nil, fmt.Errorf("%s: %w", name, fs.ErrNotExist)
+	}
+
+	r.lock.Lock()
+	r.dirs[name] = dir
+	r.lock.Unlock()
+	return dir, nil
+}
+
+// albums returns the albums by the names in the path, the folders are excluded, the album is named by its key, e.g.
+// Travel_Japan for the album Japan in the folder Travel
+func (r *PhotoFS) albums() (map[string]*PhotoAlbum, error) {
+	albums, err := r.service.AlbumsContext(r.ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(albums))
+	for key := range albums {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	res := map[string]*PhotoAlbum{}
+	for _, key := range keys {
+		album := albums[key]
+		if album.IsFolder() {
+			continue
+		}
+		name := cleanPathSegment(key)
+		if _, ok := res[name]; ok {
+			// e.g. the album "a/b" and the album "a_b"
+			name = cleanPathSegment(key + " (" + album.ID + ")")
+		}
+		res[name] = album
+	}
+	return res, nil
+}
+
+func (r *PhotoFS) albumAssets(album *PhotoAlbum) ([]*PhotoAsset, error) {
+	var res []*PhotoAsset
+	err := album.WalkPhotosContext(r.ctx, 0, func(offset int64, assets []*PhotoAsset) error {
+		res = append(res, assets...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list album %s failed: %w", album.Name, err)
+	}
+	return res, nil
+}
+
+// readDateDirs lists all the photos, and groups them into the dirs of the years and the months
+func (r *PhotoFS) readDateDirs() error {
+	album, err := r.service.GetAlbumContext(r.ctx, AlbumNameAll)
+	if err != nil {
+		return err
+	}
+	assets, err := r.albumAssets(album)
+	if err != nil {
+		return err
+	}
+
+	months := map[string][]*PhotoAsset{}
+	years := map[string][]string{}
+	for _, asset := range assets {
+		date := asset.AssetDate()
+		year, month := date.Format("2006"), date.Format("01")
+		if _, ok := months[year+"/"+month]; !ok {
+			years[year] = append(years[year], month)
+		}
+		months[year+"/"+month] = append(months[year+"/"+month], asset)
+	}
+
+	dirs := map[string]*photoFSDir{}
+	var yearNames []string
+	for year, monthNames := range years {
+		yearNames = append(yearNames, year)
+		dirs[photoFSDates+"/"+year] = newPhotoFSDir(monthNames, nil)
+		for _, month := range monthNames {
+			dirs[photoFSDates+"/"+year+"/"+month] = newPhotoFSDir(nil, months[year+"/"+month])
+		}
+	}
+	dirs[photoFSDates] = newPhotoFSDir(yearNames, nil)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for name, dir := range dirs {
+		r.dirs[name] = dir
+	}
+	return nil
+}
+
+// newPhotoFSDir returns the dir of the sub dirs and the assets, the names of the assets are unique in the dir
+func newPhotoFSDir(dirNames []string, assets []*PhotoAsset) *photoFSDir {
+	dir := &photoFSDir{assets: map[string]*PhotoAsset{}}
+	for _, name := range dirNames {
+		dir.entries = append(dir.entries, &fsFileInfo{name: name, isDir: true})
+	}
+	used := map[string]bool{}
+	for _, name := range dirNames {
+		used[name] = true
+	}
+	for _, asset := range assets {
+		name := asset.Filename(false)
+		if used[name] {
+			ext := path.Ext(name)
+			name = strings.TrimSuffix(name, ext) + "_" + cleanFilename(asset.ID()) + ext
+		}
+		used[name] = true
+		dir.assets[name] = asset
+		dir.entries = append(dir.entries, &fsFileInfo{
+			name:    name,
+			size:    int64(asset.Size()),
+			modTime: asset.AssetDate(),
+			sys:     asset,
+		})
+	}
+	sort.Slice(dir.entries, func(i, j int) bool {
+		return dir.entries[i].name < dir.entries[j].name
+	})
+	return dir
+}
+
+// openRange returns the original version of the asset from the offset
+func (r *PhotoAsset) openRange(ctx context.Context, offset int64) (io.ReadCloser, error) {
+	versionDetail, err := r.getVersionDetail(PhotoVersionOriginal, false)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.downloadRange(ctx, versionDetail, false, offset)
+	if err != nil {
+		return nil, err
+	}
+	return rangeBody(resp, offset)
+}
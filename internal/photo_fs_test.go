@@ -0,0 +1,23 @@
+package internal_test
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/chyroc/icloudgo/icloudtest"
+)
+
+func TestPhotoFS(t *testing.T) {
+	server := icloudtest.NewServer()
+	defer server.Close()
+	date := time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)
+	a := server.AddPhoto("a.jpg", []byte("a"), date)
+	server.AddPhoto("b.jpg", []byte("b"), date)
+	server.AddAlbum("Travel", a.ID)
+	photoCli := newTestPhotoService(t, server)
+
+	if err := fstest.TestFS(photoCli.FS(), "Albums/Travel/a.jpg", "Dates/2024/05/a.jpg", "Dates/2024/05/b.jpg"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,245 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// PhotoQuery is a CloudKit records/query request of the photo database, create it by PhotoService.NewQuery.
+//
+//	res, err := photoCli.NewQuery("CPLAssetAndMasterByAssetDate").
+//		Filter("startRank", "EQUALS", 0).
+//		Filter("direction", "EQUALS", "ASCENDING").
+//		Limit(100).
+//		Do()
+type PhotoQuery struct {
+	service *PhotoService
+
+	RecordType         string
+	ZoneName           string
+	Filters            []*PhotoQueryFilter
+	Sorts              []*PhotoQuerySort
+	Keys               []string
+	ResultsLimit       int64
+	ContinuationMarker string
+}
+
+// PhotoQueryFilter is one condition of the query, comparator can be EQUALS, NOT_EQUALS, LESS_THAN, LESS_THAN_OR_EQUALS,
+// GREATER_THAN, GREATER_THAN_OR_EQUALS, IN, NOT_IN, BEGINS_WITH, ...
+type PhotoQueryFilter struct {
+	FieldName  string           `json:"fieldName"`
+	Comparator string           `json:"comparator"`
+	FieldValue *PhotoQueryValue `json:"fieldValue"`
+}
+
+// PhotoQueryValue is the typed value of the filter, type can be STRING, INT64, DOUBLE, TIMESTAMP, STRING_LIST, INT64_LIST, ...
+type PhotoQueryValue struct {
+	Value any    `json:"value"`
+	Type  string `json:"type"`
+}
+
+type PhotoQuerySort struct {
+	FieldName string `json:"fieldName"`
+	Ascending bool   `json:"ascending"`
+}
+
+// PhotoQueryResult is one page of the query.
+//
+// Records contains all the raw records, Assets contains the assets packed from the CPLMaster and CPLAsset records.
+type PhotoQueryResult struct {
+	Records            []json.RawMessage
+	Assets             []*PhotoAsset
+	ContinuationMarker string
+	SyncToken          string
+}
+
+// NewQuery creates a query of the record type in PrimarySync zone, the desired keys are the keys used by PhotoAsset.
+func (r *PhotoService) NewQuery(recordType string) *PhotoQuery {
+	return &PhotoQuery{
+		service:    r,
+		RecordType: recordType,
+		ZoneName:   "PrimarySync",
+		Keys:       photoDesiredKeys,
+	}
+}
+
+func (r *PhotoQuery) Zone(zoneName string) *PhotoQuery {
+	r.ZoneName = zoneName
+	return r
+}
+
+// Filter adds a condition, the type of value is inferred: string is STRING, int is INT64, float is DOUBLE,
+// bool is INT64(0/1), time.Time is TIMESTAMP, []string is STRING_LIST, and *PhotoQueryValue is used as it is.
+func (r *PhotoQuery) Filter(fieldName, comparator string, value any) *PhotoQuery {
+	r.Filters = append(r.Filters, &PhotoQueryFilter{
+		FieldName:  fieldName,
+		Comparator: comparator,
+		FieldValue: newPhotoQueryValue(value),
+	})
+	return r
+}
+
+func (r *PhotoQuery) Sort(fieldName string, ascending bool) *PhotoQuery {
+	r.Sorts = append(r.Sorts, &PhotoQuerySort{FieldName: fieldName, Ascending: ascending})
+	return r
+}
+
+// DesiredKeys sets the fields returned, nil means all fields.
+func (r *PhotoQuery) DesiredKeys(keys ...string) *PhotoQuery {
+	r.Keys = keys
+	return r
+}
+
+func (r *PhotoQuery) Limit(limit int64) *PhotoQuery {
+	r.ResultsLimit = limit
+	return r
+}
+
+func (r *PhotoQuery) Continuation(marker string) *PhotoQuery {
+	r.ContinuationMarker = marker
+	return r
+}
+
+// Body returns the request body of the query.
+func (r *PhotoQuery) Body() map[string]any {
+	query := map[string]any{
+		"recordType": r.RecordType,
+	}
+	if len(r.Filters) > 0 {
+		query["filterBy"] = r.Filters
+	}
+	if len(r.Sorts) > 0 {
+		query["sortBy"] = r.Sorts
+	}
+
+	body := map[string]any{
+		"query":  query,
+		"zoneID": map[string]any{"zoneName": r.ZoneName},
+	}
+	if len(r.Keys) > 0 {
+		body["desiredKeys"] = r.Keys
+	}
+	if r.ResultsLimit > 0 {
+		body["resultsLimit"] = r.ResultsLimit
+	}
+	if r.ContinuationMarker != "" {
+		body["continuationMarker"] = r.ContinuationMarker
+	}
+	return body
+}
+
+func (r *PhotoQuery) Do() (*PhotoQueryResult, error) {
+	return r.DoContext(context.Background())
+}
+
+func (r *PhotoQuery) DoContext(ctx context.Context) (*PhotoQueryResult, error) {
+	text, err := r.service.icloud.request(ctx, &rawReq{
+		Method:     http.MethodPost,
+		URL:        fmt.Sprintf("%s/records/query", r.service.serviceEndpoint),
+		Idempotent: true,
+		Querys:     r.service.querys,
+		Headers:    r.service.icloud.getCommonHeaders(map[string]string{}),
+		Body:       r.Body(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("query %s failed, err: %w", r.RecordType, err)
+	}
+
+	resp := new(photoQueryResp)
+	if err = json.Unmarshal([]byte(text), resp); err != nil {
+		return nil, fmt.Errorf("query %s unmarshal failed, err: %w", r.RecordType, err)
+	}
+
+	res := &PhotoQueryResult{
+		Records:            resp.Records,
+		ContinuationMarker: resp.ContinuationMarker,
+		SyncToken:          resp.SyncToken,
+	}
+
+	var masterRecords []*photoRecord
+	assetRecords := map[string]*photoRecord{}
+	for _, raw := range resp.Records {
+		// only the photo records are decoded, the other records, e.g. albums, have the fields of different types
+		var header struct {
+			RecordType string `json:"recordType"`
+		}
+		if err := json.Unmarshal(raw, &header); err != nil {
+			return nil, fmt.Errorf("query %s unmarshal record failed, err: %w", r.RecordType, err)
+		} else if header.RecordType != "CPLAsset" && header.RecordType != "CPLMaster" {
+			continue
+		}
+		record := new(photoRecord)
+		if err := json.Unmarshal(raw, record); err != nil {
+			return nil, fmt.Errorf("query %s unmarshal %s record failed, err: %w", r.RecordType, header.RecordType, err)
+		}
+		if record.RecordType == "CPLAsset" {
+			masterID := record.Fields.MasterRef.Value.RecordName
+			assetRecords[masterID] = record
+		} else if record.RecordType == "CPLMaster" {
+			masterRecords = append(masterRecords, record)
+		}
+	}
+	for _, masterRecord := range masterRecords {
+		res.Assets = append(res.Assets, r.service.newPhotoAsset(masterRecord, assetRecords[masterRecord.RecordName]))
+	}
+
+	return res, nil
+}
+
+// Walk calls Do until there is no continuation marker.
+func (r *PhotoQuery) Walk(f func(res *PhotoQueryResult) error) error {
+	return r.WalkContext(context.Background(), f)
+}
+
+func (r *PhotoQuery) WalkContext(ctx context.Context, f func(res *PhotoQueryResult) error) error {
+	for {
+		res, err := r.DoContext(ctx)
+		if err != nil {
+			return err
+		}
+		if err := f(res); err != nil {
+			return err
+		}
+		if res.ContinuationMarker == "" || res.ContinuationMarker == r.ContinuationMarker {
+			return nil
+		}
+		r.ContinuationMarker = res.ContinuationMarker
+	}
+}
+
+func newPhotoQueryValue(value any) *PhotoQueryValue {
+	switch v := value.(type) {
+	case *PhotoQueryValue:
+		return v
+	case PhotoQueryValue:
+		return &v
+	case string:
+		return &PhotoQueryValue{Type: "STRING", Value: v}
+	case int:
+		return &PhotoQueryValue{Type: "INT64", Value: int64(v)}
+	case int64:
+		return &PhotoQueryValue{Type: "INT64", Value: v}
+	case float64:
+		return &PhotoQueryValue{Type: "DOUBLE", Value: v}
+	case bool:
+		if v {
+			return &PhotoQueryValue{Type: "INT64", Value: int64(1)}
+		}
+		return &PhotoQueryValue{Type: "INT64", Value: int64(0)}
+	case time.Time:
+		return &PhotoQueryValue{Type: "TIMESTAMP", Value: v.UnixMilli()}
+	case []string:
+		return &PhotoQueryValue{Type: "STRING_LIST", Value: v}
+	default:
+		return &PhotoQueryValue{Value: v}
+	}
+}
+
+type photoQueryResp struct {
+	Records            []json.RawMessage `json:"records"`
+	ContinuationMarker string            `json:"continuationMarker"`
+	SyncToken          string            `json:"syncToken"`
+}
@@ -0,0 +1,41 @@
+package internal_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chyroc/icloudgo/icloudtest"
+)
+
+func TestPhotoQuery(t *testing.T) {
+	server := icloudtest.NewServer()
+	defer server.Close()
+	a := server.AddPhoto("a.jpg", []byte("a"), time.Now())
+	b := server.AddLivePhoto("b.heic", []byte("b"), []byte("video"), time.Now())
+	server.AddAlbum("Trip", a.ID)
+	photoCli := newTestPhotoService(t, server)
+
+	res, err := photoCli.NewQuery("CPLAssetAndMasterByAddedDate").
+		Filter("startRank", "EQUALS", 0).
+		Filter("direction", "EQUALS", "ASCENDING").
+		Limit(100).
+		Do()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Assets) != 2 || res.Assets[0].ID() != a.ID || res.Assets[1].ID() != b.ID {
+		t.Fatalf("unexpected assets: %v", res.Assets)
+	}
+	if !res.Assets[1].IsLivePhoto() {
+		t.Fatal("b is not packed as live photo")
+	}
+
+	// the records which are not photos are kept in Records only
+	res, err = photoCli.NewQuery("CPLAlbumByPositionLive").DesiredKeys().Do()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Records) != 2 || len(res.Assets) != 0 {
+		t.Fatalf("unexpected result, records: %d, assets: %d", len(res.Records), len(res.Assets))
+	}
+}
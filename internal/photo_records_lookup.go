@@ -0,0 +1,45 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+func (r *PhotoService) lookupRecords(ctx context.Context, recordNames []string) ([]*photoRecord, error) {
+	if len(recordNames) == 0 {
+		return nil, nil
+	}
+
+	records := make([]map[string]string, 0, len(recordNames))
+	for _, v := range recordNames {
+		records = append(records, map[string]string{"recordName": v})
+	}
+
+	text, err := r.icloud.request(ctx, &rawReq{
+		Method:     http.MethodPost,
+		URL:        fmt.Sprintf("%s/records/lookup", r.serviceEndpoint),
+		Idempotent: true,
+		Querys:     r.querys,
+		Headers:    r.icloud.getCommonHeaders(map[string]string{}),
+		Body: map[string]any{
+			"records":     records,
+			"desiredKeys": photoDesiredKeys,
+			"zoneID":      map[string]any{"zoneName": "PrimarySync"},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("lookup records failed, err: %w", err)
+	}
+
+	res := new(lookupRecordsResp)
+	if err = json.Unmarshal([]byte(text), res); err != nil {
+		return nil, fmt.Errorf("lookup records unmarshal failed, err: %w, text: %s", err, text)
+	}
+	return res.Records, nil
+}
+
+type lookupRecordsResp struct {
+	Records []*photoRecord `json:"records"`
+}
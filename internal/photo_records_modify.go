@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// photoRecordOperation is one operation of records/modify, the operation type can be
+// create, update, forceUpdate, replace, forceReplace, delete and forceDelete.
+type photoRecordOperation struct {
+	OperationType string             `json:"operationType"`
+	Record        *photoModifyRecord `json:"record"`
+}
+
+type photoModifyRecord struct {
+	RecordName      string         `json:"recordName"`
+	RecordType      string         `json:"recordType,omitempty"`
+	RecordChangeTag string         `json:"recordChangeTag,omitempty"`
+	Fields          map[string]any `json:"fields,omitempty"`
+}
+
+// photoModifyResult is the record of one operation, ServerErrorCode is not empty if the operation failed.
+type photoModifyResult struct {
+	RecordName      string `json:"recordName"`
+	RecordType      string `json:"recordType"`
+	RecordChangeTag string `json:"recordChangeTag"`
+	ServerErrorCode string `json:"serverErrorCode"`
+	Reason          string `json:"reason"`
+}
+
+// modifyRecords sends the operations in one records/modify request, the results are in the order of the operations.
+//
+// If atomic is true, the operations all succeed or all fail.
+func (r *PhotoService) modifyRecords(ctx context.Context, operations []*photoRecordOperation, atomic bool) ([]*photoModifyResult, error) {
+	text, err := r.icloud.request(ctx, &rawReq{
+		Method:  http.MethodPost,
+		URL:     fmt.Sprintf("%s/records/modify", r.serviceEndpoint),
+		Querys:  r.querys,
+		Headers: r.icloud.getCommonHeaders(map[string]string{}),
+		Body: map[string]any{
+			"operations": operations,
+			"zoneID":     map[string]any{"zoneName": "PrimarySync"},
+			"atomic":     atomic,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("modify records failed, err: %w", err)
+	}
+
+	res := new(modifyRecordsResp)
+	if err = json.Unmarshal([]byte(text), res); err != nil {
+		return nil, fmt.Errorf("modify records unmarshal failed, err: %w, text: %s", err, text)
+	}
+	return res.Records, nil
+}
+
+// modifyRecord sends one operation, and returns the error of the record
+func (r *PhotoService) modifyRecord(ctx context.Context, operation *photoRecordOperation) (*photoModifyResult, error) {
+	results, err := r.modifyRecords(ctx, []*photoRecordOperation{operation}, true)
+	if err != nil {
+		return nil, err
+	} else if len(results) == 0 {
+		return nil, fmt.Errorf("modify record %s failed, no record response", operation.Record.RecordName)
+	}
+	return results[0], results[0].err()
+}
+
+func (r *photoModifyResult) err() error {
+	if r.ServerErrorCode == "" {
+		return nil
+	}
+	return NewError(r.ServerErrorCode, fmt.Sprintf("%s: %s", r.RecordName, r.Reason))
+}
+
+// photoFieldValue returns the field of the modify record
+func photoFieldValue(value any) map[string]any {
+	return map[string]any{"value": value}
+}
+
+type modifyRecordsResp struct {
+	Records []*photoModifyResult `json:"records"`
+}
@@ -0,0 +1,41 @@
+package internal_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chyroc/icloudgo/icloudtest"
+	"github.com/chyroc/icloudgo/internal"
+)
+
+func TestDeleteAssets(t *testing.T) {
+	server := icloudtest.NewServer()
+	defer server.Close()
+	a := server.AddPhoto("a.jpg", []byte("a"), time.Now())
+	b := server.AddPhoto("b.jpg", []byte("b"), time.Now())
+	photoCli := newTestPhotoService(t, server)
+	assets := []*internal.PhotoAsset{getTestAsset(t, photoCli, a.ID), getTestAsset(t, photoCli, b.ID)}
+
+	// the failed asset does not fail the others of the batch
+	server.ExpungePhoto(b.ID)
+	results, err := photoCli.DeleteAssets(assets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Asset != assets[0] || results[1].Asset != assets[1] {
+		t.Fatalf("the results are not in the order of the assets: %+v", results)
+	}
+	if results[0].Err != nil {
+		t.Fatal(results[0].Err)
+	}
+	if results[1].Err == nil {
+		t.Fatal("expect error of the expunged asset")
+	}
+	if !server.Photo(a.ID).IsDeleted || !assets[0].IsDeleted() {
+		t.Fatal("asset is not deleted")
+	}
+
+	if err := photoCli.UpdateAssets(assets, &internal.PhotoAssetChange{Caption: new(string)}); err == nil {
+		t.Fatal("expect error of the expunged asset")
+	}
+}
@@ -1,9 +1,14 @@
 package internal
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 )
 
@@ -16,70 +21,130 @@ type rawReq struct {
 	ExpectStatus set[int]
 	Stream       bool
 	Timeout      time.Duration
+	// ContentLength is the size of the io.Reader Body, the body is sent chunked if it is 0
+	ContentLength int64
+	// Idempotent marks the POST request which only reads, e.g. records/query, it is retried like GET
+	Idempotent bool
 }
 
-func (r *Client) request(req *rawReq) (string, error) {
-	text, _, err := r.doRequest(req)
+func (r *Client) request(ctx context.Context, req *rawReq) (string, error) {
+	text, _, err := r.doRequest(ctx, req)
 	return text, err
 }
 
-func (r *Client) requestStream(req *rawReq) (io.ReadCloser, error) {
-	req.Stream = true
-	_, body, err := r.doRequest(req)
-	return body, err
+func (r *Client) requestStream(ctx context.Context, req *rawReq) (io.ReadCloser, error) {
+	resp, err := r.requestStreamResponse(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
 }
 
-func (r *Client) doRequest(req *rawReq) (string, io.ReadCloser, error) {
-	status := 0
+// requestStreamResponse returns the response with unread body, the caller must close it.
+func (r *Client) requestStreamResponse(ctx context.Context, req *rawReq) (*http.Response, error) {
+	req.Stream = true
+	_, resp, err := r.doRequest(ctx, req)
+	return resp, err
+}
 
-	res := r.httpCli.New(req.Method, req.URL).WithURLCookie("https://icloud.com.cn")
-	if len(req.Headers) > 0 {
-		res = res.WithHeaders(req.Headers)
-	}
-	if len(req.Querys) > 0 {
-		res = res.WithQuerys(req.Querys)
+func (r *Client) doRequest(ctx context.Context, req *rawReq) (string, *http.Response, error) {
+	replay, err := newBodyReplay(req.Body)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s %s failed, err: %w", req.Method, req.URL, err)
 	}
-	if req.Body != nil {
-		if len(req.Headers) > 0 && req.Headers["Content-Type"] == "text/plain" {
-			res = res.WithBody(req.Body)
-		} else {
-			res = res.WithJSON(req.Body)
+
+	reauthed := false
+	for attempt := 1; ; attempt++ {
+		authGeneration := r.getAuthGeneration()
+		if err := replay.reset(); err != nil {
+			return "", nil, fmt.Errorf("%s %s failed, err: %w", req.Method, req.URL, err)
 		}
+
+		resp, err := r.doHTTPRequest(ctx, req)
+		if err != nil {
+			if ctx.Err() == nil && replay.ok() && attempt < r.retryPolicy.MaxAttempts && (req.isIdempotent() || isConnectError(err)) {
+				delay := r.retryPolicy.backoff(attempt)
+				fmt.Printf("[icloudgo] [retry] %s %s failed, err: %s, retry %d after %s\n", req.Method, req.URL, err, attempt, delay)
+				if err := sleepContext(ctx, delay); err != nil {
+					return "", nil, fmt.Errorf("%s %s failed, err: %w", req.Method, req.URL, err)
+				}
+				continue
+			}
+			return "", nil, fmt.Errorf("%s %s failed, err: %w", req.Method, req.URL, err)
+		}
+
+		// session expired, authenticate again and retry once
+		if isSessionExpiredStatus(resp.StatusCode) && !reauthed && replay.ok() && !r.isAuthURL(req.URL) {
+			discardBody(resp)
+			fmt.Printf("[icloudgo] [retry] %s %s got status %d, re-authenticate\n", req.Method, req.URL, resp.StatusCode)
+			if err := r.reauthenticate(ctx, authGeneration); err != nil {
+				return "", nil, fmt.Errorf("%s %s failed, status %d, re-authenticate failed: %w", req.Method, req.URL, resp.StatusCode, err)
+			}
+			reauthed = true
+			continue
+		}
+
+		if isRetryStatus(resp.StatusCode) && replay.ok() && attempt < r.retryPolicy.MaxAttempts && (req.isIdempotent() || isRetryLater(resp)) {
+			delay := r.retryPolicy.backoff(attempt)
+			if retryAfter := parseRetryAfter(resp.Header.Get("Retry-After")); retryAfter > delay {
+				delay = retryAfter
+			}
+			discardBody(resp)
+			fmt.Printf("[icloudgo] [retry] %s %s got status %d, retry %d after %s\n", req.Method, req.URL, resp.StatusCode, attempt, delay)
+			if err := sleepContext(ctx, delay); err != nil {
+				return "", nil, fmt.Errorf("%s %s failed, err: %w", req.Method, req.URL, err)
+			}
+			continue
+		}
+
+		return r.handleResponse(req, resp)
 	}
-	if req.Timeout > 0 {
-		res = res.WithTimeout(req.Timeout)
+}
+
+func (r *Client) doHTTPRequest(ctx context.Context, req *rawReq) (*http.Response, error) {
+	httpReq, err := r.newHTTPRequest(ctx, req)
+	if err != nil {
+		return nil, err
 	}
 
-	resp, respErr := res.Response()
-	if resp != nil {
-		for k, callback := range contextHeader {
-			if resp.Header.Get(k) != "" {
-				callback(r.sessionData, resp.Header.Get(k))
-			}
+	httpCli := &http.Client{Jar: r.cookieJar, Timeout: req.Timeout}
+	resp, err := httpCli.Do(httpReq)
+	_ = r.cookieJar.Save()
+	if err != nil {
+		return nil, err
+	}
+
+	for k, callback := range contextHeader {
+		if resp.Header.Get(k) != "" {
+			callback(r.sessionData, resp.Header.Get(k))
 		}
 	}
+	return resp, nil
+}
 
-	status = res.MustResponseStatus()
+func (r *Client) handleResponse(req *rawReq, resp *http.Response) (string, *http.Response, error) {
+	status := resp.StatusCode
 	if status == http.StatusGone {
+		resp.Body.Close()
 		return "", nil, fmt.Errorf("%s %s failed, %w", req.Method, req.URL, ErrResourceGone)
 	}
 
 	if req.Stream {
-		if respErr != nil {
-			return "", nil, fmt.Errorf("%s %s failed, status %d, err: %s", req.Method, req.URL, status, respErr)
-		}
 		if req.ExpectStatus != nil && req.ExpectStatus.Len() > 0 && !req.ExpectStatus.Has(status) {
+			resp.Body.Close()
 			return "", nil, fmt.Errorf("%s %s failed, expect status %v, but got %d", req.Method, req.URL, req.ExpectStatus.String(), status)
 		}
-		return "", resp.Body, nil
+		return "", resp, nil
 	}
 
-	text, err := res.Text()
+	bs, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	text := string(bs)
 	if err != nil {
-		return text, nil, fmt.Errorf("%s %s failed, status %d, err: %s, response text: %s", req.Method, req.URL, status, err, text)
+		return text, nil, fmt.Errorf("%s %s failed, status %d, err: %w, response text: %s", req.Method, req.URL, status, err, text)
 	}
 
-	if err := mayErr([]byte(text)); err != nil {
+	if err := mayErr(bs); err != nil {
 		return text, nil, fmt.Errorf("%s %s failed, status %d, err: %w", req.Method, req.URL, status, err)
 	}
 
@@ -87,9 +152,75 @@ func (r *Client) doRequest(req *rawReq) (string, io.ReadCloser, error) {
 		return text, nil, fmt.Errorf("%s %s failed, expect status %v, but got %d, response text: %s", req.Method, req.URL, req.ExpectStatus.String(), status, text)
 	}
 
-	return text, nil, err
+	return text, nil, nil
 }
 
+func (r *Client) newHTTPRequest(ctx context.Context, req *rawReq) (*http.Request, error) {
+	uri, err := url.Parse(req.URL)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.Querys) > 0 {
+		query := uri.Query()
+		for k, v := range req.Querys {
+			query.Set(k, v)
+		}
+		uri.RawQuery = query.Encode()
+	}
+
+	var body io.Reader
+	isJSON := false
+	if req.Body != nil {
+		switch v := req.Body.(type) {
+		case io.Reader:
+			// the reader may be replayed when retry, so it must not be closed by the transport
+			body = io.NopCloser(v)
+		case []byte:
+			body = bytes.NewReader(v)
+		case string:
+			body = strings.NewReader(v)
+		default:
+			bs, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			body = bytes.NewReader(bs)
+		}
+		// the text/plain and multipart bodies keep their content type
+		contentType := req.Headers["Content-Type"]
+		isJSON = contentType != "text/plain" && !strings.HasPrefix(contentType, "multipart/")
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, req.Method, uri.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := req.Body.(io.Reader); ok && req.ContentLength > 0 {
+		httpReq.ContentLength = req.ContentLength
+	}
+	for k, v := range req.Headers {
+		httpReq.Header.Set(k, v)
+	}
+	if isJSON {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+
+	// the cookies of icloud.com.cn are always sent, the cookies of the request url are added by the jar
+	sent := newSet[string]()
+	for _, cookie := range r.cookieJar.Cookies(uri) {
+		sent.Add(cookie.Name)
+	}
+	for _, cookie := range r.cookieJar.Cookies(icloudCookieURL) {
+		if !sent.Has(cookie.Name) {
+			httpReq.AddCookie(cookie)
+		}
+	}
+
+	return httpReq, nil
+}
+
+var icloudCookieURL, _ = url.Parse("https://icloud.com.cn")
+
 func (r *Client) getAuthHeaders(overwrite map[string]string) map[string]string { //            "Accept": "*/*",
 	headers := map[string]string{
 		"Accept":                           "*/*",
@@ -0,0 +1,149 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how the failed requests are retried.
+//
+// Network errors and the 429, 502, 503, 504 statuses are retried with exponential backoff and jitter,
+// the Retry-After header is honored when it is longer than the backoff.
+//
+// The POST request which changes data, e.g. upload and records/modify, may be committed by the server before the error,
+// so it is only retried when the connection is not established, or the server asks to retry by 429/503 with Retry-After.
+type RetryPolicy struct {
+	MaxAttempts int           // total attempts include the first one, 1 means no retry
+	BaseDelay   time.Duration // backoff before the second attempt, doubled for each attempt
+	MaxDelay    time.Duration // max backoff
+}
+
+var DefaultRetryPolicy = &RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   time.Second,
+	MaxDelay:    time.Second * 30,
+}
+
+func (r *RetryPolicy) backoff(attempt int) time.Duration {
+	delay := r.BaseDelay
+	for i := 1; i < attempt && delay < r.MaxDelay; i++ {
+		delay *= 2
+	}
+	if r.MaxDelay > 0 && delay > r.MaxDelay {
+		delay = r.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	// jitter: [delay/2, delay)
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+func isRetryStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// isIdempotent returns true if the request can be sent again after the server may have received it
+func (r *rawReq) isIdempotent() bool {
+	return r.Idempotent || (r.Method != http.MethodPost && r.Method != http.MethodPatch)
+}
+
+// isConnectError returns true if the request is not sent, because the connection is not established
+func isConnectError(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// isRetryLater returns true if the server rejects the request without handling it, and asks to retry later
+func isRetryLater(resp *http.Response) bool {
+	status := resp.StatusCode
+	return (status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable) && resp.Header.Get("Retry-After") != ""
+}
+
+func isSessionExpiredStatus(status int) bool {
+	return status == http.StatusUnauthorized || status == http.StatusMisdirectedRequest
+}
+
+// Retry-After: <delay-seconds> or Retry-After: <http-date>
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+func sleepContext(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func discardBody(resp *http.Response) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1024*1024))
+	resp.Body.Close()
+}
+
+// bodyReplay rewinds the request body before each attempt,
+// the io.Reader body which is not an io.Seeker can only be sent once.
+type bodyReplay struct {
+	seeker     io.Seeker
+	offset     int64
+	replayable bool
+	sent       bool
+}
+
+func newBodyReplay(body any) (*bodyReplay, error) {
+	reader, ok := body.(io.Reader)
+	if !ok {
+		return &bodyReplay{replayable: true}, nil
+	}
+	seeker, ok := reader.(io.Seeker)
+	if !ok {
+		return &bodyReplay{replayable: false}, nil
+	}
+	offset, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	return &bodyReplay{seeker: seeker, offset: offset, replayable: true}, nil
+}
+
+func (r *bodyReplay) reset() error {
+	if r.sent && r.seeker != nil {
+		if _, err := r.seeker.Seek(r.offset, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	r.sent = true
+	return nil
+}
+
+func (r *bodyReplay) ok() bool {
+	return r.replayable
+}
@@ -0,0 +1,78 @@
+package internal_test
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/chyroc/icloudgo/icloudtest"
+	"github.com/chyroc/icloudgo/internal"
+)
+
+func TestRetryQuery(t *testing.T) {
+	server := icloudtest.NewServer()
+	defer server.Close()
+	server.AddPhoto("a.jpg", []byte("a"), time.Now())
+	photoCli := newTestPhotoService(t, server)
+
+	// the query only reads, it is retried without Retry-After
+	server.FailRequests(http.StatusServiceUnavailable, 2, 0)
+	album, err := photoCli.GetAlbum(internal.AlbumNameAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := album.Size(); size != 1 {
+		t.Fatalf("album size: %d, expect 1", size)
+	}
+
+	server.FailRequests(http.StatusServiceUnavailable, 10, 0)
+	if _, err := album.GetPhotosByOffset(0, 10); err == nil {
+		t.Fatal("expect error after the max attempts")
+	}
+	server.FailRequests(http.StatusServiceUnavailable, 0, 0)
+}
+
+func TestRetryUpload(t *testing.T) {
+	server := icloudtest.NewServer()
+	defer server.Close()
+	photoCli := newTestPhotoService(t, server)
+
+	// the upload may be committed by the server, it is not retried by the status without Retry-After
+	server.FailRequests(http.StatusServiceUnavailable, 1, 0)
+	if _, _, err := photoCli.Upload("a.jpg", bytes.NewReader([]byte("a")), nil); err == nil {
+		t.Fatal("expect error of the upload without Retry-After")
+	}
+	if photos := server.Photos(); len(photos) != 0 {
+		t.Fatalf("photos: %d, expect 0", len(photos))
+	}
+
+	server.FailRequests(http.StatusServiceUnavailable, 1, 1)
+	asset, isDuplicate, err := photoCli.Upload("a.jpg", bytes.NewReader([]byte("a")), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isDuplicate || asset == nil {
+		t.Fatalf("unexpected upload result: %v, %v", asset, isDuplicate)
+	}
+}
+
+func TestReauthenticate(t *testing.T) {
+	server := icloudtest.NewServer()
+	defer server.Close()
+	server.AddPhoto("a.jpg", []byte("a"), time.Now())
+	photoCli := newTestPhotoService(t, server)
+
+	server.ExpireSession()
+	album, err := photoCli.GetAlbum(internal.AlbumNameAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assets, err := album.GetPhotosByOffset(0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(assets) != 1 {
+		t.Fatalf("assets: %d, expect 1", len(assets))
+	}
+}
@@ -0,0 +1,37 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestNewHTTPRequestCnCookies(t *testing.T) {
+	cli, err := newClient(&ClientOption{Domain: "cn", CookieDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	home, _ := url.Parse("https://www.icloud.com.cn")
+	cli.cookieJar.SetCookies(home, []*http.Cookie{{Name: "X-APPLE-WEBAUTH-USER", Value: "user", Domain: ".icloud.com.cn", Path: "/"}})
+
+	// the service hosts of the cn account are not under icloud.com.cn, the cookie is attached to the request
+	req, err := cli.newHTTPRequest(context.Background(), &rawReq{Method: http.MethodGet, URL: "https://p31-ckdatabasews.icloud.com/database/1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cookie, err := req.Cookie("X-APPLE-WEBAUTH-USER"); err != nil || cookie.Value != "user" {
+		t.Fatalf("expect the icloud.com.cn cookie, got %v, err: %v", cookie, err)
+	}
+
+	// the jar sends it to the icloud.com.cn hosts itself, it must not be sent twice
+	req, err = cli.newHTTPRequest(context.Background(), &rawReq{Method: http.MethodGet, URL: "https://setup.icloud.com.cn/setup/ws/1/validate"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cookies := req.Cookies(); len(cookies) != 0 {
+		t.Fatalf("expect no explicit cookies, got %v", cookies)
+	}
+}
@@ -41,6 +41,21 @@ func cleanFilename(s string) string {
 	return cleanName(base) + ext
 }
 
+// cleanPathSegment keeps the name readable, only the characters which are invalid in the path segment are replaced
+func cleanPathSegment(s string) string {
+	l := []rune(s)
+	for i, v := range l {
+		if v < 0x20 || strings.ContainsRune(`/\:*?"<>|`, v) {
+			l[i] = '_'
+		}
+	}
+	res := strings.TrimRight(strings.TrimSpace(string(l)), ".")
+	if res == "" {
+		return "_"
+	}
+	return res
+}
+
 type set[T comparable] map[T]struct{}
 
 func newSet[T comparable](initValue ...T) set[T] {